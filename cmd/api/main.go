@@ -17,18 +17,84 @@ import (
 	"touchly/internal/admin"
 	"touchly/internal/api"
 	"touchly/internal/db"
+	"touchly/internal/emails"
 	"touchly/internal/handler"
 	"touchly/internal/services"
 	"touchly/internal/storage"
 	"touchly/internal/terrors"
+	"touchly/templates"
 )
 
 type config struct {
-	DatabaseURL  string `env:"DATABASE_URL,required"`
-	Server       ServerConfig
-	AWS          AWSConfig
-	JWTSecret    string `env:"JWT_SECRET,required"`
-	ResendApiKey string `env:"RESEND_API_KEY,required"`
+	DatabaseURL string `env:"DATABASE_URL,required"`
+	Server      ServerConfig
+	AWS         AWSConfig
+	JWTSecret   string `env:"JWT_SECRET,required"`
+	Email       EmailConfig
+	WebURL      string `env:"WEB_URL" envDefault:"https://touchly.mxksim.dev"`
+	Auth        AuthConfig
+	Geocoder    GeocoderConfig
+	Trash       TrashConfig
+}
+
+type TrashConfig struct {
+	Retention     time.Duration `env:"CONTACT_RETENTION" envDefault:"720h"`
+	PurgeInterval time.Duration `env:"CONTACT_PURGE_INTERVAL" envDefault:"1h"`
+}
+
+type GeocoderConfig struct {
+	URL       string `env:"GEOCODER_URL" envDefault:"https://nominatim.openstreetmap.org"`
+	UserAgent string `env:"GEOCODER_USER_AGENT" envDefault:"touchly/1.0 (hi@mxksim.dev)"`
+	// Interval keeps all geocoding requests within the Nominatim usage
+	// policy of one request per second.
+	Interval time.Duration `env:"GEOCODER_INTERVAL" envDefault:"1s"`
+}
+
+type AuthConfig struct {
+	AccessTokenTTL  time.Duration `env:"ACCESS_TOKEN_TTL" envDefault:"15m"`
+	RefreshTokenTTL time.Duration `env:"REFRESH_TOKEN_TTL" envDefault:"720h"`
+	OTP             OTPConfig
+	PasswordReset   PasswordResetConfig
+}
+
+type OTPConfig struct {
+	Length          int           `env:"OTP_LENGTH" envDefault:"6"`
+	TTL             time.Duration `env:"OTP_TTL" envDefault:"10m"`
+	MaxAttempts     int           `env:"OTP_MAX_ATTEMPTS" envDefault:"5"`
+	LockoutDuration time.Duration `env:"OTP_LOCKOUT_DURATION" envDefault:"15m"`
+	ResendCooldown  time.Duration `env:"OTP_RESEND_COOLDOWN" envDefault:"1m"`
+	MaxSendsPerHour int           `env:"OTP_MAX_SENDS_PER_HOUR" envDefault:"5"`
+}
+
+type PasswordResetConfig struct {
+	ResendCooldown  time.Duration `env:"PASSWORD_RESET_COOLDOWN" envDefault:"1m"`
+	MaxSendsPerHour int           `env:"PASSWORD_RESET_MAX_SENDS_PER_HOUR" envDefault:"5"`
+}
+
+type EmailConfig struct {
+	Transport    string `env:"EMAIL_TRANSPORT" envDefault:"resend"`
+	ResendApiKey string `env:"RESEND_API_KEY"`
+	From         string `env:"EMAIL_FROM" envDefault:"hi@mxksim.dev"`
+	Locale       string `env:"EMAIL_DEFAULT_LOCALE" envDefault:"en"`
+	Dir          string `env:"EMAIL_DIR" envDefault:"emails"`
+	SMTP         SMTPConfig
+	Outbox       OutboxConfig
+}
+
+type OutboxConfig struct {
+	PollInterval time.Duration `env:"EMAIL_OUTBOX_POLL_INTERVAL" envDefault:"5s"`
+	BatchSize    int           `env:"EMAIL_OUTBOX_BATCH_SIZE" envDefault:"20"`
+	MaxAttempts  int           `env:"EMAIL_OUTBOX_MAX_ATTEMPTS" envDefault:"8"`
+	MinBackoff   time.Duration `env:"EMAIL_OUTBOX_MIN_BACKOFF" envDefault:"30s"`
+	MaxBackoff   time.Duration `env:"EMAIL_OUTBOX_MAX_BACKOFF" envDefault:"1h"`
+}
+
+type SMTPConfig struct {
+	Host     string `env:"SMTP_HOST"`
+	Port     int    `env:"SMTP_PORT" envDefault:"587"`
+	Username string `env:"SMTP_USERNAME"`
+	Password string `env:"SMTP_PASSWORD"`
+	TLS      string `env:"SMTP_TLS" envDefault:"starttls"`
 }
 
 type ServerConfig struct {
@@ -73,9 +139,10 @@ func main() {
 	e.Use(middleware.Recover())
 
 	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
-		AllowOrigins: []string{"*"},
-		AllowMethods: []string{http.MethodGet, http.MethodPut, http.MethodPost, http.MethodDelete},
-		AllowHeaders: []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, echo.HeaderAuthorization},
+		AllowOrigins:  []string{"*"},
+		AllowMethods:  []string{http.MethodGet, http.MethodPut, http.MethodPatch, http.MethodPost, http.MethodDelete},
+		AllowHeaders:  []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, echo.HeaderAuthorization, "If-Match", "If-None-Match"},
+		ExposeHeaders: []string{"ETag"},
 	}))
 
 	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
@@ -144,9 +211,37 @@ func main() {
 		log.Fatalf("Failed to initialize AWS S3 client: %v\n", err)
 	}
 
-	email := services.NewEmailClient(cfg.ResendApiKey)
+	email, err := services.NewEmailTransport(services.EmailConfig{
+		Transport:    cfg.Email.Transport,
+		ResendApiKey: cfg.Email.ResendApiKey,
+		SMTP:         services.SMTPConfig(cfg.Email.SMTP),
+		Dir:          cfg.Email.Dir,
+	})
+
+	if err != nil {
+		log.Fatalf("Failed to initialize email transport: %v\n", err)
+	}
+
+	emailTemplates, err := emails.NewRegistry(templates.FS, cfg.Email.Locale)
 
-	apiSvc := api.NewApi(pg, email, s3Client, cfg.JWTSecret)
+	if err != nil {
+		log.Fatalf("Failed to load email templates: %v\n", err)
+	}
+
+	geocoder := services.NewNominatimClient(cfg.Geocoder.URL, cfg.Geocoder.UserAgent, cfg.Geocoder.Interval)
+
+	apiSvc := api.NewApi(pg, email, emailTemplates, s3Client, geocoder, api.Config{
+		JWTSecret:       cfg.JWTSecret,
+		WebURL:          cfg.WebURL,
+		EmailSender:     cfg.Email.From,
+		AccessTokenTTL:  cfg.Auth.AccessTokenTTL,
+		RefreshTokenTTL: cfg.Auth.RefreshTokenTTL,
+		OTP:             api.OTPConfig(cfg.Auth.OTP),
+		PasswordReset:   api.PasswordResetConfig(cfg.Auth.PasswordReset),
+		Outbox:          api.OutboxConfig(cfg.Email.Outbox),
+		Trash:           api.TrashConfig(cfg.Trash),
+		Geocoder:        api.GeocoderConfig{Interval: cfg.Geocoder.Interval},
+	})
 	adminSvc := admin.NewAdmin(pg)
 
 	tr := handler.New(apiSvc, adminSvc, cfg.JWTSecret)
@@ -157,6 +252,11 @@ func main() {
 
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer stop()
+
+	go apiSvc.RunEmailOutbox(ctx)
+	go apiSvc.RunContactPurge(ctx)
+	go apiSvc.RunAddressGeocoding(ctx)
+
 	// Start server
 	go func() {
 		if err := e.Start(cfg.Server.Host + ":" + cfg.Server.Port); err != nil {
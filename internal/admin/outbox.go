@@ -0,0 +1,47 @@
+package admin
+
+import (
+	"errors"
+	"touchly/internal/db"
+	"touchly/internal/terrors"
+)
+
+func (adm *admin) ListOutboxEmails(status db.OutboxStatus, page, pageSize int) ([]db.OutboxEmail, error) {
+	if status == "" {
+		status = db.OutboxStatusDead
+	}
+
+	if !status.IsValid() {
+		return nil, terrors.InvalidRequest(nil, "invalid status")
+	}
+
+	if page < 1 {
+		page = 1
+	}
+
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	emails, err := adm.storage.ListOutboxEmails(status, pageSize, (page-1)*pageSize)
+
+	if err != nil {
+		return nil, terrors.InternalServerError(err, "could not list emails")
+	}
+
+	return emails, nil
+}
+
+func (adm *admin) RequeueOutboxEmail(id int64) (*db.OutboxEmail, error) {
+	email, err := adm.storage.RequeueOutboxEmail(id)
+
+	if err != nil && errors.Is(err, db.ErrNotFound) {
+		return nil, terrors.NotFound(err, "dead email not found")
+	} else if err != nil && errors.Is(err, db.ErrOutboxEmailExpired) {
+		return nil, terrors.InvalidRequest(err, "email has expired and can not be requeued")
+	} else if err != nil {
+		return nil, terrors.InternalServerError(err, "could not requeue email")
+	}
+
+	return email, nil
+}
@@ -6,6 +6,12 @@ import (
 
 type storage interface {
 	CreateUser(user db.User) (*db.User, error)
+	GetUserByEmail(email string) (*db.User, error)
+	ListOutboxEmails(status db.OutboxStatus, limit, offset int) ([]db.OutboxEmail, error)
+	RequeueOutboxEmail(id int64) (*db.OutboxEmail, error)
+	CreateTag(tag db.Tag) (*db.Tag, error)
+	UpdateTag(tag db.Tag) (*db.Tag, error)
+	DeleteTag(id int64) error
 }
 
 type admin struct {
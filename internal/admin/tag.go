@@ -0,0 +1,68 @@
+package admin
+
+import (
+	"errors"
+	"touchly/internal/db"
+	"touchly/internal/terrors"
+)
+
+// CreateSystemTag creates a tag available to all users.
+func (adm *admin) CreateSystemTag(tag db.Tag) (*db.Tag, error) {
+	if err := tag.Normalize(); err != nil {
+		return nil, terrors.InvalidRequest(err, err.Error())
+	}
+
+	tag.UserID = nil
+
+	res, err := adm.storage.CreateTag(tag)
+
+	if err != nil {
+		return nil, tagError(err, "could not create tag")
+	}
+
+	return res, nil
+}
+
+// UpdateTag updates any tag, system or personal. Its owner is kept.
+func (adm *admin) UpdateTag(id int64, tag db.Tag) (*db.Tag, error) {
+	if err := tag.Normalize(); err != nil {
+		return nil, terrors.InvalidRequest(err, err.Error())
+	}
+
+	tag.ID = id
+
+	res, err := adm.storage.UpdateTag(tag)
+
+	if err != nil {
+		return nil, tagError(err, "could not update tag")
+	}
+
+	return res, nil
+}
+
+// DeleteTag deletes any tag, system or personal, and detaches it from
+// contacts.
+func (adm *admin) DeleteTag(id int64) error {
+	err := adm.storage.DeleteTag(id)
+
+	if err != nil && errors.Is(err, db.ErrNotFound) {
+		return terrors.NotFound(err, "tag not found")
+	} else if err != nil {
+		return terrors.InternalServerError(err, "could not delete tag")
+	}
+
+	return nil
+}
+
+func tagError(err error, msg string) error {
+	switch {
+	case errors.Is(err, db.ErrAlreadyExists):
+		return terrors.InvalidRequest(err, "tag with this name or slug already exists")
+	case errors.Is(err, db.ErrInvalidTagParent):
+		return terrors.InvalidRequest(err, "parent tag not found or not allowed")
+	case errors.Is(err, db.ErrNotFound):
+		return terrors.NotFound(err, "tag not found")
+	}
+
+	return terrors.InternalServerError(err, msg)
+}
@@ -1,6 +1,7 @@
 package admin
 
 import (
+	"errors"
 	"golang.org/x/crypto/bcrypt"
 	"time"
 	"touchly/internal/db"
@@ -38,3 +39,19 @@ func (adm *admin) CreateUser(email, password string) (*db.User, error) {
 
 	return res, nil
 }
+
+func (adm *admin) GetUserByEmail(email string) (*db.User, error) {
+	if email == "" {
+		return nil, terrors.InvalidRequest(nil, "email is required")
+	}
+
+	user, err := adm.storage.GetUserByEmail(email)
+
+	if err != nil && errors.Is(err, db.ErrNotFound) {
+		return nil, terrors.NotFound(err, "user not found")
+	} else if err != nil {
+		return nil, terrors.InternalServerError(err, "could not get user")
+	}
+
+	return user, nil
+}
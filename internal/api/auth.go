@@ -1,46 +1,60 @@
 package api
 
 import (
-	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
-	"html/template"
-	"math/rand"
+	"math/big"
+	"strconv"
 	"strings"
 	"time"
 	"touchly/internal/db"
-	"touchly/internal/services"
 	"touchly/internal/terrors"
 )
 
 type JWTClaims struct {
 	jwt.RegisteredClaims
-	UserID int64 `json:"uid"`
+	UserID    int64 `json:"uid"`
+	SessionID int64 `json:"sid"`
 }
 
-func generateOTPCode() string {
-	source := rand.NewSource(time.Now().UnixNano())
-	r := rand.New(source)
-
-	digits := "0123456789"
-	otpLength := 4
+// generateOTPCode returns a random numeric code of the given length.
+func generateOTPCode(length int) (string, error) {
 	var otpCode strings.Builder
 
-	for i := 0; i < otpLength; i++ {
-		randomIndex := r.Intn(len(digits))
-		otpCode.WriteByte(digits[randomIndex])
+	for i := 0; i < length; i++ {
+		n, err := rand.Int(rand.Reader, big.NewInt(10))
+		if err != nil {
+			return "", err
+		}
+
+		otpCode.WriteByte(byte('0' + n.Int64()))
 	}
 
-	return otpCode.String()
+	return otpCode.String(), nil
 }
 
-func GenerateJWT(secret string, uid int64) (string, error) {
+// hashOTPCode keys the code hash with the server secret and the user, so a
+// leaked table of short numeric codes cannot be brute-forced offline.
+func (api *api) hashOTPCode(userID int64, code string) string {
+	mac := hmac.New(sha256.New, []byte(api.cfg.JWTSecret))
+	mac.Write([]byte(strconv.FormatInt(userID, 10) + ":" + code))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func GenerateJWT(secret string, uid, sid int64, expiresAt time.Time) (string, error) {
 	claims := &JWTClaims{
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour * 30)),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
-		UserID: uid,
+		UserID:    uid,
+		SessionID: sid,
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
@@ -70,35 +84,79 @@ func (api *api) SetPassword(email, password string) error {
 	return nil
 }
 
-func (api *api) VerifyOTP(email, otpCode string) error {
+// VerifyOTP checks the code sent by SendOTP, marks the email as verified and
+// signs the user in, so OTP doubles as a passwordless login.
+func (api *api) VerifyOTP(email, otpCode string, client Client) (*AuthToken, error) {
 	if email == "" || otpCode == "" {
-		return terrors.InvalidRequest(nil, "email and OTP code are required")
+		return nil, terrors.InvalidRequest(nil, "email and OTP code are required")
 	}
 
 	user, err := api.storage.GetUserByEmail(email)
 
-	if err != nil && db.IsNoRowsError(err) {
-		return terrors.InvalidRequest(nil, "user not found")
+	if err != nil && errors.Is(err, db.ErrNotFound) {
+		return nil, terrors.InvalidRequest(nil, "user not found")
 	} else if err != nil {
-		return terrors.InternalServerError(err, "failed to get user")
+		return nil, terrors.InternalServerError(err, "failed to get user")
 	}
 
-	otp, err := api.storage.GetOTPByCode(otpCode, user.ID)
+	if err := api.checkOTPLock(user.ID); err != nil {
+		return nil, err
+	}
 
-	if err != nil {
-		return terrors.InternalServerError(err, "invalid OTP")
+	otp, err := api.storage.GetActiveOTP(user.ID)
+
+	if err != nil && errors.Is(err, db.ErrNotFound) {
+		return nil, terrors.InvalidRequest(err, "OTP is invalid or expired")
+	} else if err != nil {
+		return nil, terrors.InternalServerError(err, "failed to get OTP")
 	}
 
-	if otp.IsUsed {
-		return terrors.InvalidRequest(nil, "OTP is already used")
+	if !hmac.Equal([]byte(otp.CodeHash), []byte(api.hashOTPCode(user.ID, otpCode))) {
+		attempts, err := api.storage.IncrementOTPAttempts(otp.ID)
+
+		if err != nil {
+			return nil, terrors.InternalServerError(err, "failed to update OTP")
+		}
+
+		if attempts >= api.cfg.OTP.MaxAttempts {
+			if err := api.storage.LockUserOTP(user.ID, api.cfg.OTP.LockoutDuration); err != nil {
+				return nil, terrors.InternalServerError(err, "failed to lock OTP")
+			}
+
+			return nil, terrors.TooManyRequests(nil, "too many attempts, try again later")
+		}
+
+		return nil, terrors.InvalidRequest(nil, "invalid OTP")
 	}
 
-	if err := api.storage.SetOTPIsUsed(otp.ID); err != nil {
-		return terrors.InternalServerError(err, "failed to update OTP")
+	if err := api.storage.SetOTPIsUsed(otp.ID); err != nil && errors.Is(err, db.ErrNotFound) {
+		return nil, terrors.InvalidRequest(err, "OTP is already used")
+	} else if err != nil {
+		return nil, terrors.InternalServerError(err, "failed to update OTP")
 	}
 
 	if err := api.storage.UpdateUserVerified(user.ID); err != nil {
-		return terrors.InternalServerError(err, "failed to update user")
+		return nil, terrors.InternalServerError(err, "failed to update user")
+	}
+
+	token, err := api.startSession(user.ID, client)
+
+	if err != nil {
+		return nil, terrors.InternalServerError(err, "failed to start session")
+	}
+
+	return token, nil
+}
+
+func (api *api) checkOTPLock(userID int64) error {
+	locked, err := api.storage.IsUserOTPLocked(userID)
+
+	if err != nil {
+		return terrors.InternalServerError(err, "failed to check OTP lock")
+	}
+
+	if locked {
+		return terrors.TooManyRequests(nil, "too many attempts, try again later")
 	}
 
 	return nil
@@ -112,89 +170,106 @@ func hashPassword(password string) (string, error) {
 	return string(bytes), nil
 }
 
-func (api *api) SendOTP(email string) error {
+// SendOTP emails a new code to the user, creating the user on first use.
+// The language is stored for new users and used for the email when the user
+// has not chosen one.
+func (api *api) SendOTP(email, language string) error {
 	if email == "" {
 		return terrors.InvalidRequest(nil, "email is required")
 	}
 
+	if !isLanguageTag(language) {
+		language = ""
+	}
+
 	user, err := api.storage.GetUserByEmail(email)
 
-	if err != nil {
-		if db.IsNoRowsError(err) {
-			u := db.User{
-				Email:           email,
-				EmailVerifiedAt: nil,
-			}
+	if err != nil && errors.Is(err, db.ErrNotFound) {
+		u := db.User{
+			Email:           email,
+			EmailVerifiedAt: nil,
+			Language:        optional(language),
+		}
 
-			user, err = api.storage.CreateUser(u)
+		user, err = api.storage.CreateUser(u)
 
-			if err != nil {
-				return err
-			}
-		} else {
-			return err
+		if err != nil {
+			return terrors.InternalServerError(err, "failed to create user")
 		}
+	} else if err != nil {
+		return terrors.InternalServerError(err, "failed to get user")
 	}
 
-	// Generate OTP (implement your own logic for OTP generation)
-	otpCode := generateOTPCode()
+	if err := api.checkOTPLock(user.ID); err != nil {
+		return err
+	}
 
-	// Set OTP expiration time (e.g., 10 minutes from now)
-	expiresAt := time.Now().Add(10 * time.Minute)
+	recent, err := api.storage.CountOTPsSince(user.ID, api.cfg.OTP.ResendCooldown)
 
-	otp := db.OTP{
-		UserID:    user.ID,
-		OTPCode:   otpCode,
-		ExpiresAt: expiresAt,
+	if err != nil {
+		return terrors.InternalServerError(err, "failed to count OTPs")
 	}
 
-	if _, err := api.storage.CreateOTP(otp); err != nil {
-		return err
+	if recent > 0 {
+		return terrors.TooManyRequests(nil, "OTP was sent recently, try again later")
 	}
 
-	if err := api.SendOTPEmail(email, otpCode); err != nil {
-		return err
-	}
+	recent, err = api.storage.CountOTPsSince(user.ID, time.Hour)
 
-	return nil
-}
+	if err != nil {
+		return terrors.InternalServerError(err, "failed to count OTPs")
+	}
 
-func (api *api) SendOTPEmail(recipientEmail, otpCode string) error {
-	type Context struct {
-		OTPCode string
+	if recent >= api.cfg.OTP.MaxSendsPerHour {
+		return terrors.TooManyRequests(nil, "too many OTPs requested, try again later")
 	}
 
-	tmpl, err := template.ParseFiles("templates/otp.gohtml")
+	otpCode, err := generateOTPCode(api.cfg.OTP.Length)
 
 	if err != nil {
-		return err
+		return terrors.InternalServerError(err, "failed to generate OTP")
+	}
+
+	if user.Language != nil {
+		language = *user.Language
 	}
 
-	var tpl bytes.Buffer
-	err = tmpl.Execute(&tpl, Context{OTPCode: otpCode})
+	message, err := api.renderEmail(email, language, "otp", struct{ OTPCode string }{otpCode}, api.cfg.OTP.TTL)
 
 	if err != nil {
-		return err
+		return terrors.InternalServerError(err, "failed to render OTP email")
 	}
 
-	message := &services.MailMessage{
-		To:            recipientEmail,
-		Subject:       "Your OTP code",
-		MessageStream: "outbound",
-		From:          "hi@mxksim.dev",
-		HtmlBody:      tpl.String(),
+	// the email is queued together with the code and delivered by the outbox
+	// worker, so a failing mail provider does not fail the request
+	if _, err := api.storage.CreateOTP(user.ID, api.hashOTPCode(user.ID, otpCode), api.cfg.OTP.TTL, *message); err != nil {
+		return err
 	}
 
-	err = api.emailClient.SendEmail(message)
+	return nil
+}
+
+// renderEmail renders the named email template in the given language. The
+// email expires after ttl, with the code or link it carries.
+func (api *api) renderEmail(recipientEmail, language, name string, data any, ttl time.Duration) (*db.OutboxEmail, error) {
+	message, err := api.templates.Render(name, language, data)
 
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	return &db.OutboxEmail{
+		Recipient:     recipientEmail,
+		Subject:       message.Subject,
+		MessageStream: "outbound",
+		Sender:        api.cfg.EmailSender,
+		HtmlBody:      message.HTML,
+		TextBody:      message.Text,
+		ExpiresAt:     time.Now().Add(ttl),
+	}, nil
 }
 
-func (api *api) LoginUser(email, password string) (*string, error) {
+func (api *api) LoginUser(email, password string, client Client) (*AuthToken, error) {
 	if email == "" || password == "" {
 		return nil, errors.New("invalid request")
 	}
@@ -215,11 +290,11 @@ func (api *api) LoginUser(email, password string) (*string, error) {
 		return nil, errors.New("invalid credentials")
 	}
 
-	token, err := GenerateJWT(api.jwtSecret, user.ID)
+	token, err := api.startSession(user.ID, client)
 
 	if err != nil {
-		return nil, err
+		return nil, terrors.InternalServerError(err, "failed to start session")
 	}
 
-	return &token, nil
+	return token, nil
 }
@@ -0,0 +1,371 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+	"touchly/internal/db"
+	"touchly/internal/emails"
+	"touchly/internal/terrors"
+)
+
+// fakeOTPStorage keeps users, codes and sessions in memory and follows the
+// semantics of the Postgres storage, with a clock the tests move forward.
+// Methods the OTP flow does not use panic through the nil embedded storage.
+type fakeOTPStorage struct {
+	storage
+
+	now         time.Time
+	users       []*db.User
+	otps        []*db.OTP
+	lockedUntil map[int64]time.Time
+	outbox      []db.OutboxEmail
+	sessions    int64
+}
+
+func newFakeOTPStorage() *fakeOTPStorage {
+	return &fakeOTPStorage{
+		now:         time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC),
+		lockedUntil: make(map[int64]time.Time),
+	}
+}
+
+func (s *fakeOTPStorage) CreateUser(user db.User) (*db.User, error) {
+	user.ID = int64(len(s.users) + 1)
+	user.CreatedAt = s.now
+	user.UpdatedAt = s.now
+	s.users = append(s.users, &user)
+
+	return &user, nil
+}
+
+func (s *fakeOTPStorage) GetUserByEmail(email string) (*db.User, error) {
+	for _, user := range s.users {
+		if user.Email == email {
+			copied := *user
+			return &copied, nil
+		}
+	}
+
+	return nil, db.ErrNotFound
+}
+
+func (s *fakeOTPStorage) UpdateUserVerified(userID int64) error {
+	now := s.now
+	s.users[userID-1].EmailVerifiedAt = &now
+
+	return nil
+}
+
+func (s *fakeOTPStorage) invalidateOTPs(userID int64) {
+	for _, otp := range s.otps {
+		if otp.UserID == userID {
+			otp.IsUsed = true
+		}
+	}
+}
+
+func (s *fakeOTPStorage) CreateOTP(userID int64, codeHash string, ttl time.Duration, email db.OutboxEmail) (*db.OTP, error) {
+	s.invalidateOTPs(userID)
+
+	otp := &db.OTP{
+		ID:        int64(len(s.otps) + 1),
+		UserID:    userID,
+		CodeHash:  codeHash,
+		ExpiresAt: s.now.Add(ttl),
+		CreatedAt: s.now,
+	}
+
+	s.otps = append(s.otps, otp)
+	s.outbox = append(s.outbox, email)
+
+	copied := *otp
+
+	return &copied, nil
+}
+
+func (s *fakeOTPStorage) GetActiveOTP(userID int64) (*db.OTP, error) {
+	for i := len(s.otps) - 1; i >= 0; i-- {
+		if otp := s.otps[i]; otp.UserID == userID && !otp.IsUsed && otp.ExpiresAt.After(s.now) {
+			copied := *otp
+			return &copied, nil
+		}
+	}
+
+	return nil, db.ErrNotFound
+}
+
+func (s *fakeOTPStorage) SetOTPIsUsed(otpID int64) error {
+	otp := s.otps[otpID-1]
+
+	if otp.IsUsed {
+		return db.ErrNotFound
+	}
+
+	otp.IsUsed = true
+
+	return nil
+}
+
+func (s *fakeOTPStorage) IncrementOTPAttempts(otpID int64) (int, error) {
+	s.otps[otpID-1].Attempts++
+
+	return s.otps[otpID-1].Attempts, nil
+}
+
+func (s *fakeOTPStorage) CountOTPsSince(userID int64, period time.Duration) (int, error) {
+	count := 0
+
+	for _, otp := range s.otps {
+		if otp.UserID == userID && otp.CreatedAt.After(s.now.Add(-period)) {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (s *fakeOTPStorage) LockUserOTP(userID int64, duration time.Duration) error {
+	s.lockedUntil[userID] = s.now.Add(duration)
+	s.invalidateOTPs(userID)
+
+	return nil
+}
+
+func (s *fakeOTPStorage) IsUserOTPLocked(userID int64) (bool, error) {
+	return s.lockedUntil[userID].After(s.now), nil
+}
+
+func (s *fakeOTPStorage) CreateSession(session db.Session) (*db.Session, error) {
+	s.sessions++
+	session.ID = s.sessions
+
+	return &session, nil
+}
+
+// fakeTemplates keeps the code of the last rendered OTP email.
+type fakeTemplates struct {
+	code string
+}
+
+func (t *fakeTemplates) Render(name, locale string, data any) (*emails.Message, error) {
+	if otp, ok := data.(struct{ OTPCode string }); ok {
+		t.code = otp.OTPCode
+	}
+
+	return &emails.Message{Subject: name}, nil
+}
+
+type otpTest struct {
+	t         *testing.T
+	api       *api
+	storage   *fakeOTPStorage
+	templates *fakeTemplates
+}
+
+const otpTestEmail = "user@example.com"
+
+func (o *otpTest) send() error {
+	return o.api.SendOTP(otpTestEmail, "en")
+}
+
+func (o *otpTest) mustSend() string {
+	o.t.Helper()
+
+	if err := o.send(); err != nil {
+		o.t.Fatalf("SendOTP: %v", err)
+	}
+
+	return o.templates.code
+}
+
+func (o *otpTest) verify(code string) error {
+	_, err := o.api.VerifyOTP(otpTestEmail, code, Client{})
+
+	return err
+}
+
+func (o *otpTest) advance(d time.Duration) {
+	o.storage.now = o.storage.now.Add(d)
+}
+
+// wrongCode returns a code of the same length that differs from code.
+func wrongCode(code string) string {
+	b := []byte(code)
+	b[0] = '0' + (b[0]-'0'+1)%10
+
+	return string(b)
+}
+
+func expectCode(t *testing.T, err error, code int) {
+	t.Helper()
+
+	var terror *terrors.Error
+
+	if code == 0 && err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	} else if code != 0 && (!errors.As(err, &terror) || terror.Code != code) {
+		t.Fatalf("expected error with code %d, got %v", code, err)
+	}
+}
+
+func TestOTP(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  OTPConfig
+		run  func(o *otpTest)
+	}{
+		{
+			name: "code has the configured length",
+			cfg:  OTPConfig{Length: 8},
+			run: func(o *otpTest) {
+				code := o.mustSend()
+
+				if len(code) != 8 {
+					o.t.Fatalf("expected 8 digits, got %q", code)
+				}
+
+				for _, r := range code {
+					if r < '0' || r > '9' {
+						o.t.Fatalf("expected digits only, got %q", code)
+					}
+				}
+			},
+		},
+		{
+			name: "first code creates the user",
+			run: func(o *otpTest) {
+				o.mustSend()
+
+				if len(o.storage.users) != 1 || len(o.storage.outbox) != 1 {
+					o.t.Fatalf("expected a new user and a queued email, got %d users and %d emails", len(o.storage.users), len(o.storage.outbox))
+				}
+			},
+		},
+		{
+			name: "valid code signs in once",
+			run: func(o *otpTest) {
+				code := o.mustSend()
+
+				expectCode(o.t, o.verify(code), 0)
+
+				if o.storage.users[0].EmailVerifiedAt == nil {
+					o.t.Fatal("expected the email to be verified")
+				}
+
+				expectCode(o.t, o.verify(code), http.StatusBadRequest)
+			},
+		},
+		{
+			name: "expired code is rejected",
+			cfg:  OTPConfig{TTL: 10 * time.Minute},
+			run: func(o *otpTest) {
+				code := o.mustSend()
+
+				o.advance(10*time.Minute + time.Second)
+
+				expectCode(o.t, o.verify(code), http.StatusBadRequest)
+			},
+		},
+		{
+			name: "code is valid until it expires",
+			cfg:  OTPConfig{TTL: 10 * time.Minute},
+			run: func(o *otpTest) {
+				code := o.mustSend()
+
+				o.advance(9 * time.Minute)
+
+				expectCode(o.t, o.verify(code), 0)
+			},
+		},
+		{
+			name: "wrong codes are counted and lock the user out",
+			cfg:  OTPConfig{MaxAttempts: 3, LockoutDuration: 15 * time.Minute},
+			run: func(o *otpTest) {
+				code := o.mustSend()
+
+				expectCode(o.t, o.verify(wrongCode(code)), http.StatusBadRequest)
+				expectCode(o.t, o.verify(wrongCode(code)), http.StatusBadRequest)
+
+				if attempts := o.storage.otps[0].Attempts; attempts != 2 {
+					o.t.Fatalf("expected 2 attempts, got %d", attempts)
+				}
+
+				expectCode(o.t, o.verify(wrongCode(code)), http.StatusTooManyRequests)
+
+				// the right code does not help once locked, and it was
+				// invalidated by the lock
+				expectCode(o.t, o.verify(code), http.StatusTooManyRequests)
+				expectCode(o.t, o.send(), http.StatusTooManyRequests)
+
+				o.advance(15*time.Minute + time.Second)
+
+				expectCode(o.t, o.verify(code), http.StatusBadRequest)
+
+				expectCode(o.t, o.verify(o.mustSend()), 0)
+			},
+		},
+		{
+			name: "resend is refused within the cooldown",
+			cfg:  OTPConfig{ResendCooldown: time.Minute},
+			run: func(o *otpTest) {
+				o.mustSend()
+
+				o.advance(30 * time.Second)
+				expectCode(o.t, o.send(), http.StatusTooManyRequests)
+
+				o.advance(31 * time.Second)
+				expectCode(o.t, o.send(), 0)
+			},
+		},
+		{
+			name: "sends are capped per hour",
+			cfg:  OTPConfig{ResendCooldown: time.Minute, MaxSendsPerHour: 3},
+			run: func(o *otpTest) {
+				for i := 0; i < 3; i++ {
+					o.mustSend()
+					o.advance(2 * time.Minute)
+				}
+
+				expectCode(o.t, o.send(), http.StatusTooManyRequests)
+
+				o.advance(time.Hour)
+				expectCode(o.t, o.send(), 0)
+			},
+		},
+		{
+			name: "a new code invalidates earlier ones",
+			cfg:  OTPConfig{ResendCooldown: time.Minute},
+			run: func(o *otpTest) {
+				first := o.mustSend()
+
+				o.advance(2 * time.Minute)
+
+				second := o.mustSend()
+				if first == second {
+					o.t.Skip("the same code was generated twice")
+				}
+
+				expectCode(o.t, o.verify(first), http.StatusBadRequest)
+				expectCode(o.t, o.verify(second), 0)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeOTPStorage()
+			templates := &fakeTemplates{}
+
+			o := &otpTest{
+				t:         t,
+				api:       NewApi(fake, nil, templates, nil, nil, Config{JWTSecret: "secret", OTP: tt.cfg}),
+				storage:   fake,
+				templates: templates,
+			}
+
+			tt.run(o)
+		})
+	}
+}
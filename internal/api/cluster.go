@@ -0,0 +1,52 @@
+package api
+
+import (
+	"math"
+	"touchly/internal/db"
+	"touchly/internal/terrors"
+)
+
+const (
+	maxClusterZoom = 22
+	// clusterCellPixels is the width of a clustering cell on screen for
+	// 256px web map tiles.
+	clusterCellPixels = 60
+	clusterSampleSize = 5
+	maxClusters       = 1000
+)
+
+// ListContactClusters aggregates public contacts within the bbox for a map
+// at the given zoom level. Tags filter by the system tags and the personal
+// tags of the user.
+func (api *api) ListContactClusters(userID int64, bbox string, zoom int, tagIDs []int) ([]db.ContactCluster, error) {
+	if bbox == "" {
+		return nil, terrors.InvalidRequest(nil, "bbox is required")
+	}
+
+	box, err := parseBBox(bbox)
+
+	if err != nil {
+		return nil, terrors.InvalidRequest(err, err.Error())
+	}
+
+	if zoom < 0 || zoom > maxClusterZoom {
+		return nil, terrors.InvalidRequest(nil, "zoom must be between 0 and 22")
+	}
+
+	query := db.ClusterQuery{
+		UserID:      userID,
+		BBox:        *box,
+		CellSize:    360 / (256 * math.Pow(2, float64(zoom))) * clusterCellPixels,
+		SampleSize:  clusterSampleSize,
+		TagIDs:      tagIDs,
+		MaxClusters: maxClusters,
+	}
+
+	clusters, err := api.storage.ListContactClusters(query)
+
+	if err != nil {
+		return nil, terrors.InternalServerError(err, "failed to list clusters")
+	}
+
+	return clusters, nil
+}
@@ -3,6 +3,8 @@ package api
 import (
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"touchly/internal/db"
 	"touchly/internal/terrors"
 )
@@ -10,25 +12,79 @@ import (
 type CreateAddressRequest struct {
 	ExternalID *string `json:"external_id"`
 	Label      string  `json:"label" validate:"required"`
-	Name       string  `json:"name" validate:"required"`
-	Lat        float64 `json:"lat" validate:"required"`
-	Lng        float64 `json:"lng" validate:"required"`
+	// Name is the address as free-form text. When Lat and Lng are omitted
+	// they are found by geocoding Name, when Name is empty it is looked up
+	// at Lat and Lng.
+	Name        string   `json:"name"`
+	Lat         *float64 `json:"lat" validate:"omitempty,min=-90,max=90"`
+	Lng         *float64 `json:"lng" validate:"omitempty,min=-180,max=180"`
+	Street      *string  `json:"street"`
+	HouseNumber *string  `json:"house_number"`
+	City        *string  `json:"city"`
+	Postcode    *string  `json:"postcode"`
+	Country     *string  `json:"country"`
+	CountryCode *string  `json:"country_code"`
+	// IsPrimary makes it the primary address, used for geo search. The first
+	// address of a contact is always primary.
+	IsPrimary bool `json:"is_primary"`
 } // @Name CreateAddressRequest
 
+func (a CreateAddressRequest) hasLocation() bool {
+	return a.Lat != nil && a.Lng != nil
+}
+
 func (a CreateAddressRequest) toAddress() db.Address {
-	return db.Address{
-		ExternalID: a.ExternalID,
-		Label:      a.Label,
-		Name:       a.Name,
-		Location: db.Point{
-			Lat: a.Lat,
-			Lng: a.Lng,
-		},
+	address := db.Address{
+		ExternalID:  a.ExternalID,
+		Label:       a.Label,
+		Name:        a.Name,
+		Street:      a.Street,
+		HouseNumber: a.HouseNumber,
+		City:        a.City,
+		Postcode:    a.Postcode,
+		Country:     a.Country,
+		CountryCode: a.CountryCode,
+		IsPrimary:   a.IsPrimary,
 	}
+
+	if a.hasLocation() {
+		address.Location = db.Point{Lat: *a.Lat, Lng: *a.Lng}
+	}
+
+	return address
 }
 
+// toImportedAddress returns the address without geocoding it, it is queued
+// for background geocoding when it has no location.
+func (a CreateAddressRequest) toImportedAddress() db.Address {
+	address := a.toAddress()
+	address.GeocodePending = !a.hasLocation()
+
+	return address
+}
+
+// maxContactAddresses limits the addresses of a new contact, each of them
+// may take a geocoding request.
+const maxContactAddresses = 10
+
 func (api *api) CreateContact(userID int64, contact CreateContactRequest) (*db.Contact, error) {
-	res, err := api.storage.CreateContact(userID, contact.toContact(), contact.Tags, contact.SocialLinks)
+	if len(contact.addresses()) > maxContactAddresses {
+		return nil, terrors.InvalidRequest(nil, fmt.Sprintf("contact can have at most %d addresses", maxContactAddresses))
+	}
+
+	toCreate := contact.toContact()
+
+	for _, address := range contact.addresses() {
+		resolved, err := api.resolveAddress(address)
+
+		if err != nil {
+			return nil, err
+		}
+
+		toCreate.Addresses = append(toCreate.Addresses, *resolved)
+	}
+
+	res, err := api.storage.CreateContact(userID, toCreate, contact.Tags, contact.SocialLinks)
 
 	if err != nil {
 		return nil, terrors.InternalServerError(err, "failed to create contact")
@@ -63,10 +119,15 @@ type UpdateContactRequest struct {
 	SocialLinks      *[]db.Link `db:"-" json:"social_links,omitempty"`
 } // @Name UpdateContactRequest
 
-type CreateContactRequest UpdateContactRequest // @Name CreateContactRequest
+type CreateContactRequest struct {
+	UpdateContactRequest
+	// Address is added before Addresses.
+	Address   *CreateAddressRequest  `json:"address,omitempty"`
+	Addresses []CreateAddressRequest `json:"addresses,omitempty"`
+} // @Name CreateContactRequest
 
 func (r CreateContactRequest) toContact() db.Contact {
-	return db.Contact{
+	contact := db.Contact{
 		Name:             *r.Name,
 		Avatar:           r.Avatar,
 		ActivityName:     r.ActivityName,
@@ -77,6 +138,16 @@ func (r CreateContactRequest) toContact() db.Contact {
 		PhoneCallingCode: r.PhoneCallingCode,
 		Email:            r.Email,
 	}
+
+	return contact
+}
+
+func (r CreateContactRequest) addresses() []CreateAddressRequest {
+	if r.Address == nil {
+		return r.Addresses
+	}
+
+	return append([]CreateAddressRequest{*r.Address}, r.Addresses...)
 }
 
 func collectUpdates(contact UpdateContactRequest) map[string]interface{} {
@@ -121,42 +192,154 @@ func collectUpdates(contact UpdateContactRequest) map[string]interface{} {
 	return updates
 }
 
-func (api *api) UpdateContact(userID, contactID int64, request UpdateContactRequest) (*db.Contact, error) {
+// UpdateContact updates the contact if it is still at version, see
+// db.Contact.Version.
+func (api *api) UpdateContact(userID, contactID int64, version int, request UpdateContactRequest) (*db.Contact, error) {
 	updates := collectUpdates(request)
 
-	res, err := api.storage.UpdateContact(userID, contactID, request.Tags, request.SocialLinks, updates)
+	res, err := api.storage.UpdateContact(userID, contactID, version, request.Tags, request.SocialLinks, updates)
 
-	if err != nil {
+	if err != nil && errors.Is(err, db.ErrNotFound) {
+		return nil, terrors.NotFound(err, "contact not found")
+	} else if err != nil && errors.Is(err, db.ErrConflict) {
+		return nil, errContactModified(err)
+	} else if err != nil {
 		return nil, terrors.InternalServerError(err, "failed to update contact")
 	}
 
 	return res, nil
 }
 
-func (api *api) ListContacts(userID int64, tagIDs []int, search string, lat float64, lng float64, radius int, page, pageSize int) (db.ContactsPage, error) {
-	if page < 1 {
-		page = 1
+type ListContactsRequest struct {
+	TagIDs []int
+	Search string
+	Lat    float64
+	Lng    float64
+	// Radius is in kilometres, RadiusMeters takes precedence when set.
+	Radius       int
+	RadiusMeters float64
+	// BBox is "minLng,minLat,maxLng,maxLat", e.g. the visible map area.
+	BBox     string
+	Page     int
+	PageSize int
+	// Sort defaults to relevance when searching and to created otherwise.
+	Sort db.ContactSort
+	// Order is asc or desc, the default depends on Sort.
+	Order string
+	// Cursor is next_cursor or prev_cursor of a previous page.
+	Cursor    string
+	SkipCount bool
+}
+
+func (api *api) ListContacts(userID int64, request ListContactsRequest) (db.ContactsPage, error) {
+	if request.Page < 1 {
+		request.Page = 1
+	}
+
+	if request.PageSize < 1 {
+		request.PageSize = 20
+	}
+
+	radius := request.RadiusMeters
+	if radius == 0 {
+		radius = float64(request.Radius) * 1000
 	}
 
-	if pageSize < 1 {
-		pageSize = 20
+	if radius < 0 {
+		return db.ContactsPage{}, terrors.InvalidRequest(nil, "radius must be positive")
 	}
 
-	if lat != 0 && lng != 0 {
-		if radius < 1 {
+	var bbox *db.BBox
+
+	if request.BBox != "" {
+		box, err := parseBBox(request.BBox)
+
+		if err != nil {
+			return db.ContactsPage{}, terrors.InvalidRequest(err, err.Error())
+		}
+
+		bbox = box
+	}
+
+	if request.Lat != 0 && request.Lng != 0 {
+		if request.Lat < -90 || request.Lat > 90 || request.Lng < -180 || request.Lng > 180 {
+			return db.ContactsPage{}, terrors.InvalidRequest(nil, "lat or lng is out of range")
+		}
+
+		// a point without radius only measures distances within the box
+		if radius == 0 && bbox == nil {
 			return db.ContactsPage{}, terrors.InvalidRequest(nil, "radius is required")
 		}
 	}
 
 	query := db.ContactQuery{
-		TagIDs:   tagIDs,
-		Search:   search,
-		Lat:      lat,
-		Lng:      lng,
-		Radius:   radius,
-		Page:     page,
-		PageSize: pageSize,
-		UserID:   userID,
+		TagIDs:       request.TagIDs,
+		Search:       request.Search,
+		Lat:          request.Lat,
+		Lng:          request.Lng,
+		RadiusMeters: radius,
+		BBox:         bbox,
+		Page:         request.Page,
+		PageSize:     request.PageSize,
+		UserID:       userID,
+		Sort:         request.Sort,
+		SkipCount:    request.SkipCount,
+	}
+
+	if request.Cursor != "" {
+		cursor, err := db.DecodeContactCursor(request.Cursor)
+
+		if err != nil {
+			return db.ContactsPage{}, terrors.InvalidRequest(err, "invalid cursor")
+		}
+
+		// the cursor carries the order it was issued for
+		if query.Sort == "" {
+			query.Sort = cursor.Sort
+		} else if query.Sort != cursor.Sort {
+			return db.ContactsPage{}, terrors.InvalidRequest(nil, "cursor was issued for another sort")
+		}
+
+		if request.Order == "" {
+			request.Order = "asc"
+			if cursor.Desc {
+				request.Order = "desc"
+			}
+		}
+
+		query.Cursor = cursor
+	}
+
+	if query.Sort == "" {
+		query.Sort = db.ContactSortCreated
+		if request.Search != "" {
+			query.Sort = db.ContactSortRelevance
+		}
+	}
+
+	if !query.Sort.IsValid() {
+		return db.ContactsPage{}, terrors.InvalidRequest(nil, "invalid sort")
+	}
+
+	switch request.Order {
+	case "":
+		query.Desc = query.Sort.DefaultDesc()
+	case "asc", "desc":
+		query.Desc = request.Order == "desc"
+	default:
+		return db.ContactsPage{}, terrors.InvalidRequest(nil, "order must be asc or desc")
+	}
+
+	if query.Cursor != nil && (query.Cursor.Sort != query.Sort || query.Cursor.Desc != query.Desc) {
+		return db.ContactsPage{}, terrors.InvalidRequest(nil, "cursor does not match the sort order")
+	}
+
+	if query.Sort == db.ContactSortDistance && (request.Lat == 0 || request.Lng == 0) {
+		return db.ContactsPage{}, terrors.InvalidRequest(nil, "sorting by distance requires lat and lng")
+	}
+
+	if query.Sort == db.ContactSortRelevance && request.Search == "" {
+		return db.ContactsPage{}, terrors.InvalidRequest(nil, "sorting by relevance requires a search query")
 	}
 
 	contacts, err := api.storage.ListContacts(query)
@@ -168,11 +351,40 @@ func (api *api) ListContacts(userID int64, tagIDs []int, search string, lat floa
 	return contacts, nil
 }
 
+// parseBBox parses "minLng,minLat,maxLng,maxLat".
+func parseBBox(s string) (*db.BBox, error) {
+	parts := strings.Split(s, ",")
+
+	if len(parts) != 4 {
+		return nil, errors.New("bbox must be minLng,minLat,maxLng,maxLat")
+	}
+
+	var values [4]float64
+
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+
+		if err != nil {
+			return nil, errors.New("bbox must be minLng,minLat,maxLng,maxLat")
+		}
+
+		values[i] = v
+	}
+
+	box := &db.BBox{MinLng: values[0], MinLat: values[1], MaxLng: values[2], MaxLat: values[3]}
+
+	if box.MinLng < -180 || box.MaxLng > 180 || box.MinLat < -90 || box.MaxLat > 90 || box.MinLat > box.MaxLat {
+		return nil, errors.New("bbox is out of range")
+	}
+
+	return box, nil
+}
+
 func (api *api) GetContact(userID, id int64) (*db.Contact, error) {
 	contact, err := api.storage.GetContact(userID, id)
 
 	if err != nil {
-		if db.IsNoRowsError(err) {
+		if errors.Is(err, db.ErrNotFound) {
 			return nil, terrors.NotFound(fmt.Errorf("contact not found"), "contact not found")
 		}
 
@@ -187,6 +399,8 @@ func (api *api) SaveContact(userID, contactID int64) error {
 
 	if err != nil && errors.Is(err, db.ErrAlreadyExists) {
 		return terrors.InvalidRequest(err, "contact already saved")
+	} else if err != nil && errors.Is(err, db.ErrNotFound) {
+		return terrors.NotFound(err, "contact not found")
 	} else if err != nil {
 		return terrors.InternalServerError(err, "failed to save contact")
 	}
@@ -216,44 +430,96 @@ func (api *api) ListSavedContacts(userID int64) ([]db.Contact, error) {
 	return contacts, nil
 }
 
-func (api *api) CreateContactAddress(userID, contactID int64, address CreateAddressRequest) (*db.Address, error) {
-	contact, err := api.storage.GetContact(userID, contactID)
+func (api *api) CreateContactAddress(userID, contactID int64, version int, address CreateAddressRequest) (*db.Address, error) {
+	if _, err := api.getOwnContact(userID, contactID); err != nil {
+		return nil, err
+	}
 
-	if err != nil && db.IsNoRowsError(err) {
-		return nil, terrors.NotFound(err, "contact not found")
-	} else if err != nil {
-		return nil, terrors.InternalServerError(err, "failed to get contact")
+	resolved, err := api.resolveAddress(address)
+
+	if err != nil {
+		return nil, err
 	}
 
-	if contact.Address != nil {
-		return nil, terrors.InvalidRequest(nil, "contact already has an address")
+	res, err := api.storage.CreateContactAddress(contactID, version, *resolved)
+
+	if err != nil && errors.Is(err, db.ErrConflict) {
+		return nil, errContactModified(err)
+	} else if err != nil {
+		return nil, terrors.InternalServerError(err, "failed to create contact address")
 	}
 
-	if contact.UserID != userID {
-		return nil, terrors.Forbidden(nil, "contact does not belong to user")
+	return res, nil
+}
+
+func (api *api) UpdateContactAddress(userID, contactID, addressID int64, version int, address CreateAddressRequest) (*db.Address, error) {
+	if _, err := api.getOwnContact(userID, contactID); err != nil {
+		return nil, err
 	}
 
-	res, err := api.storage.CreateContactAddress(contactID, address.toAddress())
+	update, err := api.resolveAddress(address)
 
 	if err != nil {
-		return nil, terrors.InternalServerError(err, "failed to create contact address")
+		return nil, err
+	}
+
+	update.ID = addressID
+
+	res, err := api.storage.UpdateContactAddress(contactID, version, *update)
+
+	if err != nil && errors.Is(err, db.ErrNotFound) {
+		return nil, terrors.NotFound(err, "address not found")
+	} else if err != nil && errors.Is(err, db.ErrConflict) {
+		return nil, errContactModified(err)
+	} else if err != nil {
+		return nil, terrors.InternalServerError(err, "failed to update contact address")
 	}
 
 	return res, nil
 }
 
-func (api *api) UpdateContactVisibility(userID, contactID int64, visibility db.ContactVisibility) error {
+func (api *api) DeleteContactAddress(userID, contactID, addressID int64, version int) error {
+	if _, err := api.getOwnContact(userID, contactID); err != nil {
+		return err
+	}
+
+	err := api.storage.DeleteContactAddress(contactID, version, addressID)
+
+	if err != nil && errors.Is(err, db.ErrNotFound) {
+		return terrors.NotFound(err, "address not found")
+	} else if err != nil && errors.Is(err, db.ErrConflict) {
+		return errContactModified(err)
+	} else if err != nil {
+		return terrors.InternalServerError(err, "failed to delete contact address")
+	}
+
+	return nil
+}
+
+func (api *api) UpdateContactVisibility(userID, contactID int64, version int, visibility db.ContactVisibility) error {
 	if !visibility.IsValid() {
 		return terrors.InvalidRequest(nil, "invalid visibility value")
 	}
 
-	if err := api.storage.UpdateContactVisibility(userID, contactID, visibility); err != nil {
+	err := api.storage.UpdateContactVisibility(userID, contactID, version, visibility)
+
+	if err != nil && errors.Is(err, db.ErrNotFound) {
+		return terrors.NotFound(err, "contact not found")
+	} else if err != nil && errors.Is(err, db.ErrConflict) {
+		return errContactModified(err)
+	} else if err != nil {
 		return terrors.InternalServerError(err, "failed to update contact visibility")
 	}
 
 	return nil
 }
 
+// errContactModified is returned when an edit was based on an outdated
+// version of the contact.
+func errContactModified(err error) error {
+	return terrors.PreconditionFailed(err, "contact has been modified")
+}
+
 func (api *api) ListMyContacts(userID int64) (db.ContactsPage, error) {
 	contacts, err := api.storage.GetContactsByUserID(userID)
 
@@ -263,3 +529,20 @@ func (api *api) ListMyContacts(userID int64) (db.ContactsPage, error) {
 
 	return contacts, nil
 }
+
+// getOwnContact returns the contact if it exists and belongs to the user.
+func (api *api) getOwnContact(userID, contactID int64) (*db.Contact, error) {
+	contact, err := api.storage.GetContact(userID, contactID)
+
+	if err != nil && errors.Is(err, db.ErrNotFound) {
+		return nil, terrors.NotFound(err, "contact not found")
+	} else if err != nil {
+		return nil, terrors.InternalServerError(err, "failed to get contact")
+	}
+
+	if contact.UserID != userID {
+		return nil, terrors.Forbidden(nil, "contact does not belong to user")
+	}
+
+	return contact, nil
+}
@@ -0,0 +1,173 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"touchly/internal/db"
+	"touchly/internal/services"
+	"touchly/internal/terrors"
+)
+
+func (api *api) Geocode(query string) (*services.Place, error) {
+	if query = strings.TrimSpace(query); query == "" {
+		return nil, terrors.InvalidRequest(nil, "q is required")
+	}
+
+	place, err := api.geocoder.Geocode(query)
+
+	if err != nil && errors.Is(err, services.ErrPlaceNotFound) {
+		return nil, terrors.NotFound(err, "place not found")
+	} else if err != nil && errors.Is(err, services.ErrGeocoderBusy) {
+		return nil, errGeocoderBusy(err)
+	} else if err != nil {
+		return nil, terrors.InternalServerError(err, "failed to geocode address")
+	}
+
+	return place, nil
+}
+
+func (api *api) ReverseGeocode(lat, lng float64) (*services.Place, error) {
+	if lat < -90 || lat > 90 || lng < -180 || lng > 180 {
+		return nil, terrors.InvalidRequest(nil, "lat or lng is out of range")
+	}
+
+	place, err := api.geocoder.Reverse(lat, lng)
+
+	if err != nil && errors.Is(err, services.ErrPlaceNotFound) {
+		return nil, terrors.NotFound(err, "place not found")
+	} else if err != nil && errors.Is(err, services.ErrGeocoderBusy) {
+		return nil, errGeocoderBusy(err)
+	} else if err != nil {
+		return nil, terrors.InternalServerError(err, "failed to geocode location")
+	}
+
+	return place, nil
+}
+
+// resolveAddress completes the address with geocoding: coordinates are
+// looked up by name when missing, and the name and address components by
+// coordinates when the name is empty.
+func (api *api) resolveAddress(request CreateAddressRequest) (*db.Address, error) {
+	address := request.toAddress()
+
+	if request.hasLocation() && request.Name != "" {
+		return &address, nil
+	}
+
+	var place *services.Place
+	var err error
+
+	if request.hasLocation() {
+		place, err = api.geocoder.Reverse(*request.Lat, *request.Lng)
+	} else if request.Name != "" {
+		place, err = api.geocoder.Geocode(request.Name)
+	} else {
+		return nil, terrors.InvalidRequest(nil, "address requires a name or lat and lng")
+	}
+
+	if err != nil && errors.Is(err, services.ErrPlaceNotFound) {
+		return nil, terrors.InvalidRequest(err, "address not found")
+	} else if err != nil && errors.Is(err, services.ErrGeocoderBusy) {
+		return nil, errGeocoderBusy(err)
+	} else if err != nil {
+		return nil, terrors.InternalServerError(err, "failed to geocode address")
+	}
+
+	if !request.hasLocation() {
+		address.Location = db.Point{Lat: place.Lat, Lng: place.Lng}
+	}
+
+	fillAddress(&address, place)
+
+	return &address, nil
+}
+
+func errGeocoderBusy(err error) error {
+	return terrors.TooManyRequests(err, "too many geocoding requests, try again later")
+}
+
+// fillAddress sets the name, external id and address components the address
+// does not have from the geocoded place.
+func fillAddress(address *db.Address, place *services.Place) {
+	if address.Name == "" {
+		address.Name = place.Name
+	}
+
+	if address.ExternalID == nil && place.ExternalID != "" {
+		address.ExternalID = &place.ExternalID
+	}
+
+	// components sent by the client win over the geocoded ones
+	if address.Street == nil {
+		address.Street = place.Street
+	}
+
+	if address.HouseNumber == nil {
+		address.HouseNumber = place.HouseNumber
+	}
+
+	if address.City == nil {
+		address.City = place.City
+	}
+
+	if address.Postcode == nil {
+		address.Postcode = place.Postcode
+	}
+
+	if address.Country == nil {
+		address.Country = place.Country
+	}
+
+	if address.CountryCode == nil {
+		address.CountryCode = place.CountryCode
+	}
+}
+
+// RunAddressGeocoding geocodes imported addresses until ctx is cancelled. A
+// single address is geocoded per interval to stay within the rate limit of
+// the geocoder, e.g. one request per second for the public Nominatim.
+func (api *api) RunAddressGeocoding(ctx context.Context) {
+	ticker := time.NewTicker(api.cfg.Geocoder.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := api.GeocodePendingAddress(); err != nil {
+			api.logger.Printf("address geocoding: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// GeocodePendingAddress geocodes the imported address waiting the longest by
+// its name. Addresses the geocoder can not find are kept without a location,
+// ones failing for another reason are retried later.
+func (api *api) GeocodePendingAddress() error {
+	address, err := api.storage.ClaimPendingAddress()
+
+	if err != nil && errors.Is(err, db.ErrNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	place, err := api.geocoder.Geocode(address.Name)
+
+	if err != nil && errors.Is(err, services.ErrPlaceNotFound) {
+		return api.storage.SetAddressGeocoded(*address, false)
+	} else if err != nil {
+		return fmt.Errorf("address %d: %w", address.ID, err)
+	}
+
+	address.Location = db.Point{Lat: place.Lat, Lng: place.Lng}
+	fillAddress(address, place)
+
+	return api.storage.SetAddressGeocoded(*address, true)
+}
@@ -0,0 +1,410 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"touchly/internal/db"
+	"touchly/internal/terrors"
+	"touchly/internal/vcard"
+)
+
+// maxImportCards limits the number of cards accepted in a single import.
+const maxImportCards = 1000
+
+type ImportResult struct {
+	Line      int      `json:"line"`
+	Name      string   `json:"name,omitempty"`
+	Success   bool     `json:"success"`
+	ContactID *int64   `json:"contact_id,omitempty"`
+	Error     string   `json:"error,omitempty"`
+	Warnings  []string `json:"warnings,omitempty"`
+} // @Name ImportResult
+
+type ImportContactsResponse struct {
+	Imported int            `json:"imported"`
+	Failed   int            `json:"failed"`
+	Results  []ImportResult `json:"results"`
+} // @Name ImportContactsResponse
+
+func (api *api) ImportContacts(userID int64, r io.Reader) (*ImportContactsResponse, error) {
+	cards, err := vcard.Decode(r)
+
+	if err != nil {
+		return nil, terrors.InvalidRequest(err, "failed to read vCard file")
+	}
+
+	if len(cards) == 0 {
+		return nil, terrors.InvalidRequest(nil, "no vCards found")
+	}
+
+	if len(cards) > maxImportCards {
+		return nil, terrors.InvalidRequest(nil, fmt.Sprintf("too many vCards, at most %d are allowed", maxImportCards))
+	}
+
+	tags, err := api.storage.ListTags(userID)
+
+	if err != nil {
+		return nil, terrors.InternalServerError(err, "failed to list tags")
+	}
+
+	tagsByName := make(map[string]db.Tag, len(tags))
+	for _, tag := range tags {
+		tagsByName[strings.ToLower(tag.Name)] = tag
+	}
+
+	// categories matching no tag name are looked up by slugs and synonyms
+	for _, tag := range tags {
+		for _, name := range append([]string{tag.Slug}, tag.Synonyms...) {
+			if _, ok := tagsByName[strings.ToLower(name)]; !ok {
+				tagsByName[strings.ToLower(name)] = tag
+			}
+		}
+	}
+
+	res := &ImportContactsResponse{Results: make([]ImportResult, 0, len(cards))}
+
+	for _, card := range cards {
+		result := ImportResult{Line: card.Line}
+
+		if card.Err != nil {
+			result.Error = card.Err.Error()
+			res.Failed++
+			res.Results = append(res.Results, result)
+			continue
+		}
+
+		request, warnings := cardToContactRequest(card, tagsByName)
+		result.Warnings = warnings
+
+		if request.Name == nil || *request.Name == "" {
+			result.Error = "card has no name"
+			res.Failed++
+			res.Results = append(res.Results, result)
+			continue
+		}
+
+		result.Name = *request.Name
+
+		toCreate := request.toContact()
+
+		// geocoding inline would exceed the rate limit of the geocoder on
+		// large files, addresses without GEO are geocoded in the background
+		for _, address := range request.addresses() {
+			toCreate.Addresses = append(toCreate.Addresses, address.toImportedAddress())
+		}
+
+		contact, err := api.storage.CreateContact(userID, toCreate, request.Tags, request.SocialLinks)
+
+		if err != nil {
+			result.Error = "failed to create contact"
+			res.Failed++
+			res.Results = append(res.Results, result)
+			continue
+		}
+
+		result.Success = true
+		result.ContactID = &contact.ID
+		res.Imported++
+		res.Results = append(res.Results, result)
+	}
+
+	return res, nil
+}
+
+func cardToContactRequest(card vcard.Card, tagsByName map[string]db.Tag) (CreateContactRequest, []string) {
+	var request CreateContactRequest
+	var warnings []string
+
+	if fn, ok := card.Get("FN"); ok && strings.TrimSpace(fn.Text()) != "" {
+		request.Name = ptr(strings.TrimSpace(fn.Text()))
+	} else if n, ok := card.Get("N"); ok {
+		// N components: family; given; additional; prefixes; suffixes
+		parts := n.Components()
+		var names []string
+
+		for _, i := range []int{3, 1, 2, 0, 4} {
+			if i < len(parts) && strings.TrimSpace(parts[i]) != "" {
+				names = append(names, strings.TrimSpace(parts[i]))
+			}
+		}
+
+		if len(names) > 0 {
+			request.Name = ptr(strings.Join(names, " "))
+		}
+	}
+
+	if org, ok := card.Get("ORG"); ok {
+		if parts := org.Components(); parts[0] != "" {
+			request.ActivityName = ptr(parts[0])
+		}
+	}
+
+	if note, ok := card.Get("NOTE"); ok && note.Text() != "" {
+		request.About = ptr(note.Text())
+	}
+
+	if tels := card.All("TEL"); len(tels) > 0 {
+		code, number := splitPhoneNumber(strings.TrimPrefix(tels[0].Text(), "tel:"))
+		request.PhoneNumber = ptr(number)
+
+		if code != "" {
+			request.PhoneCallingCode = ptr(code)
+		}
+	}
+
+	if email, ok := card.Get("EMAIL"); ok && email.Text() != "" {
+		request.Email = ptr(strings.TrimPrefix(email.Text(), "mailto:"))
+	}
+
+	if photo, ok := card.Get("PHOTO"); ok {
+		if isHTTPURL(photo.Value) {
+			request.Avatar = ptr(photo.Value)
+		} else {
+			warnings = append(warnings, "embedded photos are not supported")
+		}
+	}
+
+	links := make([]db.Link, 0)
+
+	for _, u := range card.All("URL") {
+		value := u.Text()
+		linkType := socialLinkType(u)
+
+		if linkType == "" && request.Website == nil {
+			request.Website = ptr(value)
+			continue
+		}
+
+		if linkType == "" {
+			linkType = "website"
+		}
+
+		links = append(links, db.Link{Type: linkType, Link: value})
+	}
+
+	for _, p := range card.All("X-SOCIALPROFILE") {
+		linkType := socialLinkType(p)
+		if linkType == "" {
+			linkType = "website"
+		}
+
+		links = append(links, db.Link{Type: linkType, Link: p.Text()})
+	}
+
+	if len(links) > 0 {
+		request.SocialLinks = &links
+	}
+
+	adrs := card.All("ADR")
+
+	// vCard 3.0 has a single GEO per card, it belongs to the preferred
+	// address or the only one
+	cardGeo := ""
+	if p, ok := card.Get("GEO"); ok {
+		cardGeo = p.Value
+	}
+
+	for i, adr := range adrs {
+		geo := ""
+		if adr.HasType("pref") || adr.Param("PREF") == "1" || (len(adrs) == 1 && i == 0) {
+			geo = cardGeo
+		}
+
+		address, err := cardAddress(adr, geo)
+
+		if err != nil {
+			warnings = append(warnings, err.Error())
+			continue
+		}
+
+		request.Addresses = append(request.Addresses, *address)
+	}
+
+	var tags []db.Tag
+
+	for _, p := range card.All("CATEGORIES") {
+		for _, name := range p.List() {
+			tag, ok := tagsByName[strings.ToLower(name)]
+
+			if !ok {
+				warnings = append(warnings, fmt.Sprintf("unknown category %q", name))
+				continue
+			}
+
+			tags = append(tags, tag)
+		}
+	}
+
+	if len(tags) > 0 {
+		request.Tags = &tags
+	}
+
+	return request, warnings
+}
+
+// cardAddress converts an ADR property, cardGeo is the card's GEO property
+// value used when the ADR has no GEO parameter. Addresses without
+// coordinates are geocoded in the background after import.
+func cardAddress(adr vcard.Property, cardGeo string) (*CreateAddressRequest, error) {
+	// ADR components: PO box; extended address; street; locality; region; postal code; country
+	components := adr.Components()
+	var parts []string
+	for _, part := range components {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+
+	name := strings.Join(parts, ", ")
+	if label := adr.Param("LABEL"); label != "" {
+		name = label
+	}
+
+	if name == "" {
+		return nil, fmt.Errorf("address is empty")
+	}
+
+	label := "work"
+	for _, t := range adr.Params["TYPE"] {
+		if !strings.EqualFold(t, "pref") {
+			label = strings.ToLower(t)
+			break
+		}
+	}
+
+	component := func(i int) *string {
+		if i < len(components) && strings.TrimSpace(components[i]) != "" {
+			return ptr(strings.TrimSpace(components[i]))
+		}
+
+		return nil
+	}
+
+	request := &CreateAddressRequest{
+		Label:     label,
+		Name:      name,
+		Street:    component(2),
+		City:      component(3),
+		Postcode:  component(5),
+		Country:   component(6),
+		IsPrimary: adr.HasType("pref") || adr.Param("PREF") == "1",
+	}
+
+	geo := adr.Param("GEO")
+	if geo == "" {
+		geo = cardGeo
+	}
+
+	if lat, lng, ok := parseGeo(geo); ok {
+		request.Lat = &lat
+		request.Lng = &lng
+	}
+
+	return request, nil
+}
+
+// parseGeo parses both vCard 3.0 "lat;lng" and vCard 4.0 "geo:lat,lng" values.
+func parseGeo(value string) (float64, float64, bool) {
+	value = strings.TrimPrefix(strings.TrimSpace(value), "geo:")
+
+	if i := strings.Index(value, ";"); i >= 0 && strings.Contains(value, ",") {
+		// geo URI parameters, e.g. geo:1,2;u=35
+		value = value[:i]
+	}
+
+	sep := ","
+	if !strings.Contains(value, ",") {
+		sep = ";"
+	}
+
+	latStr, lngStr, found := strings.Cut(value, sep)
+
+	if !found {
+		return 0, 0, false
+	}
+
+	lat, err := strconv.ParseFloat(strings.TrimSpace(latStr), 64)
+	if err != nil || lat < -90 || lat > 90 {
+		return 0, 0, false
+	}
+
+	lng, err := strconv.ParseFloat(strings.TrimSpace(lngStr), 64)
+	if err != nil || lng < -180 || lng > 180 {
+		return 0, 0, false
+	}
+
+	return lat, lng, true
+}
+
+// splitPhoneNumber separates an international calling code such as "+1"
+// from the rest of the number when the two are delimited.
+func splitPhoneNumber(phone string) (string, string) {
+	phone = strings.TrimSpace(phone)
+
+	if !strings.HasPrefix(phone, "+") {
+		return "", phone
+	}
+
+	i := strings.IndexAny(phone, " -(")
+
+	if i < 2 || i > 4 {
+		return "", phone
+	}
+
+	return phone[:i], strings.TrimLeft(phone[i:], " -")
+}
+
+var socialHosts = map[string]string{
+	"twitter.com":   "twitter",
+	"x.com":         "twitter",
+	"facebook.com":  "facebook",
+	"instagram.com": "instagram",
+	"linkedin.com":  "linkedin",
+	"t.me":          "telegram",
+	"github.com":    "github",
+	"youtube.com":   "youtube",
+	"tiktok.com":    "tiktok",
+}
+
+var nonSocialTypes = map[string]bool{
+	"work": true, "home": true, "pref": true, "internet": true, "x-socialprofile": true,
+}
+
+// socialLinkType guesses the social network of a URL property from its TYPE
+// parameter or its host, returning an empty string for plain websites.
+func socialLinkType(p vcard.Property) string {
+	for _, t := range p.Params["TYPE"] {
+		if t = strings.ToLower(t); !nonSocialTypes[t] {
+			return t
+		}
+	}
+
+	u, err := url.Parse(p.Text())
+	if err != nil {
+		return ""
+	}
+
+	return socialHosts[strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")]
+}
+
+func isHTTPURL(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
+
+// errorMessage returns the message of err meant for the client.
+func errorMessage(err error) string {
+	var terror *terrors.Error
+	if errors.As(err, &terror) {
+		return terror.Message
+	}
+
+	return err.Error()
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"context"
+	"time"
+	"touchly/internal/db"
+	"touchly/internal/services"
+)
+
+// outboxLease is how long a claimed email stays hidden from other workers
+// while it is being delivered.
+const outboxLease = 5 * time.Minute
+
+// RunEmailOutbox delivers queued emails until ctx is cancelled.
+func (api *api) RunEmailOutbox(ctx context.Context) {
+	ticker := time.NewTicker(api.cfg.Outbox.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			delivered, err := api.DeliverOutboxEmails()
+
+			if err != nil {
+				api.logger.Printf("email outbox: %v", err)
+				break
+			}
+
+			// keep going while there are full batches waiting
+			if delivered < api.cfg.Outbox.BatchSize || ctx.Err() != nil {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DeliverOutboxEmails sends one batch of due emails and returns how many were
+// claimed.
+func (api *api) DeliverOutboxEmails() (int, error) {
+	emails, err := api.storage.ClaimOutboxEmails(api.cfg.Outbox.BatchSize, outboxLease)
+
+	if err != nil {
+		return 0, err
+	}
+
+	for _, email := range emails {
+		api.deliverOutboxEmail(email)
+	}
+
+	return len(emails), nil
+}
+
+func (api *api) deliverOutboxEmail(email db.OutboxEmail) {
+	message := &services.MailMessage{
+		From:          email.Sender,
+		To:            email.Recipient,
+		Subject:       email.Subject,
+		HtmlBody:      email.HtmlBody,
+		TextBody:      email.TextBody,
+		MessageStream: email.MessageStream,
+	}
+
+	sendErr := api.emailClient.SendEmail(message)
+
+	var err error
+
+	switch {
+	case sendErr == nil:
+		err = api.storage.MarkOutboxEmailSent(email.ID)
+	case email.Attempts >= api.cfg.Outbox.MaxAttempts:
+		api.logger.Printf("email outbox: giving up on email %d after %d attempts: %v", email.ID, email.Attempts, sendErr)
+		err = api.storage.DeadLetterOutboxEmail(email.ID, sendErr.Error())
+	default:
+		err = api.storage.RetryOutboxEmail(email.ID, sendErr.Error(), api.outboxBackoff(email.Attempts))
+	}
+
+	if err != nil {
+		api.logger.Printf("email outbox: failed to update email %d: %v", email.ID, err)
+	}
+}
+
+// outboxBackoff returns the delay before the next delivery attempt, doubling
+// with every failed attempt.
+func (api *api) outboxBackoff(attempts int) time.Duration {
+	delay := api.cfg.Outbox.MinBackoff
+
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+
+		if delay >= api.cfg.Outbox.MaxBackoff {
+			return api.cfg.Outbox.MaxBackoff
+		}
+	}
+
+	return delay
+}
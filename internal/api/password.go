@@ -0,0 +1,111 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+	"touchly/internal/db"
+	"touchly/internal/terrors"
+)
+
+// passwordResetTTL is how long an emailed reset link stays valid.
+const passwordResetTTL = time.Hour
+
+// ForgotPassword emails a single-use reset link to the user. It succeeds for
+// unknown emails too, so the endpoint cannot be used to probe for accounts.
+// For the same reason requests over the resend cooldown or the hourly cap
+// succeed without sending a link.
+func (api *api) ForgotPassword(email string) error {
+	if email == "" {
+		return terrors.InvalidRequest(nil, "email is required")
+	}
+
+	user, err := api.storage.GetUserByEmail(email)
+
+	if err != nil && errors.Is(err, db.ErrNotFound) {
+		return nil
+	} else if err != nil {
+		return terrors.InternalServerError(err, "failed to get user")
+	}
+
+	recent, err := api.storage.CountPasswordResetsSince(user.ID, api.cfg.PasswordReset.ResendCooldown)
+
+	if err != nil {
+		return terrors.InternalServerError(err, "failed to count password resets")
+	}
+
+	if recent > 0 {
+		return nil
+	}
+
+	recent, err = api.storage.CountPasswordResetsSince(user.ID, time.Hour)
+
+	if err != nil {
+		return terrors.InternalServerError(err, "failed to count password resets")
+	}
+
+	if recent >= api.cfg.PasswordReset.MaxSendsPerHour {
+		return nil
+	}
+
+	token, err := generateSecureToken(32)
+
+	if err != nil {
+		return terrors.InternalServerError(err, "failed to generate token")
+	}
+
+	reset := db.PasswordReset{
+		UserID:    user.ID,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(passwordResetTTL),
+	}
+
+	language := ""
+	if user.Language != nil {
+		language = *user.Language
+	}
+
+	data := struct {
+		ResetURL         string
+		ExpiresInMinutes int
+	}{
+		ResetURL:         fmt.Sprintf("%s/reset-password?token=%s", api.cfg.WebURL, url.QueryEscape(token)),
+		ExpiresInMinutes: int(passwordResetTTL.Minutes()),
+	}
+
+	message, err := api.renderEmail(user.Email, language, "password_reset", data, passwordResetTTL)
+
+	if err != nil {
+		return terrors.InternalServerError(err, "failed to render password reset email")
+	}
+
+	if _, err := api.storage.CreatePasswordReset(reset, *message); err != nil {
+		return terrors.InternalServerError(err, "failed to create password reset")
+	}
+
+	return nil
+}
+
+// ResetPassword sets a new password using a token from ForgotPassword and
+// signs the user out everywhere.
+func (api *api) ResetPassword(token, password string) error {
+	if token == "" || password == "" {
+		return terrors.InvalidRequest(nil, "token and password are required")
+	}
+
+	hashedPassword, err := hashPassword(password)
+	if err != nil {
+		return terrors.InternalServerError(err, "failed to hash password")
+	}
+
+	_, err = api.storage.ResetPassword(hashToken(token), hashedPassword)
+
+	if err != nil && errors.Is(err, db.ErrNotFound) {
+		return terrors.InvalidRequest(err, "reset link is invalid or expired")
+	} else if err != nil {
+		return terrors.InternalServerError(err, "failed to reset password")
+	}
+
+	return nil
+}
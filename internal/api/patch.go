@@ -0,0 +1,497 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-playground/validator"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"touchly/internal/db"
+	"touchly/internal/terrors"
+)
+
+const (
+	// MergePatchContentType is a JSON Merge Patch, RFC 7386.
+	MergePatchContentType = "application/merge-patch+json"
+	// JSONPatchContentType is a JSON Patch, RFC 6902.
+	JSONPatchContentType = "application/json-patch+json"
+)
+
+// contactDocument is the editable part of a contact that patches are
+// applied to. Null or removed fields are cleared.
+type contactDocument struct {
+	Name             string    `json:"name" validate:"required,max=255"`
+	Avatar           *string   `json:"avatar" validate:"omitempty,max=255"`
+	ActivityName     *string   `json:"activity_name"`
+	Website          *string   `json:"website" validate:"omitempty,max=255"`
+	CountryCode      *string   `json:"country_code" validate:"omitempty,max=10"`
+	About            *string   `json:"about"`
+	PhoneNumber      *string   `json:"phone_number" validate:"omitempty,max=50"`
+	PhoneCallingCode *string   `json:"phone_calling_code" validate:"omitempty,max=10"`
+	Email            *string   `json:"email" validate:"omitempty,email,max=255"`
+	Tags             []db.Tag  `json:"tags"`
+	SocialLinks      []db.Link `json:"social_links"`
+}
+
+func newContactDocument(c db.Contact) contactDocument {
+	return contactDocument{
+		Name:             c.Name,
+		Avatar:           c.Avatar,
+		ActivityName:     c.ActivityName,
+		Website:          c.Website,
+		CountryCode:      c.CountryCode,
+		About:            c.About,
+		PhoneNumber:      c.PhoneNumber,
+		PhoneCallingCode: c.PhoneCallingCode,
+		Email:            c.Email,
+		Tags:             c.Tags,
+		SocialLinks:      c.SocialLinks,
+	}
+}
+
+// columns returns the document fields by the contact column they are
+// stored in.
+func (d contactDocument) columns() map[string]*string {
+	return map[string]*string{
+		"name":               &d.Name,
+		"avatar":             d.Avatar,
+		"activity_name":      d.ActivityName,
+		"website":            d.Website,
+		"country_code":       d.CountryCode,
+		"about":              d.About,
+		"phone_number":       d.PhoneNumber,
+		"phone_calling_code": d.PhoneCallingCode,
+		"email":              d.Email,
+	}
+}
+
+var documentValidator = newDocumentValidator()
+
+func newDocumentValidator() *validator.Validate {
+	v := validator.New()
+
+	// report fields by their json names
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		return name
+	})
+
+	return v
+}
+
+func (d contactDocument) validate() error {
+	var problems []string
+
+	var errs validator.ValidationErrors
+	if err := documentValidator.Struct(d); errors.As(err, &errs) {
+		for _, e := range errs {
+			problems = append(problems, fmt.Sprintf("%s failed on %s", e.Field(), e.Tag()))
+		}
+	} else if err != nil {
+		return err
+	}
+
+	for i, tag := range d.Tags {
+		if tag.ID == 0 {
+			problems = append(problems, fmt.Sprintf("tags/%d/id is required", i))
+		}
+	}
+
+	for i, link := range d.SocialLinks {
+		if link.Type == "" {
+			problems = append(problems, fmt.Sprintf("social_links/%d/type is required", i))
+		}
+
+		if link.Link == "" {
+			problems = append(problems, fmt.Sprintf("social_links/%d/link is required", i))
+		}
+	}
+
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, ", "))
+	}
+
+	return nil
+}
+
+// PatchContact applies a JSON Merge Patch or a JSON Patch, depending on
+// contentType, to the contact if it is still at version.
+func (api *api) PatchContact(userID, contactID int64, version int, contentType string, patch []byte) (*db.Contact, error) {
+	contact, err := api.getOwnContact(userID, contactID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	current := newContactDocument(*contact)
+
+	var doc interface{}
+	if err = roundTrip(current, &doc); err != nil {
+		return nil, terrors.InternalServerError(err, "failed to patch contact")
+	}
+
+	switch contentType {
+	case MergePatchContentType:
+		var mergePatch interface{}
+		if err = json.Unmarshal(patch, &mergePatch); err != nil {
+			return nil, terrors.InvalidRequest(err, "invalid merge patch")
+		}
+
+		doc = applyMergePatch(doc, mergePatch)
+	case JSONPatchContentType:
+		var ops []patchOperation
+		if err = json.Unmarshal(patch, &ops); err != nil {
+			return nil, terrors.InvalidRequest(err, "invalid json patch")
+		}
+
+		if doc, err = applyJSONPatch(doc, ops); err != nil {
+			return nil, terrors.InvalidRequest(err, err.Error())
+		}
+	default:
+		return nil, terrors.InvalidRequest(nil, "unsupported patch type "+contentType)
+	}
+
+	var patched contactDocument
+
+	data, err := json.Marshal(doc)
+
+	if err != nil {
+		return nil, terrors.InternalServerError(err, "failed to patch contact")
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	if err = decoder.Decode(&patched); err != nil {
+		return nil, terrors.InvalidRequest(err, "invalid contact: "+err.Error())
+	}
+
+	if err = patched.validate(); err != nil {
+		return nil, terrors.InvalidRequest(err, "invalid contact: "+err.Error())
+	}
+
+	// tags are a set, adding one the contact already has is a no-op
+	seen := make(map[int64]bool)
+	patched.Tags = slices.DeleteFunc(patched.Tags, func(tag db.Tag) bool {
+		duplicate := seen[tag.ID]
+		seen[tag.ID] = true
+		return duplicate
+	})
+
+	updates := map[string]interface{}{}
+	currentColumns := current.columns()
+
+	for column, value := range patched.columns() {
+		if old := currentColumns[column]; (old == nil) != (value == nil) || (old != nil && *old != *value) {
+			updates[column] = value
+		}
+	}
+
+	var tags *[]db.Tag
+	if !sameJSON(current.Tags, patched.Tags) {
+		tags = ptr(nonNil(patched.Tags))
+	}
+
+	var links *[]db.Link
+	if !sameJSON(current.SocialLinks, patched.SocialLinks) {
+		links = ptr(nonNil(patched.SocialLinks))
+	}
+
+	res, err := api.storage.UpdateContact(userID, contactID, version, tags, links, updates)
+
+	if err != nil && errors.Is(err, db.ErrNotFound) {
+		return nil, terrors.NotFound(err, "contact not found")
+	} else if err != nil && errors.Is(err, db.ErrConflict) {
+		return nil, errContactModified(err)
+	} else if err != nil {
+		return nil, terrors.InternalServerError(err, "failed to update contact")
+	}
+
+	return res, nil
+}
+
+// applyMergePatch implements RFC 7386, null members of the patch remove
+// members of the target.
+func applyMergePatch(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = map[string]interface{}{}
+	}
+
+	for key, value := range p {
+		if value == nil {
+			delete(t, key)
+		} else {
+			t[key] = applyMergePatch(t[key], value)
+		}
+	}
+
+	return t
+}
+
+type patchOperation struct {
+	Op   string `json:"op"`
+	Path string `json:"path"`
+	From string `json:"from"`
+	// Value is nil when it is missing, a null value is kept as "null".
+	Value json.RawMessage `json:"value"`
+}
+
+// applyJSONPatch implements RFC 6902. The operations are applied in order
+// and the patch fails as a whole if any of them fails.
+func applyJSONPatch(doc interface{}, ops []patchOperation) (interface{}, error) {
+	for i, op := range ops {
+		var err error
+
+		if doc, err = applyPatchOperation(doc, op); err != nil {
+			return nil, fmt.Errorf("operation %d (%s %s): %w", i, op.Op, op.Path, err)
+		}
+	}
+
+	return doc, nil
+}
+
+func applyPatchOperation(doc interface{}, op patchOperation) (interface{}, error) {
+	path, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var value interface{}
+
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return nil, errors.New("value is required")
+		}
+
+		if err = json.Unmarshal(op.Value, &value); err != nil {
+			return nil, err
+		}
+	case "move", "copy":
+		from, err := parsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+
+		if value, err = getAt(doc, from); err != nil {
+			return nil, err
+		}
+
+		if op.Op == "move" {
+			if isPrefix(from, path) && len(from) < len(path) {
+				return nil, errors.New("cannot move a value into itself")
+			}
+
+			if doc, err = removeAt(doc, from); err != nil {
+				return nil, err
+			}
+		} else if err = roundTrip(value, &value); err != nil {
+			return nil, err
+		}
+	}
+
+	switch op.Op {
+	case "add", "move", "copy":
+		return addAt(doc, path, value)
+	case "remove":
+		return removeAt(doc, path)
+	case "replace":
+		if _, err = getAt(doc, path); err != nil {
+			return nil, err
+		}
+
+		if doc, err = removeAt(doc, path); err != nil && len(path) > 0 {
+			return nil, err
+		}
+
+		return addAt(doc, path, value)
+	case "test":
+		actual, err := getAt(doc, path)
+		if err != nil {
+			return nil, err
+		}
+
+		if !reflect.DeepEqual(actual, value) {
+			return nil, errors.New("test failed")
+		}
+
+		return doc, nil
+	}
+
+	return nil, fmt.Errorf("unknown operation %q", op.Op)
+}
+
+// parsePointer splits a JSON Pointer, RFC 6901, into reference tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid path %q", pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+
+	return tokens, nil
+}
+
+func isPrefix(prefix, path []string) bool {
+	return len(prefix) <= len(path) && slices.Equal(prefix, path[:len(prefix)])
+}
+
+// arrayIndex parses an array index token, allowing indexes up to max.
+func arrayIndex(token string, max int) (int, error) {
+	i, err := strconv.Atoi(token)
+
+	if err != nil || i < 0 || i > max || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+
+	return i, nil
+}
+
+func getAt(doc interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			value, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("member %q not found", token)
+			}
+
+			doc = value
+		case []interface{}:
+			i, err := arrayIndex(token, len(node)-1)
+			if err != nil {
+				return nil, err
+			}
+
+			doc = node[i]
+		default:
+			return nil, fmt.Errorf("cannot traverse %q", token)
+		}
+	}
+
+	return doc, nil
+}
+
+// updateAt calls fn with the parent of the value at path and its key, and
+// returns the document with the parent replaced by what fn returns.
+func updateAt(doc interface{}, path []string, fn func(parent interface{}, key string) (interface{}, error)) (interface{}, error) {
+	if len(path) == 1 {
+		return fn(doc, path[0])
+	}
+
+	child, err := getAt(doc, path[:1])
+	if err != nil {
+		return nil, err
+	}
+
+	updated, err := updateAt(child, path[1:], fn)
+	if err != nil {
+		return nil, err
+	}
+
+	switch node := doc.(type) {
+	case map[string]interface{}:
+		node[path[0]] = updated
+	case []interface{}:
+		i, _ := arrayIndex(path[0], len(node)-1)
+		node[i] = updated
+	}
+
+	return doc, nil
+}
+
+func addAt(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	return updateAt(doc, path, func(parent interface{}, key string) (interface{}, error) {
+		switch node := parent.(type) {
+		case map[string]interface{}:
+			node[key] = value
+			return node, nil
+		case []interface{}:
+			if key == "-" {
+				return append(node, value), nil
+			}
+
+			i, err := arrayIndex(key, len(node))
+			if err != nil {
+				return nil, err
+			}
+
+			return slices.Insert(node, i, value), nil
+		}
+
+		return nil, fmt.Errorf("cannot add %q", key)
+	})
+}
+
+func removeAt(doc interface{}, path []string) (interface{}, error) {
+	if len(path) == 0 {
+		return nil, errors.New("cannot remove the whole document")
+	}
+
+	return updateAt(doc, path, func(parent interface{}, key string) (interface{}, error) {
+		switch node := parent.(type) {
+		case map[string]interface{}:
+			if _, ok := node[key]; !ok {
+				return nil, fmt.Errorf("member %q not found", key)
+			}
+
+			delete(node, key)
+			return node, nil
+		case []interface{}:
+			i, err := arrayIndex(key, len(node)-1)
+			if err != nil {
+				return nil, err
+			}
+
+			return slices.Delete(node, i, i+1), nil
+		}
+
+		return nil, fmt.Errorf("cannot remove %q", key)
+	})
+}
+
+// roundTrip copies src into dst through its JSON encoding.
+func roundTrip(src, dst interface{}) error {
+	data, err := json.Marshal(src)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, dst)
+}
+
+func sameJSON(a, b interface{}) bool {
+	dataA, errA := json.Marshal(a)
+	dataB, errB := json.Marshal(b)
+
+	return errA == nil && errB == nil && bytes.Equal(dataA, dataB)
+}
+
+func nonNil[T any](s []T) []T {
+	if s == nil {
+		return []T{}
+	}
+
+	return s
+}
@@ -0,0 +1,318 @@
+package api
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func decodeJSON(t *testing.T, data string) interface{} {
+	t.Helper()
+
+	var v interface{}
+	if err := json.Unmarshal([]byte(data), &v); err != nil {
+		t.Fatalf("invalid test JSON %s: %v", data, err)
+	}
+
+	return v
+}
+
+func TestApplyJSONPatch(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		ops  string
+		// want is empty when the patch must fail
+		want string
+	}{
+		{
+			name: "add a member",
+			doc:  `{"name": "John"}`,
+			ops:  `[{"op": "add", "path": "/about", "value": "baker"}]`,
+			want: `{"name": "John", "about": "baker"}`,
+		},
+		{
+			name: "add a null member",
+			doc:  `{"name": "John"}`,
+			ops:  `[{"op": "add", "path": "/about", "value": null}]`,
+			want: `{"name": "John", "about": null}`,
+		},
+		{
+			name: "add without a value",
+			doc:  `{"name": "John"}`,
+			ops:  `[{"op": "add", "path": "/about"}]`,
+		},
+		{
+			name: "append to an array",
+			doc:  `{"tags": [{"id": 1}]}`,
+			ops:  `[{"op": "add", "path": "/tags/-", "value": {"id": 2}}]`,
+			want: `{"tags": [{"id": 1}, {"id": 2}]}`,
+		},
+		{
+			name: "insert into an array",
+			doc:  `{"tags": [{"id": 1}, {"id": 3}]}`,
+			ops:  `[{"op": "add", "path": "/tags/1", "value": {"id": 2}}]`,
+			want: `{"tags": [{"id": 1}, {"id": 2}, {"id": 3}]}`,
+		},
+		{
+			name: "add right after the last element",
+			doc:  `{"tags": [{"id": 1}]}`,
+			ops:  `[{"op": "add", "path": "/tags/1", "value": {"id": 2}}]`,
+			want: `{"tags": [{"id": 1}, {"id": 2}]}`,
+		},
+		{
+			name: "add past the end of an array",
+			doc:  `{"tags": [{"id": 1}]}`,
+			ops:  `[{"op": "add", "path": "/tags/2", "value": {"id": 2}}]`,
+		},
+		{
+			name: "remove an array element",
+			doc:  `{"tags": [{"id": 1}, {"id": 2}]}`,
+			ops:  `[{"op": "remove", "path": "/tags/0"}]`,
+			want: `{"tags": [{"id": 2}]}`,
+		},
+		{
+			name: "remove an element out of range",
+			doc:  `{"tags": [{"id": 1}]}`,
+			ops:  `[{"op": "remove", "path": "/tags/1"}]`,
+		},
+		{
+			name: "remove a negative index",
+			doc:  `{"tags": [{"id": 1}]}`,
+			ops:  `[{"op": "remove", "path": "/tags/-1"}]`,
+		},
+		{
+			name: "remove an index with a leading zero",
+			doc:  `{"tags": [{"id": 1}, {"id": 2}]}`,
+			ops:  `[{"op": "remove", "path": "/tags/01"}]`,
+		},
+		{
+			name: "remove the end of an array",
+			doc:  `{"tags": [{"id": 1}]}`,
+			ops:  `[{"op": "remove", "path": "/tags/-"}]`,
+		},
+		{
+			name: "remove a missing member",
+			doc:  `{"name": "John"}`,
+			ops:  `[{"op": "remove", "path": "/about"}]`,
+		},
+		{
+			name: "remove the root",
+			doc:  `{"name": "John"}`,
+			ops:  `[{"op": "remove", "path": ""}]`,
+		},
+		{
+			name: "replace a member",
+			doc:  `{"name": "John"}`,
+			ops:  `[{"op": "replace", "path": "/name", "value": "Jane"}]`,
+			want: `{"name": "Jane"}`,
+		},
+		{
+			name: "replace a missing member",
+			doc:  `{"name": "John"}`,
+			ops:  `[{"op": "replace", "path": "/about", "value": "baker"}]`,
+		},
+		{
+			name: "replace an array element",
+			doc:  `{"tags": [{"id": 1}, {"id": 2}]}`,
+			ops:  `[{"op": "replace", "path": "/tags/1", "value": {"id": 3}}]`,
+			want: `{"tags": [{"id": 1}, {"id": 3}]}`,
+		},
+		{
+			name: "replace an element out of range",
+			doc:  `{"tags": [{"id": 1}]}`,
+			ops:  `[{"op": "replace", "path": "/tags/1", "value": {"id": 3}}]`,
+		},
+		{
+			name: "replace the root",
+			doc:  `{"name": "John", "about": "baker"}`,
+			ops:  `[{"op": "replace", "path": "", "value": {"name": "Jane"}}]`,
+			want: `{"name": "Jane"}`,
+		},
+		{
+			name: "move a member",
+			doc:  `{"name": "John", "about": "baker"}`,
+			ops:  `[{"op": "move", "from": "/about", "path": "/activity_name"}]`,
+			want: `{"name": "John", "activity_name": "baker"}`,
+		},
+		{
+			name: "move an array element to the end",
+			doc:  `{"tags": [{"id": 1}, {"id": 2}, {"id": 3}]}`,
+			ops:  `[{"op": "move", "from": "/tags/0", "path": "/tags/-"}]`,
+			want: `{"tags": [{"id": 2}, {"id": 3}, {"id": 1}]}`,
+		},
+		{
+			name: "move a value into itself",
+			doc:  `{"social_links": [{"type": "telegram"}]}`,
+			ops:  `[{"op": "move", "from": "/social_links", "path": "/social_links/0/links"}]`,
+		},
+		{
+			name: "move from a missing member",
+			doc:  `{"name": "John"}`,
+			ops:  `[{"op": "move", "from": "/about", "path": "/activity_name"}]`,
+		},
+		{
+			name: "copy a member",
+			doc:  `{"name": "John"}`,
+			ops:  `[{"op": "copy", "from": "/name", "path": "/activity_name"}]`,
+			want: `{"name": "John", "activity_name": "John"}`,
+		},
+		{
+			name: "copy is independent of its source",
+			doc:  `{"tags": [{"id": 1}]}`,
+			ops: `[
+				{"op": "copy", "from": "/tags/0", "path": "/tags/-"},
+				{"op": "replace", "path": "/tags/1/id", "value": 2}
+			]`,
+			want: `{"tags": [{"id": 1}, {"id": 2}]}`,
+		},
+		{
+			name: "test a value",
+			doc:  `{"name": "John", "tags": [{"id": 1}]}`,
+			ops: `[
+				{"op": "test", "path": "/tags/0", "value": {"id": 1}},
+				{"op": "replace", "path": "/name", "value": "Jane"}
+			]`,
+			want: `{"name": "Jane", "tags": [{"id": 1}]}`,
+		},
+		{
+			name: "test a different value",
+			doc:  `{"name": "John"}`,
+			ops:  `[{"op": "test", "path": "/name", "value": "Jane"}]`,
+		},
+		{
+			name: "test a missing member",
+			doc:  `{"name": "John"}`,
+			ops:  `[{"op": "test", "path": "/about", "value": null}]`,
+		},
+		{
+			name: "escaped slash and tilde",
+			doc:  `{"a/b": 1, "m~n": 2, "~1": 3}`,
+			ops: `[
+				{"op": "replace", "path": "/a~1b", "value": 10},
+				{"op": "replace", "path": "/m~0n", "value": 20},
+				{"op": "replace", "path": "/~01", "value": 30}
+			]`,
+			want: `{"a/b": 10, "m~n": 20, "~1": 30}`,
+		},
+		{
+			name: "path without a leading slash",
+			doc:  `{"name": "John"}`,
+			ops:  `[{"op": "replace", "path": "name", "value": "Jane"}]`,
+		},
+		{
+			name: "unknown operation",
+			doc:  `{"name": "John"}`,
+			ops:  `[{"op": "rename", "path": "/name"}]`,
+		},
+		{
+			name: "a failing operation fails the whole patch",
+			doc:  `{"name": "John"}`,
+			ops: `[
+				{"op": "replace", "path": "/name", "value": "Jane"},
+				{"op": "remove", "path": "/about"}
+			]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ops []patchOperation
+			if err := json.Unmarshal([]byte(tt.ops), &ops); err != nil {
+				t.Fatalf("invalid test patch: %v", err)
+			}
+
+			got, err := applyJSONPatch(decodeJSON(t, tt.doc), ops)
+
+			if tt.want == "" {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", got)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("applyJSONPatch: %v", err)
+			}
+
+			if want := decodeJSON(t, tt.want); !reflect.DeepEqual(got, want) {
+				t.Fatalf("expected %v, got %v", want, got)
+			}
+		})
+	}
+}
+
+func TestApplyMergePatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		patch string
+		want  string
+	}{
+		{
+			name:  "replace a member",
+			doc:   `{"name": "John", "about": "baker"}`,
+			patch: `{"name": "Jane"}`,
+			want:  `{"name": "Jane", "about": "baker"}`,
+		},
+		{
+			name:  "null clears a member",
+			doc:   `{"name": "John", "about": "baker"}`,
+			patch: `{"about": null}`,
+			want:  `{"name": "John"}`,
+		},
+		{
+			name:  "null clears a missing member",
+			doc:   `{"name": "John"}`,
+			patch: `{"about": null}`,
+			want:  `{"name": "John"}`,
+		},
+		{
+			name:  "merge nested objects",
+			doc:   `{"address": {"city": "Berlin", "street": "Unter den Linden"}}`,
+			patch: `{"address": {"city": "Potsdam", "street": null}}`,
+			want:  `{"address": {"city": "Potsdam"}}`,
+		},
+		{
+			name:  "nulls are dropped from added objects",
+			doc:   `{"name": "John"}`,
+			patch: `{"address": {"city": "Berlin", "street": null}}`,
+			want:  `{"name": "John", "address": {"city": "Berlin"}}`,
+		},
+		{
+			name:  "arrays are replaced as a whole",
+			doc:   `{"tags": [{"id": 1}, {"id": 2}]}`,
+			patch: `{"tags": [{"id": 3}]}`,
+			want:  `{"tags": [{"id": 3}]}`,
+		},
+		{
+			name:  "an object replaces a scalar",
+			doc:   `{"about": "baker"}`,
+			patch: `{"about": {"text": "baker"}}`,
+			want:  `{"about": {"text": "baker"}}`,
+		},
+		{
+			name:  "a non-object patch replaces the root",
+			doc:   `{"name": "John"}`,
+			patch: `["John"]`,
+			want:  `["John"]`,
+		},
+		{
+			name:  "an empty patch changes nothing",
+			doc:   `{"name": "John"}`,
+			patch: `{}`,
+			want:  `{"name": "John"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := applyMergePatch(decodeJSON(t, tt.doc), decodeJSON(t, tt.patch))
+
+			if want := decodeJSON(t, tt.want); !reflect.DeepEqual(got, want) {
+				t.Fatalf("expected %v, got %v", want, got)
+			}
+		})
+	}
+}
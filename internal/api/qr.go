@@ -0,0 +1,171 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/skip2/go-qrcode"
+	"strconv"
+	"touchly/internal/db"
+	"touchly/internal/terrors"
+	"touchly/internal/vcard"
+)
+
+type QRFormat string
+
+const (
+	QRFormatPNG QRFormat = "png"
+	QRFormatSVG QRFormat = "svg"
+)
+
+// QRTarget selects what a contact QR code points at.
+type QRTarget string
+
+const (
+	QRTargetURL        QRTarget = "url"
+	QRTargetSharedLink QRTarget = "shared_link"
+	QRTargetVCard      QRTarget = "vcard"
+)
+
+const (
+	defaultQRSize = 256
+	minQRSize     = 64
+	maxQRSize     = 2048
+)
+
+type QRCodeRequest struct {
+	Format QRFormat
+	Target QRTarget
+	Size   int
+	// Token selects a share link for QRTargetSharedLink, the most recent
+	// active link is used when empty.
+	Token string
+}
+
+type QRCode struct {
+	ContentType string
+	Content     []byte
+}
+
+func (api *api) GetContactQRCode(userID, contactID int64, request QRCodeRequest) (*QRCode, error) {
+	if request.Format == "" {
+		request.Format = QRFormatPNG
+	}
+
+	if request.Target == "" {
+		request.Target = QRTargetURL
+	}
+
+	if request.Size == 0 {
+		request.Size = defaultQRSize
+	}
+
+	if request.Format != QRFormatPNG && request.Format != QRFormatSVG {
+		return nil, terrors.InvalidRequest(nil, "format must be png or svg")
+	}
+
+	if request.Size < minQRSize || request.Size > maxQRSize {
+		return nil, terrors.InvalidRequest(nil, fmt.Sprintf("size must be between %d and %d", minQRSize, maxQRSize))
+	}
+
+	var content string
+
+	switch request.Target {
+	case QRTargetURL:
+		contact, err := api.GetContact(userID, contactID)
+		if err != nil {
+			return nil, err
+		}
+
+		content = fmt.Sprintf("%s/contacts/%d?source=%s", api.cfg.WebURL, contact.ID, db.ContactViewSourceQR)
+	case QRTargetSharedLink:
+		token, err := api.qrShareToken(userID, contactID, request.Token)
+		if err != nil {
+			return nil, err
+		}
+
+		content = fmt.Sprintf("%s/shared/%s", api.cfg.WebURL, token)
+	case QRTargetVCard:
+		contact, err := api.GetContact(userID, contactID)
+		if err != nil {
+			return nil, err
+		}
+
+		var buf bytes.Buffer
+		if err := vcard.Encode(&buf, vcard.Version30, *contact); err != nil {
+			return nil, terrors.InternalServerError(err, "failed to encode vCard")
+		}
+
+		content = buf.String()
+	default:
+		return nil, terrors.InvalidRequest(nil, "target must be url, shared_link or vcard")
+	}
+
+	code, err := qrcode.New(content, qrcode.Medium)
+	if err != nil {
+		// large vCards may only fit with the lowest error correction
+		code, err = qrcode.New(content, qrcode.Low)
+	}
+
+	if err != nil {
+		return nil, terrors.InvalidRequest(err, "contact is too large for a QR code")
+	}
+
+	if request.Format == QRFormatSVG {
+		return &QRCode{ContentType: "image/svg+xml", Content: qrSVG(code, request.Size)}, nil
+	}
+
+	png, err := code.PNG(request.Size)
+	if err != nil {
+		return nil, terrors.InternalServerError(err, "failed to render QR code")
+	}
+
+	return &QRCode{ContentType: "image/png", Content: png}, nil
+}
+
+func (api *api) qrShareToken(userID, contactID int64, token string) (string, error) {
+	links, err := api.ListShareLinks(userID, contactID)
+	if err != nil {
+		return "", err
+	}
+
+	for _, link := range links {
+		if !link.IsActive() {
+			continue
+		}
+
+		if token == "" || link.Token == token {
+			return link.Token, nil
+		}
+	}
+
+	if token != "" {
+		return "", terrors.NotFound(nil, "share link not found")
+	}
+
+	return "", terrors.InvalidRequest(nil, "contact has no active share link")
+}
+
+// qrSVG draws the QR code modules as a single SVG path.
+func qrSVG(code *qrcode.QRCode, size int) []byte {
+	bitmap := code.Bitmap()
+	modules := strconv.Itoa(len(bitmap))
+
+	var buf bytes.Buffer
+
+	buf.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %s %s" shape-rendering="crispEdges">`, size, size, modules, modules)
+	fmt.Fprintf(&buf, `<rect width="%s" height="%s" fill="#ffffff"/>`, modules, modules)
+	buf.WriteString(`<path fill="#000000" d="`)
+
+	for y, row := range bitmap {
+		for x, dark := range row {
+			if dark {
+				fmt.Fprintf(&buf, "M%d %dh1v1h-1z", x, y)
+			}
+		}
+	}
+
+	buf.WriteString(`"/></svg>` + "\n")
+
+	return buf.Bytes()
+}
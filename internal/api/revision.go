@@ -0,0 +1,79 @@
+package api
+
+import (
+	"errors"
+	"touchly/internal/db"
+	"touchly/internal/terrors"
+)
+
+func (api *api) ListContactRevisions(userID, contactID int64) ([]db.ContactRevision, error) {
+	if _, err := api.getOwnContact(userID, contactID); err != nil {
+		return nil, err
+	}
+
+	revisions, err := api.storage.ListContactRevisions(contactID)
+
+	if err != nil {
+		return nil, terrors.InternalServerError(err, "failed to list contact revisions")
+	}
+
+	return revisions, nil
+}
+
+// RestoreContactRevision undoes the revision and all the later ones. The
+// restore is recorded as a new revision, so it can be undone as well. It
+// fails unless the contact is still at version, the one the revisions were
+// listed at, zero skips the check.
+func (api *api) RestoreContactRevision(userID, contactID int64, version, revision int) (*db.Contact, error) {
+	if _, err := api.getOwnContact(userID, contactID); err != nil {
+		return nil, err
+	}
+
+	revisions, err := api.storage.ListContactRevisions(contactID)
+
+	if err != nil {
+		return nil, terrors.InternalServerError(err, "failed to list contact revisions")
+	}
+
+	found := false
+	updates := map[string]interface{}{}
+	var tags *[]db.Tag
+	var links *[]db.Link
+
+	// revisions are latest first, so values of older revisions win
+	for _, r := range revisions {
+		if r.Revision < revision {
+			break
+		}
+
+		found = found || r.Revision == revision
+
+		for name, change := range r.Changes.Fields {
+			updates[name] = change.Old
+		}
+
+		if r.Changes.Tags != nil {
+			tags = &r.Changes.Tags.Old
+		}
+
+		if r.Changes.SocialLinks != nil {
+			links = &r.Changes.SocialLinks.Old
+		}
+	}
+
+	if !found {
+		return nil, terrors.NotFound(nil, "revision not found")
+	}
+
+	res, err := api.storage.RevertContact(userID, contactID, version, revision, tags, links, updates)
+
+	if err != nil && errors.Is(err, db.ErrNotFound) {
+		return nil, terrors.NotFound(err, "contact not found")
+	} else if err != nil && errors.Is(err, db.ErrConflict) {
+		return nil, errContactModified(err)
+	} else if err != nil {
+		return nil, terrors.InternalServerError(err, "failed to restore contact revision")
+	}
+
+	return res, nil
+}
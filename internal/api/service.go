@@ -2,8 +2,10 @@ package api
 
 import (
 	"log"
+	"strings"
 	"time"
 	"touchly/internal/db"
+	"touchly/internal/emails"
 	"touchly/internal/services"
 )
 
@@ -16,46 +18,229 @@ type storage interface {
 	GetUserByEmail(email string) (*db.User, error)
 	UpdateUserPassword(email, password string) error
 	GetUserByID(userID int64) (*db.User, error)
+	UpdateUserLanguage(userID int64, language string) error
 	SetOTPIsUsed(otpID int64) error
 	UpdateUserVerified(userID int64) error
-	GetOTPByCode(code string, userID int64) (*db.OTP, error)
-	CreateOTP(otp db.OTP) (*db.OTP, error)
+	GetActiveOTP(userID int64) (*db.OTP, error)
+	CreateOTP(userID int64, codeHash string, ttl time.Duration, email db.OutboxEmail) (*db.OTP, error)
+	IncrementOTPAttempts(otpID int64) (int, error)
+	CountOTPsSince(userID int64, period time.Duration) (int, error)
+	LockUserOTP(userID int64, duration time.Duration) error
+	IsUserOTPLocked(userID int64) (bool, error)
 
 	CreateContact(userID int64, contact db.Contact, tags *[]db.Tag, links *[]db.Link) (*db.Contact, error)
 	DeleteContact(userID, id int64) error
-	UpdateContact(userID, contactID int64, tags *[]db.Tag, links *[]db.Link, updates map[string]interface{}) (*db.Contact, error)
+	RestoreContact(userID, id int64) error
+	ListDeletedContacts(userID int64) ([]db.Contact, error)
+	PurgeDeletedContacts(retention time.Duration, limit int) (int64, error)
+	UpdateContact(userID, contactID int64, version int, tags *[]db.Tag, links *[]db.Link, updates map[string]interface{}) (*db.Contact, error)
+	RevertContact(userID, contactID int64, version, revision int, tags *[]db.Tag, links *[]db.Link, updates map[string]interface{}) (*db.Contact, error)
+	ListContactRevisions(contactID int64) ([]db.ContactRevision, error)
 	ListContacts(params db.ContactQuery) (db.ContactsPage, error)
+	ListContactClusters(params db.ClusterQuery) ([]db.ContactCluster, error)
 	GetContact(userID, id int64) (*db.Contact, error)
 	SaveContact(userID, contactID int64) error
 	DeleteSavedContact(userID, contactID int64) error
 	ListSavedContacts(userID int64) ([]db.Contact, error)
-	CreateContactAddress(contactID int64, address db.Address) (*db.Address, error)
+	ListSavedContactsDetailed(userID int64) ([]db.Contact, error)
+	CreateContactAddress(contactID int64, version int, address db.Address) (*db.Address, error)
+	UpdateContactAddress(contactID int64, version int, address db.Address) (*db.Address, error)
+	DeleteContactAddress(contactID int64, version int, addressID int64) error
+	ClaimPendingAddress() (*db.Address, error)
+	SetAddressGeocoded(address db.Address, found bool) error
 	GetContactsByUserID(userID int64) (db.ContactsPage, error)
 
-	UpdateContactVisibility(userID, contactID int64, visibility db.ContactVisibility) error
+	UpdateContactVisibility(userID, contactID int64, version int, visibility db.ContactVisibility) error
 
-	ListTags() ([]db.Tag, error)
+	ListTags(userID int64) ([]db.Tag, error)
+	GetTag(id int64) (*db.Tag, error)
 	CreateTag(tag db.Tag) (*db.Tag, error)
+	UpdateTag(tag db.Tag) (*db.Tag, error)
 	DeleteTag(id int64) error
+	SuggestTags(userID int64, q string, limit int) ([]db.Tag, error)
+	SuggestContactTags(userID, contactID int64, limit int) ([]db.TagSuggestion, error)
+
+	CreateShareLink(link db.ShareLink) (*db.ShareLink, error)
+	ListShareLinks(contactID int64) ([]db.ShareLink, error)
+	RevokeShareLink(contactID, linkID int64) error
+	GetContactByShareToken(token string) (*db.Contact, error)
+
+	RecordContactView(view db.ContactView, window time.Duration) (bool, error)
+	GetContactDailyStats(contactID int64, from, to time.Time) ([]db.DailyContactStats, error)
+
+	CreateSession(session db.Session) (*db.Session, error)
+	GetActiveSession(id int64) (*db.Session, error)
+	GetSessionByRefreshToken(hash string) (*db.Session, error)
+	RotateSession(id int64, oldHash, newHash string, expiresAt time.Time, userAgent, ip *string) (*db.Session, error)
+	TouchSession(id int64) error
+	ListActiveSessions(userID int64) ([]db.Session, error)
+	RevokeSession(userID, id int64) error
+	RevokeUserSessions(userID, exceptID int64) error
+
+	CreatePasswordReset(reset db.PasswordReset, email db.OutboxEmail) (*db.PasswordReset, error)
+	ResetPassword(tokenHash, passwordHash string) (int64, error)
+	CountPasswordResetsSince(userID int64, period time.Duration) (int, error)
+
+	ClaimOutboxEmails(limit int, lease time.Duration) ([]db.OutboxEmail, error)
+	MarkOutboxEmailSent(id int64) error
+	RetryOutboxEmail(id int64, lastError string, delay time.Duration) error
+	DeadLetterOutboxEmail(id int64, lastError string) error
 }
 
 type emailClient interface {
 	SendEmail(message *services.MailMessage) error
 }
 
+type geocoder interface {
+	Geocode(query string) (*services.Place, error)
+	Reverse(lat, lng float64) (*services.Place, error)
+}
+
+type emailTemplates interface {
+	Render(name, locale string, data any) (*emails.Message, error)
+}
+
+type OTPConfig struct {
+	// Length is the number of digits in a code.
+	Length int
+	TTL    time.Duration
+	// MaxAttempts is the number of wrong codes after which the user is
+	// locked out for LockoutDuration.
+	MaxAttempts     int
+	LockoutDuration time.Duration
+	// ResendCooldown is the minimal period between two codes sent to a user.
+	ResendCooldown  time.Duration
+	MaxSendsPerHour int
+}
+
+type PasswordResetConfig struct {
+	// ResendCooldown is the minimal period between two reset links sent to
+	// a user.
+	ResendCooldown  time.Duration
+	MaxSendsPerHour int
+}
+
+type OutboxConfig struct {
+	PollInterval time.Duration
+	BatchSize    int
+	// MaxAttempts is the number of failed deliveries after which an email
+	// is dead-lettered.
+	MaxAttempts int
+	// Retries back off exponentially from MinBackoff up to MaxBackoff.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+type TrashConfig struct {
+	// Retention is how long deleted contacts can be restored before they
+	// are purged.
+	Retention     time.Duration
+	PurgeInterval time.Duration
+}
+
+type GeocoderConfig struct {
+	// Interval is the period between two background geocoding requests.
+	Interval time.Duration
+}
+
+type Config struct {
+	JWTSecret string
+	WebURL    string
+	// EmailSender is the From address of all emails, e.g. "Touchly <hi@example.com>".
+	EmailSender     string
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	OTP             OTPConfig
+	PasswordReset   PasswordResetConfig
+	Outbox          OutboxConfig
+	Trash           TrashConfig
+	Geocoder        GeocoderConfig
+}
+
 type api struct {
 	storage     storage
 	emailClient emailClient
+	templates   emailTemplates
 	s3Client    s3Client
+	geocoder    geocoder
 	logger      *log.Logger
-	jwtSecret   string
+	cfg         Config
 }
 
-func NewApi(storage storage, emailClient emailClient, s3Client s3Client, jwtSecret string) *api {
+func NewApi(storage storage, emailClient emailClient, templates emailTemplates, s3Client s3Client, geocoder geocoder, cfg Config) *api {
+	cfg.WebURL = strings.TrimSuffix(cfg.WebURL, "/")
+
+	if cfg.EmailSender == "" {
+		cfg.EmailSender = "hi@mxksim.dev"
+	}
+
+	if cfg.AccessTokenTTL == 0 {
+		cfg.AccessTokenTTL = 15 * time.Minute
+	}
+
+	if cfg.RefreshTokenTTL == 0 {
+		cfg.RefreshTokenTTL = 30 * 24 * time.Hour
+	}
+
+	if cfg.OTP.Length == 0 {
+		cfg.OTP.Length = 6
+	}
+
+	if cfg.OTP.TTL == 0 {
+		cfg.OTP.TTL = 10 * time.Minute
+	}
+
+	if cfg.OTP.MaxAttempts == 0 {
+		cfg.OTP.MaxAttempts = 5
+	}
+
+	if cfg.OTP.LockoutDuration == 0 {
+		cfg.OTP.LockoutDuration = 15 * time.Minute
+	}
+
+	if cfg.OTP.ResendCooldown == 0 {
+		cfg.OTP.ResendCooldown = time.Minute
+	}
+
+	if cfg.OTP.MaxSendsPerHour == 0 {
+		cfg.OTP.MaxSendsPerHour = 5
+	}
+
+	if cfg.Outbox.PollInterval == 0 {
+		cfg.Outbox.PollInterval = 5 * time.Second
+	}
+
+	if cfg.Outbox.BatchSize == 0 {
+		cfg.Outbox.BatchSize = 20
+	}
+
+	if cfg.Outbox.MaxAttempts == 0 {
+		cfg.Outbox.MaxAttempts = 8
+	}
+
+	if cfg.Outbox.MinBackoff == 0 {
+		cfg.Outbox.MinBackoff = 30 * time.Second
+	}
+
+	if cfg.Outbox.MaxBackoff == 0 {
+		cfg.Outbox.MaxBackoff = time.Hour
+	}
+
+	if cfg.Trash.Retention == 0 {
+		cfg.Trash.Retention = 30 * 24 * time.Hour
+	}
+
+	if cfg.Trash.PurgeInterval == 0 {
+		cfg.Trash.PurgeInterval = time.Hour
+	}
+
 	return &api{
 		storage:     storage,
 		emailClient: emailClient,
+		templates:   templates,
 		s3Client:    s3Client,
-		jwtSecret:   jwtSecret,
+		geocoder:    geocoder,
+		logger:      log.Default(),
+		cfg:         cfg,
 	}
 }
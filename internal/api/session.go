@@ -0,0 +1,206 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+	"touchly/internal/db"
+	"touchly/internal/terrors"
+)
+
+// Client describes the device a session is started from.
+type Client struct {
+	UserAgent string
+	IP        string
+}
+
+type AuthToken struct {
+	Token        string    `json:"token"`
+	RefreshToken string    `json:"refresh_token"`
+	ExpiresAt    time.Time `json:"expires_at"`
+} // @Name AuthToken
+
+// generateSecureToken returns size random bytes encoded for use in URLs.
+func generateSecureToken(size int) (string, error) {
+	b := make([]byte, size)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(sum[:])
+}
+
+func optional(s string) *string {
+	if s == "" {
+		return nil
+	}
+
+	return &s
+}
+
+// startSession creates a server-side session for the user and issues the
+// first access and refresh token pair for it.
+func (api *api) startSession(userID int64, client Client) (*AuthToken, error) {
+	refreshToken, err := generateSecureToken(32)
+
+	if err != nil {
+		return nil, err
+	}
+
+	session := db.Session{
+		UserID:           userID,
+		RefreshTokenHash: hashToken(refreshToken),
+		UserAgent:        optional(client.UserAgent),
+		IP:               optional(client.IP),
+		ExpiresAt:        time.Now().Add(api.cfg.RefreshTokenTTL),
+	}
+
+	created, err := api.storage.CreateSession(session)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return api.issueToken(created, refreshToken)
+}
+
+func (api *api) issueToken(session *db.Session, refreshToken string) (*AuthToken, error) {
+	expiresAt := time.Now().Add(api.cfg.AccessTokenTTL)
+
+	token, err := GenerateJWT(api.cfg.JWTSecret, session.UserID, session.ID, expiresAt)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &AuthToken{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresAt:    expiresAt,
+	}, nil
+}
+
+// RefreshToken exchanges a refresh token for a new token pair. Refresh tokens
+// are single use: presenting an already rotated token is treated as theft and
+// revokes the whole session.
+func (api *api) RefreshToken(refreshToken string, client Client) (*AuthToken, error) {
+	if refreshToken == "" {
+		return nil, terrors.InvalidRequest(nil, "refresh_token is required")
+	}
+
+	hash := hashToken(refreshToken)
+
+	session, err := api.storage.GetSessionByRefreshToken(hash)
+
+	if err != nil && errors.Is(err, db.ErrNotFound) {
+		return nil, terrors.Unauthorized(err, "invalid refresh token")
+	} else if err != nil {
+		return nil, terrors.InternalServerError(err, "failed to get session")
+	}
+
+	if session.RefreshTokenHash != hash {
+		if err := api.storage.RevokeSession(session.UserID, session.ID); err != nil && !errors.Is(err, db.ErrNotFound) {
+			return nil, terrors.InternalServerError(err, "failed to revoke session")
+		}
+
+		return nil, terrors.Unauthorized(nil, "refresh token reuse detected, session revoked")
+	}
+
+	newToken, err := generateSecureToken(32)
+
+	if err != nil {
+		return nil, terrors.InternalServerError(err, "failed to generate refresh token")
+	}
+
+	expiresAt := time.Now().Add(api.cfg.RefreshTokenTTL)
+
+	rotated, err := api.storage.RotateSession(session.ID, hash, hashToken(newToken), expiresAt, optional(client.UserAgent), optional(client.IP))
+
+	if err != nil && errors.Is(err, db.ErrNotFound) {
+		return nil, terrors.Unauthorized(err, "invalid refresh token")
+	} else if err != nil {
+		return nil, terrors.InternalServerError(err, "failed to rotate session")
+	}
+
+	token, err := api.issueToken(rotated, newToken)
+
+	if err != nil {
+		return nil, terrors.InternalServerError(err, "failed to issue token")
+	}
+
+	return token, nil
+}
+
+// ValidateSession checks that the session an access token was issued for is
+// still active.
+func (api *api) ValidateSession(userID, sessionID int64) error {
+	if sessionID == 0 {
+		return terrors.Unauthorized(nil, "auth is invalid")
+	}
+
+	session, err := api.storage.GetActiveSession(sessionID)
+
+	if err != nil && errors.Is(err, db.ErrNotFound) {
+		return terrors.Unauthorized(err, "session is expired or revoked")
+	} else if err != nil {
+		return terrors.InternalServerError(err, "failed to get session")
+	}
+
+	if session.UserID != userID {
+		return terrors.Unauthorized(nil, "auth is invalid")
+	}
+
+	if err := api.storage.TouchSession(sessionID); err != nil {
+		api.logger.Printf("failed to touch session %d: %v", sessionID, err)
+	}
+
+	return nil
+}
+
+func (api *api) Logout(userID, sessionID int64) error {
+	err := api.storage.RevokeSession(userID, sessionID)
+
+	if err != nil && errors.Is(err, db.ErrNotFound) {
+		return terrors.NotFound(err, "session not found")
+	} else if err != nil {
+		return terrors.InternalServerError(err, "failed to revoke session")
+	}
+
+	return nil
+}
+
+func (api *api) ListSessions(userID, currentSessionID int64) ([]db.Session, error) {
+	sessions, err := api.storage.ListActiveSessions(userID)
+
+	if err != nil {
+		return nil, terrors.InternalServerError(err, "failed to list sessions")
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == currentSessionID
+	}
+
+	return sessions, nil
+}
+
+func (api *api) RevokeSession(userID, sessionID int64) error {
+	return api.Logout(userID, sessionID)
+}
+
+func (api *api) RevokeOtherSessions(userID, currentSessionID int64) error {
+	if err := api.storage.RevokeUserSessions(userID, currentSessionID); err != nil {
+		return terrors.InternalServerError(err, "failed to revoke sessions")
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"errors"
+	"time"
+	"touchly/internal/db"
+	"touchly/internal/terrors"
+)
+
+type CreateShareLinkRequest struct {
+	ExpiresAt *time.Time `json:"expires_at"`
+	MaxViews  *int       `json:"max_views"`
+} // @Name CreateShareLinkRequest
+
+func (api *api) CreateShareLink(userID, contactID int64, request CreateShareLinkRequest) (*db.ShareLink, error) {
+	if request.ExpiresAt != nil && request.ExpiresAt.Before(time.Now()) {
+		return nil, terrors.InvalidRequest(nil, "expires_at must be in the future")
+	}
+
+	if request.MaxViews != nil && *request.MaxViews < 1 {
+		return nil, terrors.InvalidRequest(nil, "max_views must be positive")
+	}
+
+	if _, err := api.getOwnContact(userID, contactID); err != nil {
+		return nil, err
+	}
+
+	token, err := generateSecureToken(24)
+
+	if err != nil {
+		return nil, terrors.InternalServerError(err, "failed to generate token")
+	}
+
+	link := db.ShareLink{
+		ContactID: contactID,
+		Token:     token,
+		ExpiresAt: request.ExpiresAt,
+		MaxViews:  request.MaxViews,
+	}
+
+	res, err := api.storage.CreateShareLink(link)
+
+	if err != nil {
+		return nil, terrors.InternalServerError(err, "failed to create share link")
+	}
+
+	return res, nil
+}
+
+func (api *api) ListShareLinks(userID, contactID int64) ([]db.ShareLink, error) {
+	if _, err := api.getOwnContact(userID, contactID); err != nil {
+		return nil, err
+	}
+
+	links, err := api.storage.ListShareLinks(contactID)
+
+	if err != nil {
+		return nil, terrors.InternalServerError(err, "failed to list share links")
+	}
+
+	return links, nil
+}
+
+func (api *api) RevokeShareLink(userID, contactID, linkID int64) error {
+	if _, err := api.getOwnContact(userID, contactID); err != nil {
+		return err
+	}
+
+	err := api.storage.RevokeShareLink(contactID, linkID)
+
+	if err != nil && errors.Is(err, db.ErrNotFound) {
+		return terrors.NotFound(err, "share link not found")
+	} else if err != nil {
+		return terrors.InternalServerError(err, "failed to revoke share link")
+	}
+
+	return nil
+}
+
+func (api *api) GetSharedContact(viewer Viewer, token string) (*db.Contact, error) {
+	if token == "" {
+		return nil, terrors.InvalidRequest(nil, "token is required")
+	}
+
+	contact, err := api.storage.GetContactByShareToken(token)
+
+	if err != nil && errors.Is(err, db.ErrNotFound) {
+		return nil, terrors.NotFound(err, "shared contact not found")
+	} else if err != nil {
+		return nil, terrors.InternalServerError(err, "failed to get shared contact")
+	}
+
+	api.recordView(viewer, contact, db.ContactViewSourceSharedLink)
+
+	return contact, nil
+}
@@ -1,12 +1,23 @@
 package api
 
 import (
+	"errors"
+	"strings"
 	"touchly/internal/db"
 	"touchly/internal/terrors"
 )
 
-func (api *api) ListTags() ([]db.Tag, error) {
-	tags, err := api.storage.ListTags()
+// TagNode is a tag in the tag tree, its contacts count includes the contacts
+// of its descendants.
+type TagNode struct {
+	db.Tag
+	Children []*TagNode `json:"children"`
+} // @Name TagNode
+
+// ListTags returns the system tags and the personal tags of the user, only
+// system tags for anonymous users.
+func (api *api) ListTags(userID int64) ([]db.Tag, error) {
+	tags, err := api.storage.ListTags(userID)
 
 	if err != nil {
 		return nil, terrors.InternalServerError(err, "failed to list tags")
@@ -15,24 +26,164 @@ func (api *api) ListTags() ([]db.Tag, error) {
 	return tags, nil
 }
 
-func (api *api) CreateTag(tag db.Tag) (*db.Tag, error) {
-	if tag.Name == "" {
-		return nil, terrors.InvalidRequest(nil, "name is required")
+// ListTagTree returns the tags of ListTags as a tree. Tags whose parent is
+// not visible to the user are roots.
+func (api *api) ListTagTree(userID int64) ([]*TagNode, error) {
+	tags, err := api.ListTags(userID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make(map[int64]*TagNode, len(tags))
+	for _, tag := range tags {
+		nodes[tag.ID] = &TagNode{Tag: tag, Children: make([]*TagNode, 0)}
+	}
+
+	roots := make([]*TagNode, 0)
+
+	for _, tag := range tags {
+		node := nodes[tag.ID]
+
+		if tag.ParentID != nil && nodes[*tag.ParentID] != nil {
+			parent := nodes[*tag.ParentID]
+			parent.Children = append(parent.Children, node)
+		} else {
+			roots = append(roots, node)
+		}
+	}
+
+	return roots, nil
+}
+
+// CreateTag creates a personal tag of the user.
+func (api *api) CreateTag(userID int64, tag db.Tag) (*db.Tag, error) {
+	if userID == 0 {
+		return nil, terrors.Unauthorized(nil, "unauthorized")
+	}
+
+	if err := tag.Normalize(); err != nil {
+		return nil, terrors.InvalidRequest(err, err.Error())
 	}
 
+	tag.UserID = &userID
+
 	res, err := api.storage.CreateTag(tag)
 
 	if err != nil {
-		return nil, terrors.InternalServerError(err, "failed to create tag")
+		return nil, tagError(err, "failed to create tag")
 	}
 
 	return res, nil
 }
 
-func (api *api) DeleteTag(id int64) error {
-	if err := api.storage.DeleteTag(id); err != nil {
+// UpdateTag updates a personal tag of the user.
+func (api *api) UpdateTag(userID, id int64, tag db.Tag) (*db.Tag, error) {
+	if _, err := api.getOwnTag(userID, id); err != nil {
+		return nil, err
+	}
+
+	if err := tag.Normalize(); err != nil {
+		return nil, terrors.InvalidRequest(err, err.Error())
+	}
+
+	tag.ID = id
+
+	res, err := api.storage.UpdateTag(tag)
+
+	if err != nil {
+		return nil, tagError(err, "failed to update tag")
+	}
+
+	return res, nil
+}
+
+// DeleteTag deletes a personal tag of the user and detaches it from
+// contacts. System tags can only be deleted by admins.
+func (api *api) DeleteTag(userID, id int64) error {
+	if _, err := api.getOwnTag(userID, id); err != nil {
+		return err
+	}
+
+	err := api.storage.DeleteTag(id)
+
+	if err != nil && errors.Is(err, db.ErrNotFound) {
+		return terrors.NotFound(err, "tag not found")
+	} else if err != nil {
 		return terrors.InternalServerError(err, "failed to delete tag")
 	}
 
 	return nil
 }
+
+// SuggestTags returns up to limit tags matching q for autocompletion, the
+// most used first.
+func (api *api) SuggestTags(userID int64, q string, limit int) ([]db.Tag, error) {
+	if q = strings.TrimSpace(q); q == "" {
+		return nil, terrors.InvalidRequest(nil, "q is required")
+	}
+
+	if limit < 1 || limit > 50 {
+		limit = 10
+	}
+
+	tags, err := api.storage.SuggestTags(userID, q, limit)
+
+	if err != nil {
+		return nil, terrors.InternalServerError(err, "failed to suggest tags")
+	}
+
+	return tags, nil
+}
+
+// SuggestContactTags proposes tags for a contact of the user based on its
+// activity and about, and on tags of similar contacts.
+func (api *api) SuggestContactTags(userID, contactID int64) ([]db.TagSuggestion, error) {
+	if _, err := api.getOwnContact(userID, contactID); err != nil {
+		return nil, err
+	}
+
+	suggestions, err := api.storage.SuggestContactTags(userID, contactID, 10)
+
+	if err != nil {
+		return nil, terrors.InternalServerError(err, "failed to suggest tags")
+	}
+
+	return suggestions, nil
+}
+
+// getOwnTag returns a personal tag of the user. System tags can only be
+// changed by admins.
+func (api *api) getOwnTag(userID, id int64) (*db.Tag, error) {
+	tag, err := api.storage.GetTag(id)
+
+	if err != nil && errors.Is(err, db.ErrNotFound) {
+		return nil, terrors.NotFound(err, "tag not found")
+	} else if err != nil {
+		return nil, terrors.InternalServerError(err, "failed to get tag")
+	}
+
+	if tag.UserID == nil {
+		return nil, terrors.Forbidden(nil, "system tags can not be changed")
+	}
+
+	// personal tags of other users are not visible to the user
+	if *tag.UserID != userID {
+		return nil, terrors.NotFound(nil, "tag not found")
+	}
+
+	return tag, nil
+}
+
+func tagError(err error, msg string) error {
+	switch {
+	case errors.Is(err, db.ErrAlreadyExists):
+		return terrors.InvalidRequest(err, "tag with this name or slug already exists")
+	case errors.Is(err, db.ErrInvalidTagParent):
+		return terrors.InvalidRequest(err, "parent tag not found or not allowed")
+	case errors.Is(err, db.ErrNotFound):
+		return terrors.NotFound(err, "tag not found")
+	}
+
+	return terrors.InternalServerError(err, msg)
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"time"
+	"touchly/internal/db"
+	"touchly/internal/terrors"
+)
+
+// purgeBatchSize limits the number of contacts removed by a single statement.
+const purgeBatchSize = 500
+
+func (api *api) RestoreContact(userID, id int64) (*db.Contact, error) {
+	err := api.storage.RestoreContact(userID, id)
+
+	if err != nil && errors.Is(err, db.ErrNotFound) {
+		return nil, terrors.NotFound(err, "deleted contact not found")
+	} else if err != nil {
+		return nil, terrors.InternalServerError(err, "failed to restore contact")
+	}
+
+	return api.getOwnContact(userID, id)
+}
+
+func (api *api) ListDeletedContacts(userID int64) ([]db.Contact, error) {
+	contacts, err := api.storage.ListDeletedContacts(userID)
+
+	if err != nil {
+		return nil, terrors.InternalServerError(err, "failed to list deleted contacts")
+	}
+
+	return contacts, nil
+}
+
+// RunContactPurge permanently removes contacts that have been in the trash
+// for longer than the retention period, until ctx is cancelled.
+func (api *api) RunContactPurge(ctx context.Context) {
+	ticker := time.NewTicker(api.cfg.Trash.PurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			purged, err := api.storage.PurgeDeletedContacts(api.cfg.Trash.Retention, purgeBatchSize)
+
+			if err != nil {
+				api.logger.Printf("contact purge: %v", err)
+				break
+			}
+
+			if purged > 0 {
+				api.logger.Printf("contact purge: removed %d contacts", purged)
+			}
+
+			if purged < purgeBatchSize || ctx.Err() != nil {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
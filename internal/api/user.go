@@ -1,6 +1,7 @@
 package api
 
 import (
+	"strings"
 	"touchly/internal/db"
 	"touchly/internal/terrors"
 )
@@ -18,3 +19,37 @@ func (api *api) GetUserByID(userID int64) (*db.User, error) {
 
 	return user, nil
 }
+
+// UpdateUserLanguage sets the language emails are sent to the user in.
+func (api *api) UpdateUserLanguage(userID int64, language string) error {
+	if !isLanguageTag(language) {
+		return terrors.InvalidRequest(nil, "invalid language")
+	}
+
+	if err := api.storage.UpdateUserLanguage(userID, language); err != nil {
+		return terrors.InternalServerError(err, "failed to update language")
+	}
+
+	return nil
+}
+
+// isLanguageTag loosely checks for a BCP 47 tag such as "en" or "pt-BR".
+func isLanguageTag(s string) bool {
+	if s == "" || len(s) > 16 {
+		return false
+	}
+
+	for _, part := range strings.Split(s, "-") {
+		if part == "" || len(part) > 8 {
+			return false
+		}
+
+		for _, r := range part {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+				return false
+			}
+		}
+	}
+
+	return true
+}
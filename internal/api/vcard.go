@@ -0,0 +1,52 @@
+package api
+
+import (
+	"bytes"
+	"touchly/internal/terrors"
+	"touchly/internal/vcard"
+)
+
+type VCard struct {
+	FileName string
+	Content  []byte
+}
+
+func (api *api) GetContactVCard(userID, contactID int64, version vcard.Version) (*VCard, error) {
+	if !version.IsValid() {
+		return nil, terrors.InvalidRequest(nil, "unsupported vCard version")
+	}
+
+	contact, err := api.GetContact(userID, contactID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+
+	if err := vcard.Encode(&buf, version, *contact); err != nil {
+		return nil, terrors.InternalServerError(err, "failed to encode vCard")
+	}
+
+	return &VCard{FileName: vcard.FileName(*contact), Content: buf.Bytes()}, nil
+}
+
+func (api *api) ExportSavedContacts(userID int64, version vcard.Version) (*VCard, error) {
+	if !version.IsValid() {
+		return nil, terrors.InvalidRequest(nil, "unsupported vCard version")
+	}
+
+	contacts, err := api.storage.ListSavedContactsDetailed(userID)
+
+	if err != nil {
+		return nil, terrors.InternalServerError(err, "failed to list saved contacts")
+	}
+
+	var buf bytes.Buffer
+
+	if err := vcard.Encode(&buf, version, contacts...); err != nil {
+		return nil, terrors.InternalServerError(err, "failed to encode vCard")
+	}
+
+	return &VCard{FileName: "saved-contacts.vcf", Content: buf.Bytes()}, nil
+}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+	"touchly/internal/db"
+	"touchly/internal/terrors"
+)
+
+// viewDedupWindow is the period during which repeated views of a contact by
+// the same viewer are counted once.
+const viewDedupWindow = 30 * time.Minute
+
+const (
+	defaultStatsRange = 30 * 24 * time.Hour
+	maxStatsDays      = 366
+)
+
+// Viewer identifies who opens a contact. Anonymous viewers are told apart by
+// their IP address and user agent.
+type Viewer struct {
+	UserID    int64
+	IP        string
+	UserAgent string
+}
+
+func (v Viewer) key() string {
+	if v.UserID != 0 {
+		return "u:" + strconv.FormatInt(v.UserID, 10)
+	}
+
+	sum := sha256.Sum256([]byte(v.IP + "|" + v.UserAgent))
+
+	return "a:" + hex.EncodeToString(sum[:])
+}
+
+// ViewContact records a view of a contact returned by GetContact. It is
+// separate from GetContact so that conditional requests answered with 304
+// are not counted.
+func (api *api) ViewContact(viewer Viewer, contact *db.Contact, source db.ContactViewSource) error {
+	if !source.IsValid() {
+		return terrors.InvalidRequest(nil, "invalid view source")
+	}
+
+	api.recordView(viewer, contact, source)
+
+	return nil
+}
+
+// recordView stores a view event of the contact. Failing to count a view must
+// not prevent the contact from being shown, so errors are only logged.
+func (api *api) recordView(viewer Viewer, contact *db.Contact, source db.ContactViewSource) {
+	if viewer.UserID != 0 && viewer.UserID == contact.UserID {
+		return
+	}
+
+	view := db.ContactView{
+		ContactID: contact.ID,
+		ViewerKey: viewer.key(),
+		Source:    source,
+	}
+
+	if viewer.UserID != 0 {
+		view.ViewerID = &viewer.UserID
+	}
+
+	if _, err := api.storage.RecordContactView(view, viewDedupWindow); err != nil {
+		api.logger.Printf("failed to record view of contact %d: %v", contact.ID, err)
+	}
+}
+
+type ContactStats struct {
+	From       string                 `json:"from"`
+	To         string                 `json:"to"`
+	TotalViews int                    `json:"total_views"`
+	TotalSaves int                    `json:"total_saves"`
+	Days       []db.DailyContactStats `json:"days"`
+} // @Name ContactStats
+
+func (api *api) GetContactStats(userID, contactID int64, from, to *time.Time) (*ContactStats, error) {
+	end := time.Now().UTC()
+	if to != nil {
+		end = *to
+	}
+
+	start := end.Add(-defaultStatsRange)
+	if from != nil {
+		start = *from
+	}
+
+	if start.After(end) {
+		return nil, terrors.InvalidRequest(nil, "from must not be after to")
+	}
+
+	if end.Sub(start) > maxStatsDays*24*time.Hour {
+		return nil, terrors.InvalidRequest(nil, fmt.Sprintf("range must not exceed %d days", maxStatsDays))
+	}
+
+	if _, err := api.getOwnContact(userID, contactID); err != nil {
+		return nil, err
+	}
+
+	days, err := api.storage.GetContactDailyStats(contactID, start, end)
+
+	if err != nil {
+		return nil, terrors.InternalServerError(err, "failed to get contact stats")
+	}
+
+	stats := &ContactStats{
+		From: start.Format(time.DateOnly),
+		To:   end.Format(time.DateOnly),
+		Days: days,
+	}
+
+	for _, day := range days {
+		stats.TotalViews += day.Views
+		stats.TotalSaves += day.Saves
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,295 @@
+package db
+
+import "github.com/jmoiron/sqlx"
+
+const addressColumns = `
+	id, external_id, contact_id, label, name, ST_AsText(location) as location,
+	street, house_number, city, postcode, country, country_code,
+	is_primary, geocode_pending, created_at, updated_at, deleted_at
+`
+
+func listAddresses(q sqlx.Queryer, contactID int64) ([]Address, error) {
+	addresses := make([]Address, 0)
+
+	query := `
+		SELECT ` + addressColumns + `
+		FROM addresses
+		WHERE contact_id = $1 AND deleted_at IS NULL
+		ORDER BY is_primary DESC, id
+	`
+
+	if err := sqlx.Select(q, &addresses, query, contactID); err != nil {
+		return nil, err
+	}
+
+	return addresses, nil
+}
+
+// CreateContactAddress adds an address to the contact. The first address of
+// a contact becomes its primary one. Like all address edits it fails with
+// ErrConflict unless the contact is at version, zero skips the check.
+func (s *storage) CreateContactAddress(contactID int64, version int, address Address) (*Address, error) {
+	tx, err := s.pg.Beginx()
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	if err = bumpContactVersion(tx, contactID, version); err != nil {
+		return nil, err
+	}
+
+	res, err := createAddress(tx, contactID, address)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func createAddress(q sqlx.Ext, contactID int64, address Address) (*Address, error) {
+	if address.IsPrimary {
+		if err := unsetPrimaryAddress(q, contactID, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	query := `
+		INSERT INTO addresses
+			(external_id, contact_id, label, name, location, is_primary,
+			 street, house_number, city, postcode, country, country_code, geocode_pending)
+		VALUES ($1, $2, $3, $4, CASE WHEN NOT $14 THEN ST_SetSRID(ST_Point($5, $6), 4326) END, $7 OR NOT EXISTS (
+			SELECT 1 FROM addresses WHERE contact_id = $2 AND is_primary AND deleted_at IS NULL
+		), $8, $9, $10, $11, $12, $13, $14)
+		RETURNING ` + addressColumns
+
+	err := q.QueryRowx(
+		query, address.ExternalID, contactID,
+		address.Label, address.Name, address.Location.Lng,
+		address.Location.Lat, address.IsPrimary,
+		address.Street, address.HouseNumber, address.City,
+		address.Postcode, address.Country, address.CountryCode,
+		address.GeocodePending,
+	).StructScan(&address)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &address, nil
+}
+
+// UpdateContactAddress replaces the address fields. Setting IsPrimary makes
+// it the primary address, the primary address can only be changed by
+// promoting another one.
+func (s *storage) UpdateContactAddress(contactID int64, version int, address Address) (*Address, error) {
+	tx, err := s.pg.Beginx()
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	if err = bumpContactVersion(tx, contactID, version); err != nil {
+		return nil, err
+	}
+
+	if address.IsPrimary {
+		if err = unsetPrimaryAddress(tx, contactID, address.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	query := `
+		UPDATE addresses
+		SET external_id = $3, label = $4, name = $5, location = ST_SetSRID(ST_Point($6, $7), 4326),
+		    is_primary = is_primary OR $8, street = $9, house_number = $10, city = $11,
+		    postcode = $12, country = $13, country_code = $14, geocode_pending = false,
+		    updated_at = NOW()
+		WHERE id = $1 AND contact_id = $2 AND deleted_at IS NULL
+		RETURNING ` + addressColumns
+
+	err = tx.QueryRowx(
+		query, address.ID, contactID, address.ExternalID,
+		address.Label, address.Name, address.Location.Lng,
+		address.Location.Lat, address.IsPrimary,
+		address.Street, address.HouseNumber, address.City,
+		address.Postcode, address.Country, address.CountryCode,
+	).StructScan(&address)
+
+	if err != nil && IsNoRowsError(err) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &address, nil
+}
+
+// DeleteContactAddress removes the address. When it was the primary one, the
+// oldest remaining address takes its place.
+func (s *storage) DeleteContactAddress(contactID int64, version int, addressID int64) error {
+	tx, err := s.pg.Beginx()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if err = bumpContactVersion(tx, contactID, version); err != nil {
+		return err
+	}
+
+	var wasPrimary bool
+
+	query := `
+		SELECT is_primary FROM addresses
+		WHERE id = $1 AND contact_id = $2 AND deleted_at IS NULL
+		FOR UPDATE
+	`
+
+	err = tx.Get(&wasPrimary, query, addressID, contactID)
+
+	if err != nil && IsNoRowsError(err) {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec("UPDATE addresses SET deleted_at = NOW(), is_primary = false WHERE id = $1", addressID); err != nil {
+		return err
+	}
+
+	if wasPrimary {
+		query = `
+			UPDATE addresses SET is_primary = true
+			WHERE id = (
+				SELECT id FROM addresses
+				WHERE contact_id = $1 AND deleted_at IS NULL
+				ORDER BY id
+				LIMIT 1
+			)
+		`
+
+		if _, err = tx.Exec(query, contactID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ClaimPendingAddress returns the imported address waiting the longest to
+// be geocoded, or ErrNotFound when there is none. Claiming it moves it to the
+// end of the queue, so an address failing to geocode does not block others.
+func (s *storage) ClaimPendingAddress() (*Address, error) {
+	var address Address
+
+	query := `
+		UPDATE addresses
+		SET updated_at = NOW()
+		WHERE id = (
+			SELECT id FROM addresses
+			WHERE geocode_pending AND deleted_at IS NULL
+			ORDER BY updated_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + addressColumns
+
+	err := s.pg.QueryRowx(query).StructScan(&address)
+
+	if err != nil && IsNoRowsError(err) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &address, nil
+}
+
+// SetAddressGeocoded stores the location and the address components found
+// for a pending address. When found is false the address is left without a
+// location. The contact gets a new version, its revisions are kept as they
+// are.
+func (s *storage) SetAddressGeocoded(address Address, found bool) error {
+	tx, err := s.pg.Beginx()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	query := `
+		UPDATE addresses
+		SET location = CASE WHEN $2 THEN ST_SetSRID(ST_Point($3, $4), 4326) END,
+		    external_id = $5, street = $6, house_number = $7, city = $8,
+		    postcode = $9, country = $10, country_code = $11,
+		    geocode_pending = false, updated_at = NOW()
+		WHERE id = $1 AND geocode_pending AND deleted_at IS NULL
+		RETURNING contact_id
+	`
+
+	var contactID int64
+
+	err = tx.QueryRowx(
+		query, address.ID, found, address.Location.Lng, address.Location.Lat,
+		address.ExternalID, address.Street, address.HouseNumber, address.City,
+		address.Postcode, address.Country, address.CountryCode,
+	).Scan(&contactID)
+
+	if err != nil && IsNoRowsError(err) {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec("UPDATE contacts SET version = version + 1, updated_at = NOW() WHERE id = $1", contactID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func unsetPrimaryAddress(q sqlx.Execer, contactID, exceptID int64) error {
+	_, err := q.Exec("UPDATE addresses SET is_primary = false WHERE contact_id = $1 AND is_primary AND id <> $2", contactID, exceptID)
+
+	return err
+}
+
+// bumpContactVersion increments the version of the contact, failing with
+// ErrConflict when it was not the expected one. Zero skips the check.
+func bumpContactVersion(q sqlx.Queryer, contactID int64, expected int) error {
+	var previous int
+
+	query := `
+		UPDATE contacts
+		SET version = version + 1, updated_at = NOW()
+		WHERE id = $1 AND deleted_at IS NULL
+		RETURNING version - 1
+	`
+
+	err := sqlx.Get(q, &previous, query, contactID)
+
+	if err != nil && IsNoRowsError(err) {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+
+	if expected != 0 && previous != expected {
+		return ErrConflict
+	}
+
+	return nil
+}
@@ -0,0 +1,107 @@
+package db
+
+import (
+	"fmt"
+	"github.com/lib/pq"
+	"strings"
+)
+
+type ContactCluster struct {
+	// Center is the centroid of the clustered addresses.
+	Center Point `json:"center"`
+	Count  int   `json:"count"`
+	// ContactIDs holds a sample of the most viewed contacts of the cluster.
+	ContactIDs []int64 `json:"contact_ids"`
+	// Bounds is the extent of the cluster, zooming to it splits the cluster.
+	Bounds BBox `json:"bounds"`
+} // @Name ContactCluster
+
+type ClusterQuery struct {
+	// UserID is the user whose personal tags can be filtered by, zero for
+	// anonymous users.
+	UserID int64
+	BBox   BBox
+	// CellSize is the grid size in degrees, addresses in the same cell form
+	// a cluster.
+	CellSize    float64
+	SampleSize  int
+	TagIDs      []int
+	MaxClusters int
+}
+
+// ListContactClusters groups the addresses of public contacts within the box
+// on a regular grid.
+func (s *storage) ListContactClusters(params ClusterQuery) ([]ContactCluster, error) {
+	args := []interface{}{params.CellSize, params.SampleSize, params.MaxClusters}
+	paramIndex := len(args) + 1
+
+	var boxes []string
+
+	for _, b := range params.BBox.split() {
+		boxes = append(boxes, fmt.Sprintf("a.location::geometry && ST_MakeEnvelope($%d, $%d, $%d, $%d, 4326)", paramIndex, paramIndex+1, paramIndex+2, paramIndex+3))
+		args = append(args, b.MinLng, b.MinLat, b.MaxLng, b.MaxLat)
+		paramIndex += 4
+	}
+
+	whereClauses := []string{"c.visibility = 'public'", "c.deleted_at IS NULL", "(" + strings.Join(boxes, " OR ") + ")"}
+
+	if len(params.TagIDs) > 0 {
+		subtree := tagSubtree(fmt.Sprintf("$%d", paramIndex), fmt.Sprintf("$%d", paramIndex+1))
+		whereClauses = append(whereClauses, "EXISTS (SELECT 1 FROM contact_tags ct WHERE ct.contact_id = c.id AND ct.tag_id IN ("+subtree+"))")
+		args = append(args, pq.Array(params.TagIDs), params.UserID)
+	}
+
+	query := `
+		WITH points AS (
+			SELECT c.id, c.views_amount, a.location::geometry AS geom,
+			       ST_SnapToGrid(a.location::geometry, $1) AS cell
+			FROM contacts c
+			JOIN addresses a ON c.id = a.contact_id AND a.is_primary AND a.deleted_at IS NULL
+			WHERE ` + strings.Join(whereClauses, " AND ") + `
+		), clusters AS (
+			SELECT ST_Centroid(ST_Collect(geom)) AS center,
+			       ST_Extent(geom) AS bounds,
+			       COUNT(*) AS count,
+			       (array_agg(id ORDER BY views_amount DESC, id))[1:$2] AS contact_ids
+			FROM points
+			GROUP BY cell
+		)
+		SELECT ST_X(center), ST_Y(center), count, contact_ids,
+		       ST_XMin(bounds), ST_YMin(bounds), ST_XMax(bounds), ST_YMax(bounds)
+		FROM clusters
+		ORDER BY count DESC
+		LIMIT $3
+	`
+
+	rows, err := s.pg.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	clusters := make([]ContactCluster, 0)
+
+	for rows.Next() {
+		var cluster ContactCluster
+		var ids pq.Int64Array
+
+		err = rows.Scan(
+			&cluster.Center.Lng, &cluster.Center.Lat, &cluster.Count, &ids,
+			&cluster.Bounds.MinLng, &cluster.Bounds.MinLat, &cluster.Bounds.MaxLng, &cluster.Bounds.MaxLat,
+		)
+
+		if err != nil {
+			return nil, fmt.Errorf("scanning cluster row: %w", err)
+		}
+
+		cluster.ContactIDs = ids
+		clusters = append(clusters, cluster)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return clusters, nil
+}
@@ -3,7 +3,10 @@ package db
 import (
 	"database/sql/driver"
 	"fmt"
+	"github.com/jmoiron/sqlx"
 	"github.com/lib/pq"
+	"html"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -27,18 +30,20 @@ func (v ContactVisibility) IsValid() bool {
 }
 
 type Contact struct {
-	ID               int64             `db:"id" json:"id"`
-	Name             string            `db:"name" json:"name"`
-	Avatar           *string           `db:"avatar" json:"avatar"`
-	ActivityName     *string           `db:"activity_name" json:"activity_name"`
-	Website          *string           `db:"website" json:"website"`
-	CountryCode      *string           `db:"country_code" json:"country_code"`
-	About            *string           `db:"about" json:"about"`
-	ViewsAmount      int               `db:"views_amount" json:"views_amount"`
-	SavesAmount      int               `db:"saves_amount" json:"saves_amount"`
-	CreatedAt        time.Time         `db:"created_at" json:"created_at"`
-	UpdatedAt        time.Time         `db:"updated_at" json:"updated_at"`
+	ID           int64     `db:"id" json:"id"`
+	Name         string    `db:"name" json:"name"`
+	Avatar       *string   `db:"avatar" json:"avatar"`
+	ActivityName *string   `db:"activity_name" json:"activity_name"`
+	Website      *string   `db:"website" json:"website"`
+	CountryCode  *string   `db:"country_code" json:"country_code"`
+	About        *string   `db:"about" json:"about"`
+	ViewsAmount  int       `db:"views_amount" json:"views_amount"`
+	SavesAmount  int       `db:"saves_amount" json:"saves_amount"`
+	CreatedAt    time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt    time.Time `db:"updated_at" json:"updated_at"`
+	// Address is the primary one of Addresses.
 	Address          *Address          `db:"-" json:"address"`
+	Addresses        []Address         `db:"-" json:"addresses"`
 	PhoneNumber      *string           `db:"phone_number" json:"phone_number"`
 	PhoneCallingCode *string           `db:"phone_calling_code" json:"phone_calling_code"`
 	Email            *string           `db:"email" json:"email"`
@@ -47,6 +52,8 @@ type Contact struct {
 	DeletedAt        *time.Time        `db:"deleted_at" json:"deleted_at"`
 	UserID           int64             `db:"user_id" json:"user_id"`
 	Visibility       ContactVisibility `db:"visibility" json:"visibility"`
+	// Version is incremented on every edit of the contact.
+	Version int `db:"version" json:"version"`
 }
 
 type ContactListEntry struct {
@@ -60,13 +67,31 @@ type ContactListEntry struct {
 	UserID       int64             `db:"user_id" json:"user_id"`
 	IsSaved      bool              `db:"is_saved" json:"is_saved"`
 	Visibility   ContactVisibility `db:"visibility" json:"visibility"`
+	// Location is the point of the contact's primary address, if it has one.
+	Location *Point `db:"-" json:"location"`
+	// DistanceM is the distance in metres from the searched point.
+	DistanceM *float64 `db:"-" json:"distance_m,omitempty"`
+	// Highlight is set when contacts are searched.
+	Highlight *ContactHighlight `db:"-" json:"highlight,omitempty"`
 }
 
+// ContactHighlight holds HTML-escaped fragments of a search result with the
+// matched words wrapped in <mark> tags.
+type ContactHighlight struct {
+	Name         string `json:"name"`
+	ActivityName string `json:"activity_name"`
+	About        string `json:"about"`
+} // @Name ContactHighlight
+
 type ContactsPage struct {
-	Contacts   []ContactListEntry `json:"contacts"`
-	TotalCount int                `json:"total_count"`
-	Page       int                `json:"page"`
-	PageSize   int                `json:"page_size"`
+	Contacts []ContactListEntry `json:"contacts"`
+	// TotalCount is null when counting was skipped.
+	TotalCount *int `json:"total_count"`
+	Page       int  `json:"page"`
+	PageSize   int  `json:"page_size"`
+	// NextCursor and PrevCursor are null at the ends of the listing.
+	NextCursor *string `json:"next_cursor"`
+	PrevCursor *string `json:"prev_cursor"`
 }
 
 type Link struct {
@@ -80,7 +105,16 @@ type Link struct {
 type Tag struct {
 	ID   int64  `db:"id" json:"id"`
 	Name string `db:"name" json:"name"`
-}
+	// UserID is the owner of a personal tag, it is nil for system tags.
+	UserID   *int64      `db:"user_id" json:"user_id"`
+	ParentID *int64      `db:"parent_id" json:"parent_id"`
+	Slug     string      `db:"slug" json:"slug"`
+	Names    TagNames    `db:"names" json:"names"`
+	Synonyms TagSynonyms `db:"synonyms" json:"synonyms"`
+	// ContactsCount is the number of contacts with the tag, counting the ones
+	// with its descendants in ListTags. Only set when listing tags.
+	ContactsCount *int `db:"contacts_count" json:"contacts_count,omitempty"`
+} // @Name Tag
 
 type Point struct {
 	Lat float64 `json:"lat"`
@@ -128,27 +162,59 @@ func parsePoint(src string, p *Point) error {
 	return nil
 }
 
+// Address is a labelled place of a contact. Every contact with addresses has
+// exactly one primary address, which is used for geo search.
 type Address struct {
-	ID         int64      `db:"id" json:"id"`
-	ExternalID *string    `db:"external_id" json:"external_id"`
-	ContactID  int64      `db:"contact_id" json:"contact_id"`
-	Label      string     `db:"label" json:"label"`
-	Name       string     `db:"name" json:"name"`
-	Location   Point      `db:"location" json:"location"`
-	CreatedAt  time.Time  `db:"created_at" json:"created_at"`
-	UpdatedAt  time.Time  `db:"updated_at" json:"updated_at"`
-	DeletedAt  *time.Time `db:"deleted_at" json:"deleted_at"`
+	ID         int64   `db:"id" json:"id"`
+	ExternalID *string `db:"external_id" json:"external_id"`
+	ContactID  int64   `db:"contact_id" json:"contact_id"`
+	Label      string  `db:"label" json:"label"`
+	Name       string  `db:"name" json:"name"`
+	Location   Point   `db:"location" json:"location"`
+	// Street, HouseNumber, City, Postcode, Country and CountryCode are
+	// filled in by geocoding, when available.
+	Street      *string `db:"street" json:"street"`
+	HouseNumber *string `db:"house_number" json:"house_number"`
+	City        *string `db:"city" json:"city"`
+	Postcode    *string `db:"postcode" json:"postcode"`
+	Country     *string `db:"country" json:"country"`
+	CountryCode *string `db:"country_code" json:"country_code"`
+	IsPrimary   bool    `db:"is_primary" json:"is_primary"`
+	// GeocodePending is set on imported addresses waiting to be geocoded in
+	// the background, their location is unknown until then.
+	GeocodePending bool       `db:"geocode_pending" json:"geocode_pending"`
+	CreatedAt      time.Time  `db:"created_at" json:"created_at"`
+	UpdatedAt      time.Time  `db:"updated_at" json:"updated_at"`
+	DeletedAt      *time.Time `db:"deleted_at" json:"deleted_at"`
 }
 
+// BBox is a map viewport in WGS 84 degrees. MinLng may be greater than
+// MaxLng when the box crosses the antimeridian.
+type BBox struct {
+	MinLng float64 `json:"min_lng"`
+	MinLat float64 `json:"min_lat"`
+	MaxLng float64 `json:"max_lng"`
+	MaxLat float64 `json:"max_lat"`
+} // @Name BBox
+
 type ContactQuery struct {
-	UserID   int64
-	TagIDs   []int
-	Search   string
-	Lat      float64
-	Lng      float64
-	Radius   int
+	UserID int64
+	TagIDs []int
+	Search string
+	// Lat and Lng are the point distances are measured from, contacts are
+	// limited to RadiusMeters around it unless the radius is zero.
+	Lat          float64
+	Lng          float64
+	RadiusMeters float64
+	// BBox limits contacts to addresses within the box.
+	BBox     *BBox
 	Page     int
 	PageSize int
+	Sort     ContactSort
+	Desc     bool
+	// Cursor replaces Page when set.
+	Cursor    *ContactCursor
+	SkipCount bool
 }
 
 func (s *storage) ListContacts(params ContactQuery) (ContactsPage, error) {
@@ -158,12 +224,10 @@ func (s *storage) ListContacts(params ContactQuery) (ContactsPage, error) {
 		PageSize: params.PageSize,
 	}
 
-	offset := (params.Page - 1) * params.PageSize
-
 	var args []interface{}
 	paramIndex := 1
 
-	var whereClauses []string
+	whereClauses := []string{"c.deleted_at IS NULL"}
 
 	if params.UserID != 0 {
 		whereClauses = append(whereClauses, "(c.user_id = $"+strconv.Itoa(paramIndex)+" OR c.visibility = 'public')")
@@ -173,77 +237,164 @@ func (s *storage) ListContacts(params ContactQuery) (ContactsPage, error) {
 		whereClauses = append(whereClauses, "c.visibility = 'public'")
 	}
 
+	searchIndex := 0
+
 	if params.Search != "" {
-		whereClauses = append(whereClauses, "(c.name ILIKE $"+strconv.Itoa(paramIndex)+" OR c.activity_name ILIKE $"+strconv.Itoa(paramIndex)+")")
-		args = append(args, "%"+params.Search+"%")
+		// full-text matches, with trigram similarity of the name and
+		// activity as a fallback for typos
+		searchIndex = paramIndex
+		whereClauses = append(whereClauses, fmt.Sprintf("(c.search_vector @@ query OR $%d <%% c.name OR $%d <%% c.activity_name)", searchIndex, searchIndex))
+		args = append(args, params.Search)
 		paramIndex++
 	}
 
 	if len(params.TagIDs) > 0 {
-		whereClauses = append(whereClauses, "ct.tag_id = ANY($"+strconv.Itoa(paramIndex)+")")
-		args = append(args, pq.Array(params.TagIDs))
-		paramIndex++
+		subtree := tagSubtree("$"+strconv.Itoa(paramIndex), "$"+strconv.Itoa(paramIndex+1))
+		whereClauses = append(whereClauses, "EXISTS (SELECT 1 FROM contact_tags ct WHERE ct.contact_id = c.id AND ct.tag_id IN ("+subtree+"))")
+		args = append(args, pq.Array(params.TagIDs), params.UserID)
+		paramIndex += 2
 	}
 
-	if params.Lat != 0 && params.Lng != 0 {
-		point := fmt.Sprintf("ST_SetSRID(ST_Point(%f, %f), 4326)", params.Lng, params.Lat)
+	geo := params.Lat != 0 && params.Lng != 0
+	point, distance := "", ""
+
+	if geo {
+		// inlined, as a parameter only referenced in the sort would be
+		// left untyped in the count query
+		point = fmt.Sprintf("ST_SetSRID(ST_MakePoint(%s, %s), 4326)::geography",
+			strconv.FormatFloat(params.Lng, 'f', -1, 64), strconv.FormatFloat(params.Lat, 'f', -1, 64))
+
+		// measured on the sphere everywhere, so the radius, the sort and the
+		// returned distances agree
+		distance = "ST_Distance(a.location, " + point + ", false)"
+	}
 
-		geoClause := fmt.Sprintf("ST_DWithin(a.location, %s, $%d)", point, paramIndex)
-		whereClauses = append(whereClauses, geoClause)
-		args = append(args, params.Radius*1000) // Convert km to meters
+	if geo && params.RadiusMeters > 0 {
+		whereClauses = append(whereClauses, fmt.Sprintf("ST_DWithin(a.location, %s, $%d, false)", point, paramIndex))
+		args = append(args, params.RadiusMeters)
 		paramIndex++
 	}
 
-	where := ""
-	if len(whereClauses) > 0 {
-		where = " WHERE " + strings.Join(whereClauses, " AND ")
+	if params.BBox != nil {
+		// compared as geometry, so the box edges follow parallels and
+		// meridians like on the map
+		var boxes []string
+
+		for _, b := range params.BBox.split() {
+			boxes = append(boxes, fmt.Sprintf("a.location::geometry && ST_MakeEnvelope($%d, $%d, $%d, $%d, 4326)", paramIndex, paramIndex+1, paramIndex+2, paramIndex+3))
+			args = append(args, b.MinLng, b.MinLat, b.MaxLng, b.MaxLat)
+			paramIndex += 4
+		}
+
+		whereClauses = append(whereClauses, "("+strings.Join(boxes, " OR ")+")")
 	}
 
-	countQuery := `SELECT COUNT(*) FROM contacts c`
-	if len(params.TagIDs) > 0 {
-		countQuery += ` JOIN contact_tags ct ON c.id = ct.contact_id`
+	joins := " LEFT JOIN addresses a ON c.id = a.contact_id AND a.is_primary AND a.deleted_at IS NULL"
+
+	if geo || params.BBox != nil {
+		joins = " JOIN addresses a ON c.id = a.contact_id AND a.is_primary AND a.deleted_at IS NULL"
 	}
 
-	if params.Lat != 0 && params.Lng != 0 {
-		countQuery += ` JOIN addresses a ON c.id = a.contact_id`
+	if searchIndex != 0 {
+		joins += searchJoin(searchIndex)
 	}
 
-	countQuery += where
-	err := s.pg.QueryRow(countQuery, args...).Scan(&contactsPage.TotalCount)
-	if err != nil {
-		return contactsPage, fmt.Errorf("error fetching contacts count: %w", err)
+	if !params.SkipCount {
+		countQuery := `SELECT COUNT(*) FROM contacts c` + joins + " WHERE " + strings.Join(whereClauses, " AND ")
+
+		var count int
+
+		if err := s.pg.QueryRow(countQuery, args...).Scan(&count); err != nil {
+			return contactsPage, fmt.Errorf("error fetching contacts count: %w", err)
+		}
+
+		contactsPage.TotalCount = &count
 	}
 
-	var selectQuery string
+	var sortKey, sortType string
+
+	switch params.Sort {
+	case ContactSortUpdated:
+		sortKey, sortType = "c.updated_at", "timestamp"
+	case ContactSortName:
+		sortKey, sortType = "c.name", "text"
+	case ContactSortViews:
+		sortKey, sortType = "c.views_amount", "integer"
+	case ContactSortSaves:
+		sortKey, sortType = "c.saves_amount", "integer"
+	case ContactSortDistance:
+		if !geo {
+			return contactsPage, fmt.Errorf("distance sort requires a location")
+		}
+
+		// keyset pagination compares (distance, id) rows, so the spatial
+		// index only serves the radius filter and matches are sorted after it
+		sortKey, sortType = distance, "float8"
+	case ContactSortRelevance:
+		if searchIndex == 0 {
+			return contactsPage, fmt.Errorf("relevance sort requires a search query")
+		}
+
+		// full-text matches rank above fuzzy ones
+		sortKey = fmt.Sprintf(`((c.search_vector @@ query)::int + ts_rank_cd(c.search_vector, query)
+			+ greatest(word_similarity($%d, c.name), word_similarity($%d, coalesce(c.activity_name, ''))))::float8`, searchIndex, searchIndex)
+		sortType = "float8"
+	default:
+		sortKey, sortType = "c.created_at", "timestamp"
+	}
+
+	// keyset pagination: pages going backward are read in reverse order and
+	// flipped afterward
+	backward := params.Cursor != nil && params.Cursor.Backward
+	desc := params.Desc != backward
+
+	direction, comparison := "ASC", ">"
+	if desc {
+		direction, comparison = "DESC", "<"
+	}
+
+	if params.Cursor != nil {
+		whereClauses = append(whereClauses, fmt.Sprintf("(%s, c.id) %s ($%d::%s, $%d)", sortKey, comparison, paramIndex, sortType, paramIndex+1))
+		args = append(args, params.Cursor.Key, params.Cursor.ID)
+		paramIndex += 2
+	}
+
+	columns := "c.id, c.name, c.avatar, c.activity_name, c.about, c.views_amount, c.saves_amount, c.user_id, c.visibility, (" + sortKey + ")::text, ST_AsText(a.location)"
+
+	if geo {
+		columns += ", " + distance
+	}
 
 	if params.UserID != 0 {
-		selectQuery = `
-			SELECT c.id, c.name, c.avatar, c.activity_name, c.about, c.views_amount, c.saves_amount, c.user_id, c.visibility, sc.contact_id IS NOT NULL as is_saved
-			FROM contacts c
-			LEFT JOIN saved_contacts sc ON c.id = sc.contact_id AND sc.user_id = $1
- 		`
+		columns += ", sc.contact_id IS NOT NULL as is_saved"
+	}
 
-	} else {
-		selectQuery = `
-			SELECT c.id, c.name, c.avatar, c.activity_name, c.about, c.views_amount, c.saves_amount, c.user_id, c.visibility
-			FROM contacts c
-		`
+	if searchIndex != 0 {
+		columns += fmt.Sprintf(`,
+			ts_headline('simple', c.name, query, %[1]s || ', HighlightAll=true'),
+			ts_headline('simple', coalesce(c.activity_name, ''), query, %[1]s || ', HighlightAll=true'),
+			ts_headline('simple', coalesce(c.about, ''), query, %[1]s || ', MaxFragments=2, MinWords=5, MaxWords=20')
+		`, headlineOptions)
 	}
 
-	if len(params.TagIDs) > 0 {
-		selectQuery += ` JOIN contact_tags ct ON c.id = ct.contact_id`
+	selectQuery := `SELECT ` + columns + ` FROM contacts c`
+
+	if params.UserID != 0 {
+		selectQuery += ` LEFT JOIN saved_contacts sc ON c.id = sc.contact_id AND sc.user_id = $1`
 	}
 
-	if params.Lat != 0 && params.Lng != 0 {
-		selectQuery += ` JOIN addresses a ON c.id = a.contact_id`
+	offset := 0
+	if params.Cursor == nil {
+		offset = (params.Page - 1) * params.PageSize
 	}
 
-	selectQuery += where
+	// one extra row tells whether there is a page after this one
+	selectQuery += joins + " WHERE " + strings.Join(whereClauses, " AND ")
 	selectQuery += `
-        ORDER BY c.created_at DESC
+        ORDER BY ` + sortKey + ` ` + direction + `, c.id ` + direction + `
         LIMIT $` + strconv.Itoa(paramIndex) + ` OFFSET $` + strconv.Itoa(paramIndex+1)
 
-	args = append(args, params.PageSize, offset)
+	args = append(args, params.PageSize+1, offset)
 
 	rows, err := s.pg.Query(selectQuery, args...)
 	if err != nil {
@@ -253,27 +404,126 @@ func (s *storage) ListContacts(params ContactQuery) (ContactsPage, error) {
 	defer rows.Close()
 
 	contacts := make([]ContactListEntry, 0)
+	keys := make([]string, 0)
 
 	for rows.Next() {
 		var c ContactListEntry
-		dest := []interface{}{&c.ID, &c.Name, &c.Avatar, &c.ActivityName, &c.About, &c.ViewsAmount, &c.SavesAmount, &c.UserID, &c.Visibility}
+		var key string
+		var location *string
+		dest := []interface{}{&c.ID, &c.Name, &c.Avatar, &c.ActivityName, &c.About, &c.ViewsAmount, &c.SavesAmount, &c.UserID, &c.Visibility, &key, &location}
+
+		if geo {
+			dest = append(dest, &c.DistanceM)
+		}
 
 		if params.UserID != 0 {
 			dest = append(dest, &c.IsSaved)
 		}
 
+		var highlight ContactHighlight
+
+		if searchIndex != 0 {
+			dest = append(dest, &highlight.Name, &highlight.ActivityName, &highlight.About)
+		}
+
 		err = rows.Scan(dest...)
 
 		if err != nil {
 			return contactsPage, fmt.Errorf("scanning contact row: %w", err)
 		}
+
+		if location != nil {
+			c.Location = &Point{}
+
+			if err = parsePoint(*location, c.Location); err != nil {
+				return contactsPage, fmt.Errorf("scanning contact location: %w", err)
+			}
+		}
+
+		if searchIndex != 0 {
+			c.Highlight = &ContactHighlight{
+				Name:         markHighlight(highlight.Name),
+				ActivityName: markHighlight(highlight.ActivityName),
+				About:        markHighlight(highlight.About),
+			}
+		}
+
 		contacts = append(contacts, c)
+		keys = append(keys, key)
+	}
+
+	if err = rows.Err(); err != nil {
+		return contactsPage, err
+	}
+
+	hasMore := len(contacts) > params.PageSize
+	if hasMore {
+		contacts, keys = contacts[:params.PageSize], keys[:params.PageSize]
+	}
+
+	if backward {
+		slices.Reverse(contacts)
+		slices.Reverse(keys)
+	}
+
+	if len(contacts) > 0 {
+		cursor := func(i int, backward bool) *string {
+			c := ContactCursor{Sort: params.Sort, Desc: params.Desc, Key: keys[i], ID: contacts[i].ID, Backward: backward}.Encode()
+			return &c
+		}
+
+		last := len(contacts) - 1
+
+		if backward {
+			contactsPage.NextCursor = cursor(last, false)
+
+			if hasMore {
+				contactsPage.PrevCursor = cursor(0, true)
+			}
+		} else {
+			if hasMore {
+				contactsPage.NextCursor = cursor(last, false)
+			}
+
+			if params.Cursor != nil || offset > 0 {
+				contactsPage.PrevCursor = cursor(0, true)
+			}
+		}
 	}
 
 	contactsPage.Contacts = contacts
 	return contactsPage, nil
 }
 
+// split returns the box as one or, when it crosses the antimeridian, two
+// boxes that don't.
+func (b BBox) split() []BBox {
+	if b.MinLng <= b.MaxLng {
+		return []BBox{b}
+	}
+
+	return []BBox{
+		{MinLng: b.MinLng, MinLat: b.MinLat, MaxLng: 180, MaxLat: b.MaxLat},
+		{MinLng: -180, MinLat: b.MinLat, MaxLng: b.MaxLng, MaxLat: b.MaxLat},
+	}
+}
+
+// searchJoin parses the search parameter as a web search query, e.g.
+// `"john doe" -designer`, available as "query" in the statement.
+func searchJoin(paramIndex int) string {
+	return fmt.Sprintf(" CROSS JOIN websearch_to_tsquery('simple', $%d) query", paramIndex)
+}
+
+// headlineOptions makes ts_headline wrap matches in control characters that
+// can't appear in escaped text, so user input is never returned as HTML.
+const headlineOptions = `'StartSel=' || chr(2) || ', StopSel=' || chr(3)`
+
+var highlightReplacer = strings.NewReplacer("\x02", "<mark>", "\x03", "</mark>")
+
+func markHighlight(s string) string {
+	return highlightReplacer.Replace(html.EscapeString(s))
+}
+
 func (s *storage) CreateContact(userID int64, contact Contact, tags *[]Tag, links *[]Link) (*Contact, error) {
 	tx, err := s.pg.Beginx()
 	if err != nil {
@@ -289,11 +539,11 @@ func (s *storage) CreateContact(userID int64, contact Contact, tags *[]Tag, link
 		INSERT INTO contacts
 		    (name, avatar, activity_name, about, website, country_code, phone_number, phone_calling_code, email, user_id)
 		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
-		RETURNING id, name, avatar, activity_name, about, website, country_code, phone_number, phone_calling_code, email, user_id, created_at, updated_at, visibility, deleted_at
+		RETURNING id, name, avatar, activity_name, about, website, country_code, phone_number, phone_calling_code, email, user_id, created_at, updated_at, visibility, deleted_at, version
 	`
 
 	err = tx.QueryRow(query, contact.Name, contact.Avatar, contact.ActivityName, contact.About, contact.Website, contact.CountryCode, contact.PhoneNumber, contact.PhoneCallingCode, contact.Email, userID).Scan(
-		&res.ID, &res.Name, &res.Avatar, &res.ActivityName, &res.About, &res.Website, &res.CountryCode, &res.PhoneNumber, &res.PhoneCallingCode, &res.Email, &res.UserID, &res.CreatedAt, &res.UpdatedAt, &res.Visibility, &res.DeletedAt,
+		&res.ID, &res.Name, &res.Avatar, &res.ActivityName, &res.About, &res.Website, &res.CountryCode, &res.PhoneNumber, &res.PhoneCallingCode, &res.Email, &res.UserID, &res.CreatedAt, &res.UpdatedAt, &res.Visibility, &res.DeletedAt, &res.Version,
 	)
 
 	if err != nil {
@@ -302,14 +552,16 @@ func (s *storage) CreateContact(userID int64, contact Contact, tags *[]Tag, link
 
 	if tags != nil {
 		for _, tag := range *tags {
-			if _, err = tx.Exec("INSERT INTO contact_tags (contact_id, tag_id) VALUES ($1, $2)", res.ID, tag.ID); err != nil {
+			if err = insertContactTag(tx, res.ID, userID, tag.ID); err != nil {
 				return nil, err
 			}
-
-			res.Tags = append(res.Tags, tag)
 		}
 	}
 
+	if res.Tags, err = listContactTags(tx, res.ID); err != nil {
+		return nil, err
+	}
+
 	if links != nil {
 		for _, link := range *links {
 			row := tx.QueryRow("INSERT INTO social_media_links (contact_id, type, link) VALUES ($1, $2, $3) RETURNING id", res.ID, link.Type, link.Link)
@@ -322,6 +574,31 @@ func (s *storage) CreateContact(userID int64, contact Contact, tags *[]Tag, link
 		}
 	}
 
+	res.Addresses = make([]Address, 0, len(contact.Addresses))
+
+	for _, address := range contact.Addresses {
+		created, err := createAddress(tx, res.ID, address)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if created.IsPrimary {
+			// the previous primary address was demoted
+			for i := range res.Addresses {
+				res.Addresses[i].IsPrimary = false
+			}
+		}
+
+		res.Addresses = append(res.Addresses, *created)
+	}
+
+	for i := range res.Addresses {
+		if res.Addresses[i].IsPrimary {
+			res.Address = &res.Addresses[i]
+		}
+	}
+
 	if err = tx.Commit(); err != nil {
 		return nil, err
 	}
@@ -329,8 +606,10 @@ func (s *storage) CreateContact(userID int64, contact Contact, tags *[]Tag, link
 	return &res, nil
 }
 
+// DeleteContact moves the contact to the trash, it is purged after the
+// retention period unless restored.
 func (s *storage) DeleteContact(userID, id int64) error {
-	res, err := s.pg.Exec("DELETE FROM contacts WHERE id=$1 AND user_id=$2", id, userID)
+	res, err := s.pg.Exec("UPDATE contacts SET deleted_at = NOW() WHERE id=$1 AND user_id=$2 AND deleted_at IS NULL", id, userID)
 
 	if err != nil {
 		return err
@@ -345,7 +624,82 @@ func (s *storage) DeleteContact(userID, id int64) error {
 	return nil
 }
 
-func (s *storage) UpdateContact(userID, contactID int64, tags *[]Tag, links *[]Link, updates map[string]interface{}) (*Contact, error) {
+func (s *storage) RestoreContact(userID, id int64) error {
+	res, err := s.pg.Exec("UPDATE contacts SET deleted_at = NULL WHERE id=$1 AND user_id=$2 AND deleted_at IS NOT NULL", id, userID)
+
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected, _ := res.RowsAffected(); rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// ListDeletedContacts returns the trash of the user, most recently deleted
+// first.
+func (s *storage) ListDeletedContacts(userID int64) ([]Contact, error) {
+	contacts := make([]Contact, 0)
+
+	query := `
+		SELECT c.id, c.name, c.avatar, c.activity_name, c.about, c.views_amount,
+		       c.saves_amount, c.created_at, c.updated_at, c.phone_number, c.email,
+		       c.user_id, c.visibility, c.country_code, c.phone_calling_code, c.website, c.deleted_at, c.version
+		FROM contacts c
+		WHERE c.user_id = $1 AND c.deleted_at IS NOT NULL
+		ORDER BY c.deleted_at DESC, c.id DESC
+	`
+
+	if err := s.pg.Select(&contacts, query, userID); err != nil {
+		return nil, err
+	}
+
+	return contacts, nil
+}
+
+// PurgeDeletedContacts permanently removes up to limit contacts deleted more
+// than retention ago and returns how many were removed.
+func (s *storage) PurgeDeletedContacts(retention time.Duration, limit int) (int64, error) {
+	query := `
+		DELETE FROM contacts
+		WHERE id IN (
+			SELECT id FROM contacts
+			WHERE deleted_at < NOW() - make_interval(secs => $1)
+			LIMIT $2
+		)
+	`
+
+	res, err := s.pg.Exec(query, retention.Seconds(), limit)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+const contactColumns = `
+	c.id, c.name, c.avatar, c.activity_name, c.about, c.views_amount,
+	c.saves_amount, c.created_at, c.updated_at, c.phone_number, c.email,
+	c.user_id, c.visibility, c.country_code, c.phone_calling_code, c.website, c.deleted_at, c.version
+`
+
+// UpdateContact applies updates to the columns of the contact and replaces
+// its tags and links when they are not nil. The changes are recorded as a
+// new revision. It fails with ErrConflict unless the contact is at version,
+// zero skips the check.
+func (s *storage) UpdateContact(userID, contactID int64, version int, tags *[]Tag, links *[]Link, updates map[string]interface{}) (*Contact, error) {
+	return s.updateContact(userID, contactID, version, tags, links, updates, nil)
+}
+
+// RevertContact is UpdateContact restoring the state before revision.
+func (s *storage) RevertContact(userID, contactID int64, version, revision int, tags *[]Tag, links *[]Link, updates map[string]interface{}) (*Contact, error) {
+	return s.updateContact(userID, contactID, version, tags, links, updates, &revision)
+}
+
+func (s *storage) updateContact(userID, contactID int64, version int, tags *[]Tag, links *[]Link, updates map[string]interface{}, restoredFrom *int) (*Contact, error) {
 	tx, err := s.pg.Beginx()
 	if err != nil {
 		return nil, err
@@ -353,36 +707,50 @@ func (s *storage) UpdateContact(userID, contactID int64, tags *[]Tag, links *[]L
 
 	defer tx.Rollback()
 
-	baseQuery := "UPDATE contacts SET "
-	var setClauses = []string{"updated_at = now()"}
-	var queryParams = map[string]any{
-		"id":      contactID,
-		"user_id": userID,
+	var before Contact
+
+	query := `SELECT ` + contactColumns + ` FROM contacts c WHERE c.id = $1 AND c.user_id = $2 AND c.deleted_at IS NULL FOR UPDATE`
+
+	err = tx.Get(&before, query, contactID, userID)
+
+	if err != nil && IsNoRowsError(err) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
 	}
 
-	for key, value := range updates {
-		paramName := fmt.Sprintf("%s", key)
-		setClauses = append(setClauses, fmt.Sprintf("%s = :%s", key, paramName))
-		queryParams[paramName] = value
+	if version != 0 && before.Version != version {
+		return nil, ErrConflict
 	}
 
-	query := baseQuery + strings.Join(setClauses, ", ") + " WHERE id = :id AND user_id = :user_id RETURNING *"
+	if before.Tags, err = listContactTags(tx, contactID); err != nil {
+		return nil, err
+	}
 
-	var contact Contact
+	if before.SocialLinks, err = listContactLinks(tx, contactID); err != nil {
+		return nil, err
+	}
 
-	rows, err := s.pg.NamedQuery(query, queryParams)
+	var setClauses = []string{"updated_at = now()", "version = version + 1"}
+	var queryParams = map[string]any{
+		"id": contactID,
+	}
+
+	for key, value := range updates {
+		setClauses = append(setClauses, fmt.Sprintf("%s = :%s", key, key))
+		queryParams[key] = value
+	}
+
+	query, args, err := sqlx.Named("UPDATE contacts c SET "+strings.Join(setClauses, ", ")+" WHERE c.id = :id RETURNING "+contactColumns, queryParams)
 
 	if err != nil {
 		return nil, err
 	}
 
-	defer rows.Close()
+	var contact Contact
 
-	if rows.Next() {
-		err = rows.StructScan(&contact)
-		if err != nil {
-			return nil, err
-		}
+	if err = tx.QueryRowx(tx.Rebind(query), args...).StructScan(&contact); err != nil {
+		return nil, err
 	}
 
 	if tags != nil {
@@ -392,8 +760,7 @@ func (s *storage) UpdateContact(userID, contactID int64, tags *[]Tag, links *[]L
 		}
 
 		for _, tag := range *tags {
-			_, err = tx.Exec("INSERT INTO contact_tags (contact_id, tag_id) VALUES ($1, $2)", contactID, tag.ID)
-			if err != nil {
+			if err = insertContactTag(tx, contactID, userID, tag.ID); err != nil {
 				return nil, err
 			}
 		}
@@ -406,36 +773,71 @@ func (s *storage) UpdateContact(userID, contactID int64, tags *[]Tag, links *[]L
 		}
 
 		for _, link := range *links {
-			_, err = tx.Exec("INSERT INTO social_media_links (contact_id, type, link) VALUES ($1, $2, $3)", contactID, link.Type, link.Link)
+			_, err = tx.Exec("INSERT INTO social_media_links (contact_id, type, link, label) VALUES ($1, $2, $3, $4)", contactID, link.Type, link.Link, link.Label)
 			if err != nil {
 				return nil, err
 			}
 		}
 	}
 
-	tagsUpdated := make([]Tag, 0)
-	err = tx.Select(&tagsUpdated, "SELECT t.id, t.name FROM tags t JOIN contact_tags ct ON t.id = ct.tag_id WHERE ct.contact_id=$1", contactID)
+	if contact.Tags, err = listContactTags(tx, contactID); err != nil {
+		return nil, err
+	}
 
-	if err != nil {
+	if contact.SocialLinks, err = listContactLinks(tx, contactID); err != nil {
+		return nil, err
+	}
+
+	if changes := diffContacts(before, contact); !changes.IsEmpty() {
+		if err = insertContactRevision(tx, contactID, userID, changes, restoredFrom); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
 		return nil, err
 	}
 
-	contact.Tags = tagsUpdated
+	return &contact, nil
+}
 
-	linksUpdated := make([]Link, 0)
-	err = tx.Select(&linksUpdated, "SELECT id, type, link FROM social_media_links WHERE contact_id=$1", contactID)
+// insertContactTag tags the contact with a system tag or a personal tag of
+// userID. Other tags, and ones deleted since, e.g. of a restored revision, are
+// skipped.
+func insertContactTag(q sqlx.Execer, contactID, userID, tagID int64) error {
+	query := `
+		INSERT INTO contact_tags (contact_id, tag_id)
+		SELECT $1, id FROM tags WHERE id = $2 AND (user_id IS NULL OR user_id = $3)
+		ON CONFLICT DO NOTHING
+	`
+
+	_, err := q.Exec(query, contactID, tagID, userID)
+
+	return err
+}
+
+func listContactTags(q sqlx.Queryer, contactID int64) ([]Tag, error) {
+	tags := make([]Tag, 0)
+
+	err := sqlx.Select(q, &tags, "SELECT "+tagColumns+" FROM tags t JOIN contact_tags ct ON t.id = ct.tag_id WHERE ct.contact_id=$1 ORDER BY t.id", contactID)
 
 	if err != nil {
 		return nil, err
 	}
 
-	contact.SocialLinks = linksUpdated
+	return tags, nil
+}
+
+func listContactLinks(q sqlx.Queryer, contactID int64) ([]Link, error) {
+	links := make([]Link, 0)
+
+	err := sqlx.Select(q, &links, "SELECT id, contact_id, type, link, COALESCE(label, '') AS label FROM social_media_links WHERE contact_id=$1 ORDER BY id", contactID)
 
-	if err = tx.Commit(); err != nil {
+	if err != nil {
 		return nil, err
 	}
 
-	return &contact, nil
+	return links, nil
 }
 
 func (s *storage) GetContact(userID, id int64) (*Contact, error) {
@@ -444,9 +846,9 @@ func (s *storage) GetContact(userID, id int64) (*Contact, error) {
 	query := `
 		SELECT c.id, c.name, c.avatar, c.activity_name, c.about, c.views_amount,
 		       c.saves_amount, c.created_at, c.updated_at, c.phone_number, c.email,
-		       c.user_id, c.visibility, c.country_code, c.phone_calling_code, c.website, c.deleted_at
+		       c.user_id, c.visibility, c.country_code, c.phone_calling_code, c.website, c.deleted_at, c.version
 		FROM contacts c
-		WHERE (c.id=$1 AND c.user_id=$2) OR (c.id=$1 AND c.visibility='public')
+		WHERE c.id=$1 AND (c.user_id=$2 OR c.visibility='public') AND c.deleted_at IS NULL
 	`
 
 	err := s.pg.Get(&contact, query, id, userID)
@@ -457,41 +859,53 @@ func (s *storage) GetContact(userID, id int64) (*Contact, error) {
 		return nil, err
 	}
 
-	tags := make([]Tag, 0)
+	if err = s.fillContactDetails(&contact); err != nil {
+		return nil, err
+	}
+
+	return &contact, nil
+}
 
-	err = s.pg.Select(&tags, "SELECT t.id, t.name FROM tags t JOIN contact_tags ct ON t.id = ct.tag_id WHERE ct.contact_id=$1", id)
+// fillContactDetails loads tags, social links and address of the contact.
+func (s *storage) fillContactDetails(contact *Contact) error {
+	tags, err := listContactTags(s.pg, contact.ID)
 
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	contact.Tags = tags
-	links := make([]Link, 0)
 
-	err = s.pg.Select(&links, "SELECT id, type, link FROM social_media_links WHERE contact_id=$1", id)
+	links, err := listContactLinks(s.pg, contact.ID)
 
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	contact.SocialLinks = links
-	var address Address
 
-	err = s.pg.Get(&address, "SELECT id, external_id, contact_id, label, name, ST_AsText(location) as location, created_at, updated_at, deleted_at FROM addresses WHERE contact_id=$1", id)
+	addresses, err := listAddresses(s.pg, contact.ID)
 
-	if err != nil && IsNoRowsError(err) {
-		return &contact, nil
-	} else if err != nil {
-		return nil, err
+	if err != nil {
+		return err
 	}
 
-	contact.Address = &address
+	contact.Addresses = addresses
 
-	return &contact, nil
+	if len(addresses) > 0 && addresses[0].IsPrimary {
+		contact.Address = &addresses[0]
+	}
+
+	return nil
 }
 
 func (s *storage) SaveContact(userID, contactID int64) error {
-	_, err := s.pg.Exec("INSERT INTO saved_contacts (user_id, contact_id) VALUES ($1, $2)", userID, contactID)
+	query := `
+		INSERT INTO saved_contacts (user_id, contact_id)
+		SELECT $1, id FROM contacts WHERE id = $2 AND deleted_at IS NULL
+	`
+
+	res, err := s.pg.Exec(query, userID, contactID)
 
 	if err != nil && IsDuplicationError(err) {
 		return ErrAlreadyExists
@@ -499,6 +913,10 @@ func (s *storage) SaveContact(userID, contactID int64) error {
 		return err
 	}
 
+	if rowsAffected, _ := res.RowsAffected(); rowsAffected == 0 {
+		return ErrNotFound
+	}
+
 	return nil
 }
 
@@ -523,6 +941,7 @@ func (s *storage) ListSavedContacts(userID int64) ([]Contact, error) {
 		SELECT c.id, c.name, c.avatar, c.activity_name, c.about, c.views_amount, c.saves_amount, c.created_at, c.updated_at, c.phone_number, c.email, c.user_id
 		FROM contacts c
 		WHERE c.id IN (SELECT contact_id FROM saved_contacts WHERE user_id=$1)
+		  AND (c.visibility = 'public' OR c.user_id = $1) AND c.deleted_at IS NULL
 	`
 
 	err := s.pg.Select(&contacts, query, userID)
@@ -534,37 +953,67 @@ func (s *storage) ListSavedContacts(userID int64) ([]Contact, error) {
 	return contacts, nil
 }
 
-func (s *storage) CreateContactAddress(contactID int64, address Address) (*Address, error) {
+// ListSavedContactsDetailed returns saved contacts of the user together with
+// their tags, social links and address. Contacts made private since they were
+// saved are left out, like for GetContact.
+func (s *storage) ListSavedContactsDetailed(userID int64) ([]Contact, error) {
+	contacts := make([]Contact, 0)
+
 	query := `
-		INSERT INTO addresses
-			(external_id, contact_id, label, name, location)
-		VALUES ($1, $2, $3, $4, ST_SetSRID(ST_Point($5, $6), 4326))
-		RETURNING id, external_id, contact_id, label, name, ST_AsText(location) as location, created_at, updated_at, deleted_at
+		SELECT c.id, c.name, c.avatar, c.activity_name, c.about, c.views_amount,
+		       c.saves_amount, c.created_at, c.updated_at, c.phone_number, c.email,
+		       c.user_id, c.visibility, c.country_code, c.phone_calling_code, c.website, c.deleted_at, c.version
+		FROM contacts c
+		WHERE c.id IN (SELECT contact_id FROM saved_contacts WHERE user_id=$1)
+		  AND (c.visibility = 'public' OR c.user_id = $1) AND c.deleted_at IS NULL
+		ORDER BY c.name
 	`
 
-	err := s.pg.QueryRowx(
-		query, address.ExternalID, contactID,
-		address.Label, address.Name, address.Location.Lng,
-		address.Location.Lat,
-	).StructScan(&address)
-
-	if err != nil {
+	if err := s.pg.Select(&contacts, query, userID); err != nil {
 		return nil, err
 	}
 
-	return &address, nil
+	for i := range contacts {
+		if err := s.fillContactDetails(&contacts[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return contacts, nil
 }
 
-func (s *storage) UpdateContactVisibility(userID, contactID int64, visibility ContactVisibility) error {
-	_, err := s.pg.Exec("UPDATE contacts SET visibility=$1 WHERE id=$2 AND user_id=$3", visibility, contactID, userID)
+// UpdateContactVisibility fails with ErrConflict unless the contact is at
+// version, zero skips the check.
+func (s *storage) UpdateContactVisibility(userID, contactID int64, version int, visibility ContactVisibility) error {
+	tx, err := s.pg.Beginx()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	var previous int
+
+	query := `
+		UPDATE contacts
+		SET visibility = $1, version = version + 1, updated_at = NOW()
+		WHERE id = $2 AND user_id = $3 AND deleted_at IS NULL
+		RETURNING version - 1
+	`
+
+	err = tx.Get(&previous, query, visibility, contactID, userID)
 
 	if err != nil && IsNoRowsError(err) {
-		return fmt.Errorf("not found")
+		return ErrNotFound
 	} else if err != nil {
 		return err
 	}
 
-	return nil
+	if version != 0 && previous != version {
+		return ErrConflict
+	}
+
+	return tx.Commit()
 }
 
 func (s *storage) GetContactsByUserID(userID int64) (ContactsPage, error) {
@@ -573,7 +1022,7 @@ func (s *storage) GetContactsByUserID(userID int64) (ContactsPage, error) {
 	query := `
 		SELECT c.id, c.name, c.avatar, c.activity_name, c.about, c.views_amount, c.saves_amount, c.user_id, c.visibility
 		FROM contacts c
-		WHERE c.user_id=$1
+		WHERE c.user_id=$1 AND c.deleted_at IS NULL
 	`
 
 	rows, err := s.pg.Queryx(query, userID)
@@ -595,7 +1044,10 @@ func (s *storage) GetContactsByUserID(userID int64) (ContactsPage, error) {
 		contacts = append(contacts, c)
 	}
 
+	count := len(contacts)
+
 	contactsPage.Contacts = contacts
+	contactsPage.TotalCount = &count
 
 	return contactsPage, nil
 }
@@ -0,0 +1,96 @@
+package db
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type ContactSort string
+
+const (
+	ContactSortCreated   ContactSort = "created"
+	ContactSortUpdated   ContactSort = "updated"
+	ContactSortName      ContactSort = "name"
+	ContactSortViews     ContactSort = "views"
+	ContactSortSaves     ContactSort = "saves"
+	ContactSortDistance  ContactSort = "distance"
+	ContactSortRelevance ContactSort = "relevance"
+)
+
+func (s ContactSort) IsValid() bool {
+	switch s {
+	case ContactSortCreated, ContactSortUpdated, ContactSortName, ContactSortViews,
+		ContactSortSaves, ContactSortDistance, ContactSortRelevance:
+		return true
+	}
+
+	return false
+}
+
+// DefaultDesc reports whether the sort is descending unless asked otherwise:
+// names and distances go up, everything else goes down.
+func (s ContactSort) DefaultDesc() bool {
+	return s != ContactSortName && s != ContactSortDistance
+}
+
+// ContactCursor points at a contact of a listing, pages continue right after
+// it, or right before it when Backward is set.
+type ContactCursor struct {
+	Sort ContactSort `json:"s"`
+	Desc bool        `json:"d"`
+	// Key is the sort key of the contact in its Postgres text representation.
+	Key      string `json:"k"`
+	ID       int64  `json:"i"`
+	Backward bool   `json:"b,omitempty"`
+}
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+func (c ContactCursor) Encode() string {
+	b, _ := json.Marshal(c)
+
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func DecodeContactCursor(s string) (*ContactCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var cursor ContactCursor
+
+	if err := json.Unmarshal(b, &cursor); err != nil || !cursor.Sort.IsValid() || cursor.ID == 0 || !cursor.validKey() {
+		return nil, ErrInvalidCursor
+	}
+
+	return &cursor, nil
+}
+
+// timestampKeyLayout is the text representation of a Postgres timestamp.
+const timestampKeyLayout = "2006-01-02 15:04:05.999999"
+
+// validKey reports whether Key can be cast to the type its sort is compared
+// as, cursors come from clients and a bad cast would fail the whole query.
+func (c ContactCursor) validKey() bool {
+	switch c.Sort {
+	case ContactSortCreated, ContactSortUpdated:
+		_, err := time.Parse(timestampKeyLayout, c.Key)
+		return err == nil
+	case ContactSortViews, ContactSortSaves:
+		_, err := strconv.ParseInt(c.Key, 10, 32)
+		return err == nil
+	case ContactSortDistance, ContactSortRelevance:
+		// Go also parses hexadecimal floats, which Postgres does not
+		_, err := strconv.ParseFloat(c.Key, 64)
+		return err == nil && !strings.ContainsAny(c.Key, "xX")
+	case ContactSortName:
+		return !strings.ContainsRune(c.Key, 0)
+	}
+
+	return false
+}
@@ -0,0 +1,178 @@
+package db
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"slices"
+	"time"
+)
+
+// ContactRevision records a single update of a contact. Revisions are
+// numbered per contact starting from 1.
+type ContactRevision struct {
+	ID        int64          `db:"id" json:"id"`
+	ContactID int64          `db:"contact_id" json:"contact_id"`
+	Revision  int            `db:"revision" json:"revision"`
+	UserID    int64          `db:"user_id" json:"user_id"`
+	Changes   ContactChanges `db:"changes" json:"changes"`
+	// RestoredFrom is set when the update restored the contact to the
+	// state before the given revision.
+	RestoredFrom *int      `db:"restored_from" json:"restored_from"`
+	CreatedAt    time.Time `db:"created_at" json:"created_at"`
+} // @Name ContactRevision
+
+type FieldChange struct {
+	Old *string `json:"old"`
+	New *string `json:"new"`
+} // @Name FieldChange
+
+type TagsChange struct {
+	Old []Tag `json:"old"`
+	New []Tag `json:"new"`
+} // @Name TagsChange
+
+type LinksChange struct {
+	Old []Link `json:"old"`
+	New []Link `json:"new"`
+} // @Name LinksChange
+
+// ContactChanges holds the fields that changed, keyed by column name, and
+// the tags and social links before and after when they changed.
+type ContactChanges struct {
+	Fields      map[string]FieldChange `json:"fields,omitempty"`
+	Tags        *TagsChange            `json:"tags,omitempty"`
+	SocialLinks *LinksChange           `json:"social_links,omitempty"`
+} // @Name ContactChanges
+
+func (c ContactChanges) IsEmpty() bool {
+	return len(c.Fields) == 0 && c.Tags == nil && c.SocialLinks == nil
+}
+
+func (c ContactChanges) Value() (driver.Value, error) {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+
+	// a string, lib/pq would send []byte as bytea
+	return string(b), nil
+}
+
+func (c *ContactChanges) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case []byte:
+		return json.Unmarshal(src, c)
+	case string:
+		return json.Unmarshal([]byte(src), c)
+	}
+
+	return fmt.Errorf("cannot scan type %T into ContactChanges: %v", src, src)
+}
+
+// editableFields returns the columns of the contact that can be updated.
+func editableFields(c Contact) map[string]*string {
+	return map[string]*string{
+		"name":               &c.Name,
+		"avatar":             c.Avatar,
+		"activity_name":      c.ActivityName,
+		"website":            c.Website,
+		"country_code":       c.CountryCode,
+		"about":              c.About,
+		"phone_number":       c.PhoneNumber,
+		"phone_calling_code": c.PhoneCallingCode,
+		"email":              c.Email,
+	}
+}
+
+func diffContacts(before, after Contact) ContactChanges {
+	var changes ContactChanges
+
+	afterFields := editableFields(after)
+
+	for name, old := range editableFields(before) {
+		if updated := afterFields[name]; !equalStrings(old, updated) {
+			if changes.Fields == nil {
+				changes.Fields = make(map[string]FieldChange)
+			}
+
+			changes.Fields[name] = FieldChange{Old: old, New: updated}
+		}
+	}
+
+	tagKey := func(t Tag) string { return fmt.Sprint(t.ID) }
+	if !sameElements(before.Tags, after.Tags, tagKey) {
+		changes.Tags = &TagsChange{Old: before.Tags, New: after.Tags}
+	}
+
+	linkKey := func(l Link) string { return l.Type + "\x00" + l.Link + "\x00" + l.Label }
+	if !sameElements(before.SocialLinks, after.SocialLinks, linkKey) {
+		changes.SocialLinks = &LinksChange{Old: before.SocialLinks, New: after.SocialLinks}
+	}
+
+	return changes
+}
+
+func equalStrings(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return *a == *b
+}
+
+// sameElements compares a and b as multisets of their keys.
+func sameElements[T any](a, b []T, key func(T) string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	keysA := make([]string, len(a))
+	for i := range a {
+		keysA[i] = key(a[i])
+	}
+
+	keysB := make([]string, len(b))
+	for i := range b {
+		keysB[i] = key(b[i])
+	}
+
+	slices.Sort(keysA)
+	slices.Sort(keysB)
+
+	return slices.Equal(keysA, keysB)
+}
+
+// insertContactRevision records the changes as the next revision of the
+// contact. The contact row must be locked by the transaction.
+func insertContactRevision(q sqlx.Execer, contactID, userID int64, changes ContactChanges, restoredFrom *int) error {
+	query := `
+		INSERT INTO contact_revisions (contact_id, revision, user_id, changes, restored_from)
+		SELECT $1, COALESCE(MAX(revision), 0) + 1, $2, $3, $4
+		FROM contact_revisions
+		WHERE contact_id = $1
+	`
+
+	_, err := q.Exec(query, contactID, userID, changes, restoredFrom)
+
+	return err
+}
+
+// ListContactRevisions returns the revisions of the contact, latest first.
+func (s *storage) ListContactRevisions(contactID int64) ([]ContactRevision, error) {
+	revisions := make([]ContactRevision, 0)
+
+	query := `
+		SELECT id, contact_id, revision, user_id, changes, restored_from, created_at
+		FROM contact_revisions
+		WHERE contact_id = $1
+		ORDER BY revision DESC
+	`
+
+	if err := s.pg.Select(&revisions, query, contactID); err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
@@ -0,0 +1,108 @@
+package db
+
+import "time"
+
+type ContactViewSource string
+
+const (
+	ContactViewSourceList       ContactViewSource = "list"
+	ContactViewSourceSharedLink ContactViewSource = "shared_link"
+	ContactViewSourceQR         ContactViewSource = "qr"
+)
+
+func (s ContactViewSource) IsValid() bool {
+	switch s {
+	case ContactViewSourceList, ContactViewSourceSharedLink, ContactViewSourceQR:
+		return true
+	}
+
+	return false
+}
+
+type ContactView struct {
+	ID        int64             `db:"id" json:"id"`
+	ContactID int64             `db:"contact_id" json:"contact_id"`
+	ViewerID  *int64            `db:"viewer_id" json:"viewer_id"`
+	ViewerKey string            `db:"viewer_key" json:"-"`
+	Source    ContactViewSource `db:"source" json:"source"`
+	CreatedAt time.Time         `db:"created_at" json:"created_at"`
+}
+
+type DailyContactStats struct {
+	Date  string `db:"day" json:"date"`
+	Views int    `db:"views" json:"views"`
+	Saves int    `db:"saves" json:"saves"`
+}
+
+// RecordContactView stores a view event unless the same viewer has already
+// viewed the contact within the window. It reports whether the view was counted.
+func (s *storage) RecordContactView(view ContactView, window time.Duration) (bool, error) {
+	tx, err := s.pg.Beginx()
+	if err != nil {
+		return false, err
+	}
+
+	defer tx.Rollback()
+
+	// concurrent views of the contact by the same viewer would all see no
+	// recent view and be counted, so they are serialized
+	lock := "SELECT pg_advisory_xact_lock(hashtext('contact_views'), hashtext($1::text || '|' || $2))"
+
+	if _, err = tx.Exec(lock, view.ContactID, view.ViewerKey); err != nil {
+		return false, err
+	}
+
+	query := `
+		INSERT INTO contact_views (contact_id, viewer_id, viewer_key, source)
+		SELECT $1, $2, $3, $4
+		WHERE NOT EXISTS (
+			SELECT 1 FROM contact_views
+			WHERE contact_id = $1 AND viewer_key = $3
+			AND created_at > NOW() - make_interval(secs => $5)
+		)
+	`
+
+	res, err := tx.Exec(query, view.ContactID, view.ViewerID, view.ViewerKey, view.Source, window.Seconds())
+
+	if err != nil {
+		return false, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return false, err
+	}
+
+	rows, _ := res.RowsAffected()
+
+	return rows > 0, nil
+}
+
+// GetContactDailyStats returns the number of views and saves of the contact for
+// every day between from and to, inclusive.
+func (s *storage) GetContactDailyStats(contactID int64, from, to time.Time) ([]DailyContactStats, error) {
+	stats := make([]DailyContactStats, 0)
+
+	query := `
+		SELECT to_char(d, 'YYYY-MM-DD') AS day, COALESCE(v.views, 0) AS views, COALESCE(sv.saves, 0) AS saves
+		FROM generate_series($2::date, $3::date, interval '1 day') d
+		LEFT JOIN (
+			SELECT created_at::date AS day, COUNT(*) AS views
+			FROM contact_views
+			WHERE contact_id = $1 AND created_at >= $2::date AND created_at < $3::date + 1
+			GROUP BY 1
+		) v ON v.day = d::date
+		LEFT JOIN (
+			SELECT created_at::date AS day, COUNT(*) AS saves
+			FROM saved_contacts
+			WHERE contact_id = $1 AND created_at >= $2::date AND created_at < $3::date + 1
+			GROUP BY 1
+		) sv ON sv.day = d::date
+		ORDER BY d
+	`
+
+	if err := s.pg.Select(&stats, query, contactID, from, to); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
@@ -48,4 +48,6 @@ func (s *storage) Ping() error {
 var (
 	ErrNotFound      = errors.New("not found")
 	ErrAlreadyExists = errors.New("already exists")
+	// ErrConflict is returned when a row has changed since it was read.
+	ErrConflict = errors.New("conflict")
 )
@@ -0,0 +1,194 @@
+package db
+
+import (
+	"errors"
+	"github.com/jmoiron/sqlx"
+	"time"
+)
+
+// ErrOutboxEmailExpired is returned when requeueing an email whose code or
+// link has expired.
+var ErrOutboxEmailExpired = errors.New("email has expired")
+
+type OutboxStatus string
+
+const (
+	OutboxStatusPending OutboxStatus = "pending"
+	OutboxStatusSent    OutboxStatus = "sent"
+	OutboxStatusDead    OutboxStatus = "dead"
+)
+
+func (s OutboxStatus) IsValid() bool {
+	switch s {
+	case OutboxStatusPending, OutboxStatusSent, OutboxStatusDead:
+		return true
+	}
+
+	return false
+}
+
+type OutboxEmail struct {
+	ID            int64        `db:"id" json:"id"`
+	Sender        string       `db:"sender" json:"sender"`
+	Recipient     string       `db:"recipient" json:"recipient"`
+	Subject       string       `db:"subject" json:"subject"`
+	HtmlBody      string       `db:"html_body" json:"-"`
+	TextBody      string       `db:"text_body" json:"-"`
+	MessageStream string       `db:"message_stream" json:"message_stream"`
+	Status        OutboxStatus `db:"status" json:"status"`
+	Attempts      int          `db:"attempts" json:"attempts"`
+	LastError     *string      `db:"last_error" json:"last_error"`
+	NextAttemptAt time.Time    `db:"next_attempt_at" json:"next_attempt_at"`
+	SentAt        *time.Time   `db:"sent_at" json:"sent_at"`
+	// ExpiresAt is when the code or link in the email expires, the email is
+	// not delivered after it.
+	ExpiresAt time.Time `db:"expires_at" json:"expires_at"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+} // @Name OutboxEmail
+
+const outboxEmailColumns = `
+	id, sender, recipient, subject, html_body, text_body, message_stream, status, attempts,
+	last_error, next_attempt_at, sent_at, expires_at, created_at, updated_at
+`
+
+// insertOutboxEmail queues an email, so it can be part of the transaction
+// creating whatever the email is about.
+func insertOutboxEmail(q sqlx.Execer, email OutboxEmail) error {
+	query := `
+		INSERT INTO email_outbox (sender, recipient, subject, html_body, text_body, message_stream, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+
+	_, err := q.Exec(query, email.Sender, email.Recipient, email.Subject, email.HtmlBody, email.TextBody, email.MessageStream, email.ExpiresAt)
+
+	return err
+}
+
+// ClaimOutboxEmails picks up to limit pending emails that are due and hides
+// them from other workers for the lease duration. An email whose worker dies
+// mid-delivery is picked up again once the lease is over. Expired emails are
+// dead-lettered instead, and the bodies of all expired emails are cleared.
+func (s *storage) ClaimOutboxEmails(limit int, lease time.Duration) ([]OutboxEmail, error) {
+	emails := make([]OutboxEmail, 0)
+
+	query := `
+		WITH expired AS (
+			UPDATE email_outbox
+			SET status = 'dead',
+			    last_error = CASE WHEN status = 'pending' THEN 'expired before delivery' ELSE last_error END,
+			    html_body = '', text_body = '', updated_at = NOW()
+			WHERE expires_at <= NOW() AND html_body <> ''
+		)
+		UPDATE email_outbox
+		SET attempts = attempts + 1,
+		    next_attempt_at = NOW() + make_interval(secs => $2),
+		    updated_at = NOW()
+		WHERE id IN (
+			SELECT id FROM email_outbox
+			WHERE status = 'pending' AND next_attempt_at <= NOW() AND expires_at > NOW()
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + outboxEmailColumns
+
+	if err := s.pg.Select(&emails, query, limit, lease.Seconds()); err != nil {
+		return nil, err
+	}
+
+	return emails, nil
+}
+
+// MarkOutboxEmailSent records the delivery and clears the bodies, which
+// hold OTP codes and reset links in plain text.
+func (s *storage) MarkOutboxEmailSent(id int64) error {
+	query := `
+		UPDATE email_outbox
+		SET status = 'sent', sent_at = NOW(), last_error = NULL, html_body = '', text_body = '', updated_at = NOW()
+		WHERE id = $1
+	`
+
+	_, err := s.pg.Exec(query, id)
+
+	return err
+}
+
+// RetryOutboxEmail records a failed delivery and schedules the next attempt.
+func (s *storage) RetryOutboxEmail(id int64, lastError string, delay time.Duration) error {
+	query := `
+		UPDATE email_outbox
+		SET last_error = $2, next_attempt_at = NOW() + make_interval(secs => $3), updated_at = NOW()
+		WHERE id = $1
+	`
+
+	_, err := s.pg.Exec(query, id, lastError, delay.Seconds())
+
+	return err
+}
+
+// DeadLetterOutboxEmail gives up on an email after its last failed delivery.
+// The bodies are kept until the email expires so it can be requeued, and
+// cleared right away when it already has.
+func (s *storage) DeadLetterOutboxEmail(id int64, lastError string) error {
+	query := `
+		UPDATE email_outbox
+		SET status = 'dead', last_error = $2, updated_at = NOW(),
+		    html_body = CASE WHEN expires_at > NOW() THEN html_body ELSE '' END,
+		    text_body = CASE WHEN expires_at > NOW() THEN text_body ELSE '' END
+		WHERE id = $1
+	`
+
+	_, err := s.pg.Exec(query, id, lastError)
+
+	return err
+}
+
+func (s *storage) ListOutboxEmails(status OutboxStatus, limit, offset int) ([]OutboxEmail, error) {
+	emails := make([]OutboxEmail, 0)
+
+	query := `
+		SELECT ` + outboxEmailColumns + `
+		FROM email_outbox
+		WHERE status = $1
+		ORDER BY created_at DESC
+		LIMIT $2 OFFSET $3
+	`
+
+	if err := s.pg.Select(&emails, query, status, limit, offset); err != nil {
+		return nil, err
+	}
+
+	return emails, nil
+}
+
+// RequeueOutboxEmail puts a dead email back into the queue with a fresh
+// attempt budget. Expired emails can not be requeued, their bodies are
+// cleared instead.
+func (s *storage) RequeueOutboxEmail(id int64) (*OutboxEmail, error) {
+	var email OutboxEmail
+
+	query := `
+		UPDATE email_outbox
+		SET status = CASE WHEN expires_at > NOW() THEN 'pending'::email_outbox_status ELSE status END,
+		    attempts = CASE WHEN expires_at > NOW() THEN 0 ELSE attempts END,
+		    html_body = CASE WHEN expires_at > NOW() THEN html_body ELSE '' END,
+		    text_body = CASE WHEN expires_at > NOW() THEN text_body ELSE '' END,
+		    next_attempt_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND status = 'dead'
+		RETURNING ` + outboxEmailColumns
+
+	err := s.pg.QueryRowx(query, id).StructScan(&email)
+
+	if err != nil && IsNoRowsError(err) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	if email.Status != OutboxStatusPending {
+		return nil, ErrOutboxEmailExpired
+	}
+
+	return &email, nil
+}
@@ -0,0 +1,113 @@
+package db
+
+import "time"
+
+type PasswordReset struct {
+	ID        int64      `db:"id"`
+	UserID    int64      `db:"user_id"`
+	TokenHash string     `db:"token_hash"`
+	ExpiresAt time.Time  `db:"expires_at"`
+	UsedAt    *time.Time `db:"used_at"`
+	CreatedAt time.Time  `db:"created_at"`
+}
+
+// CreatePasswordReset stores a new reset token, invalidates all previously
+// issued tokens of the user and queues the email with the reset link.
+func (s *storage) CreatePasswordReset(reset PasswordReset, email OutboxEmail) (*PasswordReset, error) {
+	tx, err := s.pg.Beginx()
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	if _, err = tx.Exec("UPDATE password_resets SET used_at = NOW() WHERE user_id = $1 AND used_at IS NULL", reset.UserID); err != nil {
+		return nil, err
+	}
+
+	query := `
+		INSERT INTO password_resets (user_id, token_hash, expires_at)
+		VALUES ($1, $2, $3)
+		RETURNING id, user_id, token_hash, expires_at, used_at, created_at
+	`
+
+	if err = tx.QueryRowx(query, reset.UserID, reset.TokenHash, reset.ExpiresAt).StructScan(&reset); err != nil {
+		return nil, err
+	}
+
+	if err = insertOutboxEmail(tx, email); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &reset, nil
+}
+
+// CountPasswordResetsSince returns the number of reset links issued to the
+// user within the last period.
+func (s *storage) CountPasswordResetsSince(userID int64, period time.Duration) (int, error) {
+	var count int
+
+	query := `
+		SELECT COUNT(*)
+		FROM password_resets
+		WHERE user_id = $1 AND created_at > NOW() - make_interval(secs => $2)
+	`
+
+	if err := s.pg.Get(&count, query, userID, period.Seconds()); err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// ResetPassword consumes an unused, unexpired reset token, sets the new
+// password hash of its user and revokes all sessions of the user.
+func (s *storage) ResetPassword(tokenHash, passwordHash string) (int64, error) {
+	tx, err := s.pg.Beginx()
+	if err != nil {
+		return 0, err
+	}
+
+	defer tx.Rollback()
+
+	var userID int64
+
+	query := `
+		UPDATE password_resets
+		SET used_at = NOW()
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING user_id
+	`
+
+	err = tx.Get(&userID, query, tokenHash)
+
+	if err != nil && IsNoRowsError(err) {
+		return 0, ErrNotFound
+	} else if err != nil {
+		return 0, err
+	}
+
+	query = `
+		UPDATE users
+		SET password_hash = $1, updated_at = NOW(), email_verified_at = COALESCE(email_verified_at, NOW())
+		WHERE id = $2
+	`
+
+	if _, err = tx.Exec(query, passwordHash, userID); err != nil {
+		return 0, err
+	}
+
+	if _, err = tx.Exec("UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL", userID); err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return userID, nil
+}
@@ -0,0 +1,170 @@
+package db
+
+import "time"
+
+type Session struct {
+	ID                int64      `db:"id" json:"id"`
+	UserID            int64      `db:"user_id" json:"-"`
+	RefreshTokenHash  string     `db:"refresh_token_hash" json:"-"`
+	PreviousTokenHash *string    `db:"previous_token_hash" json:"-"`
+	UserAgent         *string    `db:"user_agent" json:"user_agent"`
+	IP                *string    `db:"ip" json:"ip"`
+	CreatedAt         time.Time  `db:"created_at" json:"created_at"`
+	LastUsedAt        time.Time  `db:"last_used_at" json:"last_used_at"`
+	ExpiresAt         time.Time  `db:"expires_at" json:"expires_at"`
+	RevokedAt         *time.Time `db:"revoked_at" json:"-"`
+	Current           bool       `db:"-" json:"current"`
+} // @Name Session
+
+const sessionColumns = `id, user_id, refresh_token_hash, previous_token_hash, user_agent, ip, created_at, last_used_at, expires_at, revoked_at`
+
+func (s *storage) CreateSession(session Session) (*Session, error) {
+	query := `
+		INSERT INTO sessions (user_id, refresh_token_hash, user_agent, ip, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING ` + sessionColumns
+
+	err := s.pg.QueryRowx(query, session.UserID, session.RefreshTokenHash, session.UserAgent, session.IP, session.ExpiresAt).StructScan(&session)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+// GetActiveSession returns the session if it is neither revoked nor expired.
+func (s *storage) GetActiveSession(id int64) (*Session, error) {
+	var session Session
+
+	query := `
+		SELECT ` + sessionColumns + `
+		FROM sessions
+		WHERE id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+	`
+
+	err := s.pg.Get(&session, query, id)
+
+	if err != nil && IsNoRowsError(err) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+// GetSessionByRefreshToken looks a session up by its current or previous
+// refresh token hash, regardless of whether it is still active.
+func (s *storage) GetSessionByRefreshToken(hash string) (*Session, error) {
+	var session Session
+
+	query := `
+		SELECT ` + sessionColumns + `
+		FROM sessions
+		WHERE refresh_token_hash = $1 OR previous_token_hash = $1
+		LIMIT 1
+	`
+
+	err := s.pg.Get(&session, query, hash)
+
+	if err != nil && IsNoRowsError(err) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+// RotateSession replaces the refresh token of an active session. It fails with
+// ErrNotFound when the token was already rotated by a concurrent request.
+func (s *storage) RotateSession(id int64, oldHash, newHash string, expiresAt time.Time, userAgent, ip *string) (*Session, error) {
+	var session Session
+
+	query := `
+		UPDATE sessions
+		SET refresh_token_hash = $3, previous_token_hash = $2, expires_at = $4,
+		    user_agent = $5, ip = $6, last_used_at = NOW()
+		WHERE id = $1 AND refresh_token_hash = $2
+		AND revoked_at IS NULL AND expires_at > NOW()
+		RETURNING ` + sessionColumns
+
+	err := s.pg.QueryRowx(query, id, oldHash, newHash, expiresAt, userAgent, ip).StructScan(&session)
+
+	if err != nil && IsNoRowsError(err) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+// TouchSession updates the last usage time of the session, at most once a minute.
+func (s *storage) TouchSession(id int64) error {
+	query := `
+		UPDATE sessions
+		SET last_used_at = NOW()
+		WHERE id = $1 AND last_used_at < NOW() - INTERVAL '1 minute'
+	`
+
+	if _, err := s.pg.Exec(query, id); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *storage) ListActiveSessions(userID int64) ([]Session, error) {
+	sessions := make([]Session, 0)
+
+	query := `
+		SELECT ` + sessionColumns + `
+		FROM sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+		ORDER BY last_used_at DESC
+	`
+
+	if err := s.pg.Select(&sessions, query, userID); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+func (s *storage) RevokeSession(userID, id int64) error {
+	query := `
+		UPDATE sessions
+		SET revoked_at = NOW()
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+	`
+
+	res, err := s.pg.Exec(query, id, userID)
+
+	if err != nil {
+		return err
+	}
+
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// RevokeUserSessions revokes every active session of the user except the
+// one with exceptID, pass 0 to revoke them all.
+func (s *storage) RevokeUserSessions(userID, exceptID int64) error {
+	query := `
+		UPDATE sessions
+		SET revoked_at = NOW()
+		WHERE user_id = $1 AND id <> $2 AND revoked_at IS NULL
+	`
+
+	if _, err := s.pg.Exec(query, userID, exceptID); err != nil {
+		return err
+	}
+
+	return nil
+}
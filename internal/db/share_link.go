@@ -0,0 +1,142 @@
+package db
+
+import "time"
+
+type ShareLink struct {
+	ID          int64      `db:"id" json:"id"`
+	ContactID   int64      `db:"contact_id" json:"contact_id"`
+	Token       string     `db:"token" json:"token"`
+	ExpiresAt   *time.Time `db:"expires_at" json:"expires_at"`
+	MaxViews    *int       `db:"max_views" json:"max_views"`
+	ViewsAmount int        `db:"views_amount" json:"views_amount"`
+	CreatedAt   time.Time  `db:"created_at" json:"created_at"`
+	RevokedAt   *time.Time `db:"revoked_at" json:"revoked_at"`
+} // @Name ShareLink
+
+// IsActive reports whether the link can still be used to open the contact.
+func (l ShareLink) IsActive() bool {
+	if l.RevokedAt != nil {
+		return false
+	}
+
+	if l.ExpiresAt != nil && !l.ExpiresAt.After(time.Now()) {
+		return false
+	}
+
+	return l.MaxViews == nil || l.ViewsAmount < *l.MaxViews
+}
+
+func (s *storage) CreateShareLink(link ShareLink) (*ShareLink, error) {
+	query := `
+		INSERT INTO contact_share_links (contact_id, token, expires_at, max_views)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, contact_id, token, expires_at, max_views, views_amount, created_at, revoked_at
+	`
+
+	err := s.pg.QueryRowx(query, link.ContactID, link.Token, link.ExpiresAt, link.MaxViews).StructScan(&link)
+
+	if err != nil && IsDuplicationError(err) {
+		return nil, ErrAlreadyExists
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &link, nil
+}
+
+func (s *storage) ListShareLinks(contactID int64) ([]ShareLink, error) {
+	links := make([]ShareLink, 0)
+
+	query := `
+		SELECT id, contact_id, token, expires_at, max_views, views_amount, created_at, revoked_at
+		FROM contact_share_links
+		WHERE contact_id = $1
+		ORDER BY created_at DESC
+	`
+
+	if err := s.pg.Select(&links, query, contactID); err != nil {
+		return nil, err
+	}
+
+	return links, nil
+}
+
+func (s *storage) RevokeShareLink(contactID, linkID int64) error {
+	query := `
+		UPDATE contact_share_links
+		SET revoked_at = NOW()
+		WHERE id = $1 AND contact_id = $2 AND revoked_at IS NULL
+	`
+
+	res, err := s.pg.Exec(query, linkID, contactID)
+
+	if err != nil {
+		return err
+	}
+
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// GetContactByShareToken resolves an active share token to the contact it
+// points at and counts the view against the link's limit. Links stop working
+// once revoked, expired, exhausted or when the contact is made private.
+func (s *storage) GetContactByShareToken(token string) (*Contact, error) {
+	tx, err := s.pg.Beginx()
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	var contactID int64
+
+	query := `
+		UPDATE contact_share_links
+		SET views_amount = views_amount + 1
+		WHERE token = $1
+		AND revoked_at IS NULL
+		AND (expires_at IS NULL OR expires_at > NOW())
+		AND (max_views IS NULL OR views_amount < max_views)
+		RETURNING contact_id
+	`
+
+	err = tx.Get(&contactID, query, token)
+
+	if err != nil && IsNoRowsError(err) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	var contact Contact
+
+	query = `
+		SELECT c.id, c.name, c.avatar, c.activity_name, c.about, c.views_amount,
+		       c.saves_amount, c.created_at, c.updated_at, c.phone_number, c.email,
+		       c.user_id, c.visibility, c.country_code, c.phone_calling_code, c.website, c.deleted_at, c.version
+		FROM contacts c
+		WHERE c.id = $1 AND c.visibility IN ('shared_link', 'public') AND c.deleted_at IS NULL
+	`
+
+	err = tx.Get(&contact, query, contactID)
+
+	if err != nil && IsNoRowsError(err) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	if err = s.fillContactDetails(&contact); err != nil {
+		return nil, err
+	}
+
+	return &contact, nil
+}
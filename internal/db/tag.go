@@ -1,50 +1,359 @@
 package db
 
-func (s *storage) ListTags() ([]Tag, error) {
-	rows, err := s.pg.Query("SELECT id, name FROM tags")
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+)
 
+// ErrInvalidTagParent is returned when the parent of a tag does not exist,
+// belongs to another user, or is the tag itself or one of its descendants.
+var ErrInvalidTagParent = errors.New("invalid parent tag")
+
+const tagColumns = "t.id, t.name, t.user_id, t.parent_id, t.slug, t.names, t.synonyms"
+
+// TagNames are display names of a tag by language, e.g. {"ru": "Пекарня"}.
+type TagNames map[string]string
+
+func (n TagNames) Value() (driver.Value, error) {
+	if n == nil {
+		return "{}", nil
+	}
+
+	b, err := json.Marshal(n)
 	if err != nil {
 		return nil, err
 	}
 
-	defer rows.Close()
+	return string(b), nil
+}
 
-	tags := make([]Tag, 0)
+func (n *TagNames) Scan(src interface{}) error {
+	*n = TagNames{}
+
+	switch src := src.(type) {
+	case []byte:
+		return json.Unmarshal(src, n)
+	case string:
+		return json.Unmarshal([]byte(src), n)
+	}
+
+	return fmt.Errorf("cannot scan type %T into TagNames: %v", src, src)
+}
+
+// TagSynonyms are alternative names a tag is found by.
+type TagSynonyms []string
+
+func (s TagSynonyms) Value() (driver.Value, error) {
+	return pq.StringArray(append([]string{}, s...)).Value()
+}
+
+func (s *TagSynonyms) Scan(src interface{}) error {
+	var a pq.StringArray
+	if err := a.Scan(src); err != nil {
+		return err
+	}
+
+	*s = append(TagSynonyms{}, a...)
+
+	return nil
+}
+
+var tagSlugRegexp = regexp.MustCompile(`^[\p{Ll}\p{Lm}\p{Lo}\p{M}\p{N}]+(-[\p{Ll}\p{Lm}\p{Lo}\p{M}\p{N}]+)*$`)
+
+// Slugify turns a tag name into a slug, e.g. "Food & Drinks" into
+// "food-drinks". Letters other than latin ones are kept.
+func Slugify(name string) string {
+	var b strings.Builder
+
+	dash := false
+
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsMark(r) || unicode.IsNumber(r) {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+
+	return b.String()
+}
+
+// Normalize trims the tag, derives the slug from the name when it is empty
+// and drops empty and duplicate synonyms. It returns an error describing the
+// first invalid field.
+func (t *Tag) Normalize() error {
+	if t.Name = strings.TrimSpace(t.Name); t.Name == "" {
+		return errors.New("name is required")
+	} else if len(t.Name) > 255 {
+		return errors.New("name is too long")
+	}
+
+	if t.Slug = strings.TrimSpace(t.Slug); t.Slug == "" {
+		t.Slug = Slugify(t.Name)
+	}
+
+	if !tagSlugRegexp.MatchString(t.Slug) || len(t.Slug) > 255 {
+		return fmt.Errorf("invalid slug %q", t.Slug)
+	}
 
-	for rows.Next() {
-		var tag Tag
-		if err := rows.Scan(&tag.ID, &tag.Name); err != nil {
-			return nil, err
+	for lang, name := range t.Names {
+		if t.Names[lang] = strings.TrimSpace(name); t.Names[lang] == "" {
+			delete(t.Names, lang)
 		}
-		tags = append(tags, tag)
+	}
+
+	synonyms := make(TagSynonyms, 0, len(t.Synonyms))
+
+	for _, synonym := range t.Synonyms {
+		if synonym = strings.TrimSpace(synonym); synonym != "" && !slices.Contains(synonyms, synonym) {
+			synonyms = append(synonyms, synonym)
+		}
+	}
+
+	t.Synonyms = synonyms
+
+	return nil
+}
+
+// tagSubtree selects the ids of the tags in the array param tagsParam and of
+// all their descendants, leaving out personal tags of users other than the
+// one in userParam. A zero or NULL user only sees system tags.
+func tagSubtree(tagsParam, userParam string) string {
+	return `
+		WITH RECURSIVE subtree AS (
+			SELECT id FROM tags
+			WHERE id = ANY(` + tagsParam + `) AND (user_id IS NULL OR user_id = ` + userParam + `)
+			UNION
+			SELECT t.id FROM tags t JOIN subtree s ON t.parent_id = s.id
+			WHERE t.user_id IS NULL OR t.user_id = ` + userParam + `
+		)
+		SELECT id FROM subtree
+	`
+}
+
+// ListTags returns the system tags and the personal tags of the user, system
+// tags first, with the number of contacts visible to the user.
+func (s *storage) ListTags(userID int64) ([]Tag, error) {
+	tags := make([]Tag, 0)
+
+	query := `
+		WITH RECURSIVE visible AS (
+			SELECT * FROM tags WHERE user_id IS NULL OR user_id = $1
+		), closure (ancestor_id, tag_id) AS (
+			SELECT id, id FROM visible
+			UNION
+			SELECT cl.ancestor_id, v.id FROM closure cl JOIN visible v ON v.parent_id = cl.tag_id
+		)
+		SELECT ` + tagColumns + `,
+		       (SELECT COUNT(DISTINCT ct.contact_id)
+		        FROM closure cl
+		        JOIN contact_tags ct ON ct.tag_id = cl.tag_id
+		        JOIN contacts c ON c.id = ct.contact_id
+		        WHERE cl.ancestor_id = t.id
+		          AND c.deleted_at IS NULL
+		          AND (c.visibility = 'public' OR c.user_id = $1)) AS contacts_count
+		FROM visible t
+		ORDER BY t.user_id NULLS FIRST, t.name
+	`
+
+	if err := s.pg.Select(&tags, query, userID); err != nil {
+		return nil, err
 	}
 
 	return tags, nil
 }
 
+func (s *storage) GetTag(id int64) (*Tag, error) {
+	var tag Tag
+
+	err := s.pg.Get(&tag, "SELECT "+tagColumns+" FROM tags t WHERE t.id = $1", id)
+
+	if err != nil && IsNoRowsError(err) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &tag, nil
+}
+
+// checkTagParent makes sure the parent of a personal tag is a system tag or
+// a personal tag of the same user, and the parent of a system tag is a system
+// tag. The parent of an existing tag can not be in its subtree.
+func checkTagParent(q sqlx.Queryer, tag Tag) error {
+	if tag.ParentID == nil {
+		return nil
+	}
+
+	var parentUserID *int64
+
+	err := q.QueryRowx("SELECT user_id FROM tags WHERE id = $1", *tag.ParentID).Scan(&parentUserID)
+
+	if err != nil && IsNoRowsError(err) {
+		return ErrInvalidTagParent
+	} else if err != nil {
+		return err
+	}
+
+	if parentUserID != nil && (tag.UserID == nil || *parentUserID != *tag.UserID) {
+		return ErrInvalidTagParent
+	}
+
+	if tag.ID == 0 {
+		return nil
+	}
+
+	var cycle bool
+
+	// descendants of a tag are tags of its owner, or system tags only
+	query := `SELECT $2 IN (` + tagSubtree("$1", "$3") + `)`
+
+	if err = q.QueryRowx(query, pq.Array([]int64{tag.ID}), *tag.ParentID, tag.UserID).Scan(&cycle); err != nil {
+		return err
+	}
+
+	if cycle {
+		return ErrInvalidTagParent
+	}
+
+	return nil
+}
+
+// CreateTag creates a personal tag of tag.UserID, or a system tag when it is
+// nil.
 func (s *storage) CreateTag(tag Tag) (*Tag, error) {
+	tx, err := s.pg.Beginx()
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	if err = checkTagParent(tx, tag); err != nil {
+		return nil, err
+	}
+
 	query := `
-		INSERT INTO tags (name)
-		VALUES ($1)
+		INSERT INTO tags (name, user_id, parent_id, slug, names, synonyms)
+		VALUES ($1, $2, $3, $4, $5, $6)
 		RETURNING id
 	`
 
-	if err := s.pg.QueryRow(query, tag.Name).Scan(&tag.ID); err != nil {
+	err = tx.QueryRow(query, tag.Name, tag.UserID, tag.ParentID, tag.Slug, tag.Names, tag.Synonyms).Scan(&tag.ID)
+
+	if err != nil && IsDuplicationError(err) {
+		return nil, ErrAlreadyExists
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
 		return nil, err
 	}
 
 	return &tag, nil
 }
 
-func (s *storage) DeleteTag(id int64) error {
+// UpdateTag updates the name, parent, slug, names and synonyms of the tag.
+// The owner of a tag can not be changed.
+func (s *storage) UpdateTag(tag Tag) (*Tag, error) {
+	tx, err := s.pg.Beginx()
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	err = tx.QueryRowx("SELECT user_id FROM tags WHERE id = $1 FOR UPDATE", tag.ID).Scan(&tag.UserID)
+
+	if err != nil && IsNoRowsError(err) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err = checkTagParent(tx, tag); err != nil {
+		return nil, err
+	}
+
 	query := `
-		DELETE FROM tags
+		UPDATE tags
+		SET name = $2, parent_id = $3, slug = $4, names = $5, synonyms = $6
 		WHERE id = $1
 	`
 
-	if _, err := s.pg.Exec(query, id); err != nil {
+	_, err = tx.Exec(query, tag.ID, tag.Name, tag.ParentID, tag.Slug, tag.Names, tag.Synonyms)
+
+	if err != nil && IsDuplicationError(err) {
+		return nil, ErrAlreadyExists
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &tag, nil
+}
+
+// DeleteTag detaches the tag from contacts and deletes it, its children are
+// moved to its parent. The contacts get a new version, their revisions are
+// kept as they are.
+func (s *storage) DeleteTag(id int64) error {
+	tx, err := s.pg.Beginx()
+	if err != nil {
 		return err
 	}
 
-	return nil
+	defer tx.Rollback()
+
+	query := `
+		UPDATE contacts
+		SET version = version + 1, updated_at = now()
+		WHERE id IN (SELECT contact_id FROM contact_tags WHERE tag_id = $1)
+	`
+
+	if _, err = tx.Exec(query, id); err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec("DELETE FROM contact_tags WHERE tag_id = $1", id); err != nil {
+		return err
+	}
+
+	query = `
+		UPDATE tags
+		SET parent_id = (SELECT parent_id FROM tags WHERE id = $1)
+		WHERE parent_id = $1
+	`
+
+	if _, err = tx.Exec(query, id); err != nil {
+		return err
+	}
+
+	res, err := tx.Exec("DELETE FROM tags WHERE id = $1", id)
+
+	if err != nil {
+		return err
+	}
+
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		return ErrNotFound
+	}
+
+	return tx.Commit()
 }
@@ -0,0 +1,104 @@
+package db
+
+// TagSuggestion is a tag proposed for a contact.
+type TagSuggestion struct {
+	Tag
+	Score float64 `db:"score" json:"score"`
+	// Reason is "text" when the tag, one of its synonyms or localized names
+	// occurs in the activity or about of the contact, and "related" when it
+	// is only common on similar contacts.
+	Reason string `db:"reason" json:"reason"`
+} // @Name TagSuggestion
+
+// SuggestTags returns the tags visible to the user matching the query,
+// tags whose name starts with the query first, then the most used ones. The
+// name, slug, synonyms and localized names are matched by prefix, and the
+// name by word similarity to tolerate typos.
+func (s *storage) SuggestTags(userID int64, q string, limit int) ([]Tag, error) {
+	tags := make([]Tag, 0)
+
+	query := `
+		SELECT ` + tagColumns + `, u.count AS contacts_count
+		FROM tags t
+		CROSS JOIN LATERAL (
+			SELECT COUNT(*)::int AS count
+			FROM contact_tags ct
+			JOIN contacts c ON c.id = ct.contact_id
+			WHERE ct.tag_id = t.id
+			  AND c.deleted_at IS NULL
+			  AND (c.visibility = 'public' OR c.user_id = $1)
+		) u
+		WHERE (t.user_id IS NULL OR t.user_id = $1)
+		  AND (starts_with(lower(t.name), lower($2))
+		       OR starts_with(t.slug, lower($2))
+		       OR EXISTS (SELECT 1 FROM unnest(t.synonyms) term WHERE starts_with(lower(term), lower($2)))
+		       OR EXISTS (SELECT 1 FROM jsonb_each_text(t.names) n WHERE starts_with(lower(n.value), lower($2)))
+		       OR $2 <% t.name)
+		ORDER BY starts_with(lower(t.name), lower($2)) DESC, u.count DESC, word_similarity($2, t.name) DESC, t.name
+		LIMIT $3
+	`
+
+	if err := s.pg.Select(&tags, query, userID, q, limit); err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+// SuggestContactTags proposes tags visible to the user for the contact. Tags
+// occurring in the activity or about of the contact score 1, and tags of
+// similar contacts, ones sharing a tag or with a similar activity, score the
+// share of similar contacts having them. Tags of the contact are left out.
+func (s *storage) SuggestContactTags(userID, contactID int64, limit int) ([]TagSuggestion, error) {
+	suggestions := make([]TagSuggestion, 0)
+
+	query := `
+		WITH contact AS (
+			SELECT c.id, c.activity_name,
+			       to_tsvector('simple', coalesce(c.activity_name, '') || ' ' || coalesce(c.about, '')) AS document
+			FROM contacts c
+			WHERE c.id = $1
+		), similar AS (
+			SELECT o.id
+			FROM contacts o, contact
+			WHERE o.id <> contact.id
+			  AND o.deleted_at IS NULL
+			  AND (o.visibility = 'public' OR o.user_id = $2)
+			  AND (o.activity_name % contact.activity_name
+			       OR EXISTS (SELECT 1
+			                  FROM contact_tags a
+			                  JOIN contact_tags b ON a.tag_id = b.tag_id
+			                  WHERE a.contact_id = o.id AND b.contact_id = contact.id))
+			LIMIT 200
+		), matches AS (
+			SELECT t.id AS tag_id, 1.0::float8 AS score, true AS text
+			FROM tags t, contact
+			WHERE (t.user_id IS NULL OR t.user_id = $2)
+			  AND EXISTS (SELECT 1
+			              FROM unnest(t.name || t.synonyms || ARRAY(SELECT value FROM jsonb_each_text(t.names))) term
+			              WHERE contact.document @@ phraseto_tsquery('simple', term))
+			UNION ALL
+			SELECT ct.tag_id, COUNT(*)::float8 / (SELECT COUNT(*) FROM similar), false
+			FROM similar sc
+			JOIN contact_tags ct ON ct.contact_id = sc.id
+			GROUP BY ct.tag_id
+		)
+		SELECT ` + tagColumns + `, m.score, m.reason
+		FROM (
+			SELECT tag_id, SUM(score) AS score, CASE WHEN bool_or(text) THEN 'text' ELSE 'related' END AS reason
+			FROM matches
+			GROUP BY tag_id
+		) m
+		JOIN tags t ON t.id = m.tag_id
+		WHERE (t.user_id IS NULL OR t.user_id = $2)
+		  AND NOT EXISTS (SELECT 1 FROM contact_tags ct WHERE ct.contact_id = $1 AND ct.tag_id = t.id)
+		ORDER BY m.score DESC, t.name
+		LIMIT $3
+	`
+
+	if err := s.pg.Select(&suggestions, query, contactID, userID, limit); err != nil {
+		return nil, err
+	}
+
+	return suggestions, nil
+}
@@ -10,26 +10,28 @@ type User struct {
 	UpdatedAt       time.Time  `db:"updated_at" json:"updated_at"`
 	EmailVerifiedAt *time.Time `db:"email_verified_at" json:"email_verified_at"`
 	DeleteAt        *time.Time `db:"deleted_at" json:"deleted_at"`
+	Language        *string    `db:"language" json:"language"`
 } //@Name User
 
 type OTP struct {
 	ID        int64     `db:"id"`
 	UserID    int64     `db:"user_id"`
-	OTPCode   string    `db:"otp_code"`
+	CodeHash  string    `db:"code_hash"`
 	ExpiresAt time.Time `db:"expires_at"`
 	CreatedAt time.Time `db:"created_at"`
 	IsUsed    bool      `db:"is_used"`
+	Attempts  int       `db:"attempts"`
 }
 
 func (s *storage) CreateUser(user User) (*User, error) {
 	query := `
 		INSERT INTO users
-		   (email, password_hash, created_at, updated_at, email_verified_at)
-		VALUES ($1, $2, NOW(), NOW(), $3)
-		RETURNING id, email, password_hash, created_at, updated_at, email_verified_at, deleted_at
+		   (email, password_hash, created_at, updated_at, email_verified_at, language)
+		VALUES ($1, $2, NOW(), NOW(), $3, $4)
+		RETURNING id, email, password_hash, created_at, updated_at, email_verified_at, deleted_at, language
 	`
 
-	err := s.pg.QueryRowx(query, user.Email, user.PasswordHash, user.EmailVerifiedAt).StructScan(&user)
+	err := s.pg.QueryRowx(query, user.Email, user.PasswordHash, user.EmailVerifiedAt, user.Language).StructScan(&user)
 
 	if err != nil {
 		return nil, err
@@ -42,7 +44,7 @@ func (s *storage) GetUserByEmail(email string) (*User, error) {
 	var user User
 
 	query := `
-		SELECT id, email, password_hash, created_at, updated_at, email_verified_at, deleted_at
+		SELECT id, email, password_hash, created_at, updated_at, email_verified_at, deleted_at, language
 		FROM users
 		WHERE email = $1
 	`
@@ -84,13 +86,19 @@ func (s *storage) SetOTPIsUsed(otpID int64) error {
 	query := `
 		UPDATE otps
 		SET is_used = true
-		WHERE id = $1
+		WHERE id = $1 AND is_used = false
 	`
 
-	if _, err := s.pg.Exec(query, otpID); err != nil {
+	res, err := s.pg.Exec(query, otpID)
+
+	if err != nil {
 		return err
 	}
 
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		return ErrNotFound
+	}
+
 	return nil
 }
 
@@ -108,16 +116,33 @@ func (s *storage) UpdateUserVerified(userID int64) error {
 	return nil
 }
 
-func (s *storage) GetOTPByCode(code string, userID int64) (*OTP, error) {
+func (s *storage) UpdateUserLanguage(userID int64, language string) error {
+	query := `
+		UPDATE users
+		SET language = $2, updated_at = NOW()
+		WHERE id = $1
+	`
+
+	if _, err := s.pg.Exec(query, userID, language); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetActiveOTP returns the latest unused and unexpired OTP of the user.
+func (s *storage) GetActiveOTP(userID int64) (*OTP, error) {
 	var otp OTP
 
 	query := `
-		SELECT id, user_id, otp_code, expires_at, created_at, is_used
+		SELECT id, user_id, code_hash, expires_at, created_at, is_used, attempts
 		FROM otps
-		WHERE otp_code = $1 AND user_id = $2
+		WHERE user_id = $1 AND is_used = false AND expires_at > NOW()
+		ORDER BY created_at DESC
+		LIMIT 1
 	`
 
-	err := s.pg.Get(&otp, query, code, userID)
+	err := s.pg.Get(&otp, query, userID)
 
 	if err != nil && IsNoRowsError(err) {
 		return nil, ErrNotFound
@@ -128,30 +153,127 @@ func (s *storage) GetOTPByCode(code string, userID int64) (*OTP, error) {
 	return &otp, nil
 }
 
-func (s *storage) CreateOTP(otp OTP) (*OTP, error) {
+// CreateOTP stores a new OTP valid for ttl, invalidates all codes
+// previously issued to the user and queues the email delivering the code.
+func (s *storage) CreateOTP(userID int64, codeHash string, ttl time.Duration, email OutboxEmail) (*OTP, error) {
+	tx, err := s.pg.Beginx()
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	if _, err = tx.Exec("UPDATE otps SET is_used = true WHERE user_id = $1 AND is_used = false", userID); err != nil {
+		return nil, err
+	}
+
+	var otp OTP
+
 	query := `
 		INSERT INTO otps
-		   (user_id, otp_code, expires_at, created_at, is_used)
-		VALUES ($1, $2, $3, NOW(), false)
-		RETURNING id
+		   (user_id, code_hash, expires_at, created_at, is_used)
+		VALUES ($1, $2, NOW() + make_interval(secs => $3), NOW(), false)
+		RETURNING id, user_id, code_hash, expires_at, created_at, is_used, attempts
 	`
 
-	err := s.pg.Get(&otp.ID, query, otp.UserID, otp.OTPCode, otp.ExpiresAt)
+	if err = tx.QueryRowx(query, userID, codeHash, ttl.Seconds()).StructScan(&otp); err != nil {
+		return nil, err
+	}
 
-	if err != nil && IsNoRowsError(err) {
-		return nil, ErrNotFound
-	} else if err != nil {
+	if err = insertOutboxEmail(tx, email); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
 		return nil, err
 	}
 
 	return &otp, nil
 }
 
+// IncrementOTPAttempts counts a failed verification attempt and returns the
+// new number of attempts.
+func (s *storage) IncrementOTPAttempts(otpID int64) (int, error) {
+	var attempts int
+
+	query := `
+		UPDATE otps
+		SET attempts = attempts + 1
+		WHERE id = $1
+		RETURNING attempts
+	`
+
+	if err := s.pg.Get(&attempts, query, otpID); err != nil {
+		return 0, err
+	}
+
+	return attempts, nil
+}
+
+// CountOTPsSince returns the number of OTPs issued to the user within the
+// last period.
+func (s *storage) CountOTPsSince(userID int64, period time.Duration) (int, error) {
+	var count int
+
+	query := `
+		SELECT COUNT(*)
+		FROM otps
+		WHERE user_id = $1 AND created_at > NOW() - make_interval(secs => $2)
+	`
+
+	if err := s.pg.Get(&count, query, userID, period.Seconds()); err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// LockUserOTP forbids the user to request or verify OTPs for the given
+// duration and invalidates the codes already issued.
+func (s *storage) LockUserOTP(userID int64, duration time.Duration) error {
+	tx, err := s.pg.Beginx()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if _, err = tx.Exec("UPDATE users SET otp_locked_until = NOW() + make_interval(secs => $2) WHERE id = $1", userID, duration.Seconds()); err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec("UPDATE otps SET is_used = true WHERE user_id = $1 AND is_used = false", userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *storage) IsUserOTPLocked(userID int64) (bool, error) {
+	var locked bool
+
+	query := `
+		SELECT otp_locked_until IS NOT NULL AND otp_locked_until > NOW()
+		FROM users
+		WHERE id = $1
+	`
+
+	err := s.pg.Get(&locked, query, userID)
+
+	if err != nil && IsNoRowsError(err) {
+		return false, ErrNotFound
+	} else if err != nil {
+		return false, err
+	}
+
+	return locked, nil
+}
+
 func (s *storage) GetUserByID(userID int64) (*User, error) {
 	var user User
 
 	query := `
-		SELECT id, email, password_hash, created_at, updated_at, email_verified_at, deleted_at
+		SELECT id, email, password_hash, created_at, updated_at, email_verified_at, deleted_at, language
 		FROM users
 		WHERE id = $1
 	`
@@ -0,0 +1,133 @@
+// Package emails renders transactional emails from localized templates.
+package emails
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"strings"
+	texttemplate "text/template"
+)
+
+type Message struct {
+	Subject string
+	HTML    string
+	Text    string
+}
+
+type email struct {
+	html *htmltemplate.Template
+	text *texttemplate.Template
+}
+
+// Registry holds all email templates, parsed once, keyed by locale and name.
+type Registry struct {
+	defaultLocale string
+	emails        map[string]map[string]email
+}
+
+// NewRegistry parses the <locale>/<name>.gohtml and <locale>/<name>.gotxt
+// templates of fsys. Every email must exist in the default locale, other
+// locales may translate any subset of them.
+func NewRegistry(fsys fs.FS, defaultLocale string) (*Registry, error) {
+	r := &Registry{
+		defaultLocale: normalizeLocale(defaultLocale),
+		emails:        make(map[string]map[string]email),
+	}
+
+	htmlFiles, err := fs.Glob(fsys, "*/*.gohtml")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range htmlFiles {
+		locale := normalizeLocale(path.Dir(file))
+		name := strings.TrimSuffix(path.Base(file), ".gohtml")
+
+		html, err := htmltemplate.ParseFS(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+
+		textFile := strings.TrimSuffix(file, ".gohtml") + ".gotxt"
+
+		text, err := texttemplate.ParseFS(fsys, textFile)
+		if err != nil {
+			return nil, fmt.Errorf("email %s: plain-text version: %w", file, err)
+		}
+
+		if text.Lookup("subject") == nil {
+			return nil, fmt.Errorf("email %s: %s does not define a subject", file, textFile)
+		}
+
+		if r.emails[locale] == nil {
+			r.emails[locale] = make(map[string]email)
+		}
+
+		r.emails[locale][name] = email{html: html, text: text}
+	}
+
+	for locale, emails := range r.emails {
+		for name := range emails {
+			if _, ok := r.emails[r.defaultLocale][name]; !ok {
+				return nil, fmt.Errorf("email %s/%s has no %s version", locale, name, r.defaultLocale)
+			}
+		}
+	}
+
+	return r, nil
+}
+
+// Render executes the email in the closest available locale, e.g. "pt-BR"
+// falls back to "pt" and then to the default locale.
+func (r *Registry) Render(name, locale string, data any) (*Message, error) {
+	e, ok := r.lookup(name, locale)
+	if !ok {
+		return nil, fmt.Errorf("unknown email %q", name)
+	}
+
+	var subject, text, html bytes.Buffer
+
+	if err := e.text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return nil, err
+	}
+
+	if err := e.text.Execute(&text, data); err != nil {
+		return nil, err
+	}
+
+	if err := e.html.Execute(&html, data); err != nil {
+		return nil, err
+	}
+
+	return &Message{
+		Subject: strings.TrimSpace(subject.String()),
+		HTML:    html.String(),
+		Text:    strings.TrimSpace(text.String()) + "\n",
+	}, nil
+}
+
+func (r *Registry) lookup(name, locale string) (email, bool) {
+	locale = normalizeLocale(locale)
+
+	candidates := []string{locale}
+	if base, _, found := strings.Cut(locale, "-"); found {
+		candidates = append(candidates, base)
+	}
+
+	candidates = append(candidates, r.defaultLocale)
+
+	for _, l := range candidates {
+		if e, ok := r.emails[l][name]; ok {
+			return e, true
+		}
+	}
+
+	return email{}, false
+}
+
+func normalizeLocale(locale string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"))
+}
@@ -0,0 +1,37 @@
+package handler
+
+import (
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"strconv"
+	"touchly/internal/terrors"
+)
+
+// ListContactClustersHandler godoc
+// @Summary      List contact clusters
+// @Description  aggregate public contacts with addresses within the bbox into clusters for a map
+// @Tags         contacts
+// @Accept       json
+// @Produce      json
+// @Param        bbox   query    string  true   "minLng,minLat,maxLng,maxLat"
+// @Param        zoom   query    int     true   "map zoom level, 0-22"
+// @Param        tag    query    []int   false  "tag id"
+// @Success      200  {array}   db.ContactCluster
+// @Router       /api/contacts/clusters [get]
+func (tr *transport) ListContactClustersHandler(c echo.Context) error {
+	zoom, err := strconv.Atoi(c.QueryParam("zoom"))
+
+	if err != nil {
+		return terrors.InvalidRequest(err, "zoom is required")
+	}
+
+	tagIDs, _ := queryToIntArray(c.QueryParam("tag"))
+
+	clusters, err := tr.api.ListContactClusters(getUserID(c), c.QueryParam("bbox"), zoom, tagIDs)
+
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, clusters)
+}
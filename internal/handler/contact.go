@@ -2,8 +2,11 @@ package handler
 
 import (
 	"errors"
+	"fmt"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/labstack/echo/v4"
+	"io"
+	"mime"
 	"net/http"
 	"strconv"
 	"strings"
@@ -27,6 +30,37 @@ func mustUserID(c echo.Context) (int64, error) {
 	return claims.UserID, nil
 }
 
+// getClaims returns the claims of the request token, or empty claims when
+// there are none.
+func getClaims(c echo.Context) api2.JWTClaims {
+	user, ok := c.Get("user").(*jwt.Token)
+
+	if !ok {
+		return api2.JWTClaims{}
+	}
+
+	claims, ok := user.Claims.(*api2.JWTClaims)
+
+	if !ok || claims == nil {
+		return api2.JWTClaims{}
+	}
+
+	return *claims
+}
+
+// getUserID returns the ID of the authenticated user or 0 for anonymous requests.
+func getUserID(c echo.Context) int64 {
+	return getClaims(c).UserID
+}
+
+func getViewer(c echo.Context) api2.Viewer {
+	return api2.Viewer{
+		UserID:    getUserID(c),
+		IP:        c.RealIP(),
+		UserAgent: c.Request().UserAgent(),
+	}
+}
+
 // CreateContactHandler godoc
 // @Summary      Create contact
 // @Description  create contact
@@ -67,21 +101,38 @@ func (tr *transport) CreateContactHandler(c echo.Context) error {
 // @Tags         contacts
 // @Accept       json
 // @Produce      json
-// @Param        id   path     int     true  "contact id"
+// @Param        id       path     int     true   "contact id"
+// @Param        source   query    string  false  "where the contact was opened from: list (default) or qr"
+// @Param        If-None-Match   header   string  false  "ETag of a cached copy"
 // @Success      200  {object}   db.Contact
+// @Success      304  {object}   nil
+// @Header       200  {string}   ETag  "version of the contact"
 // @Router       /api/contacts/{id} [get]
 func (tr *transport) GetContactHandler(c echo.Context) error {
 	id, _ := getID(c)
 
-	userID, err := mustUserID(c)
+	source := db.ContactViewSourceList
+	if c.QueryParam("source") == string(db.ContactViewSourceQR) {
+		source = db.ContactViewSourceQR
+	}
+
+	viewer := getViewer(c)
+
+	contact, err := tr.api.GetContact(viewer.UserID, id)
 
 	if err != nil {
 		return err
 	}
 
-	contact, err := tr.api.GetContact(userID, id)
+	etag := contactETag(contact.Version)
+	c.Response().Header().Set("ETag", etag)
 
-	if err != nil {
+	if etagMatches(c.Request().Header.Get("If-None-Match"), etag) {
+		return c.NoContent(http.StatusNotModified)
+	}
+
+	// only views that send the contact are counted
+	if err = tr.api.ViewContact(viewer, contact, source); err != nil {
 		return err
 	}
 
@@ -95,8 +146,10 @@ func (tr *transport) GetContactHandler(c echo.Context) error {
 // @Accept       json
 // @Produce      json
 // @Param        id   path     int     true  "contact id"
+// @Param        If-Match  header   string  true  "ETag of the contact the update is based on"
 // @Param        contact   body     UpdateContactRequest     true  "contact"
-// @Success      200  {object}   nil
+// @Success      200  {object}   db.Contact
+// @Failure      412  {object}   db.Contact  "the contact has been modified, the current one is returned"
 // @Security     JWT
 // @Router       /api/contacts/{id} [put]
 func (tr *transport) UpdateContactHandler(c echo.Context) error {
@@ -112,18 +165,86 @@ func (tr *transport) UpdateContactHandler(c echo.Context) error {
 	}
 	cID, _ := strconv.ParseInt(c.Param("id"), 10, 64)
 
-	res, err := tr.api.UpdateContact(userID, cID, contact)
+	version, err := ifMatchVersion(c)
+
+	if err != nil {
+		return tr.contactConflict(c, userID, cID, err)
+	}
+
+	res, err := tr.api.UpdateContact(userID, cID, version, contact)
+
+	if err != nil {
+		return tr.contactConflict(c, userID, cID, err)
+	}
+
+	c.Response().Header().Set("ETag", contactETag(res.Version))
+
+	return c.JSON(http.StatusOK, res)
+}
+
+// maxPatchSize limits the size of a contact patch.
+const maxPatchSize = 1 << 20
+
+// PatchContactHandler godoc
+// @Summary      Patch contact
+// @Description  partially update contact with a JSON Merge Patch (RFC 7386), where null clears a field, or a JSON Patch (RFC 6902), which can also edit the tags and social_links arrays
+// @Tags         contacts
+// @Accept       application/merge-patch+json
+// @Accept       application/json-patch+json
+// @Produce      json
+// @Param        id   path     int     true  "contact id"
+// @Param        If-Match  header   string  true  "ETag of the contact the patch is based on"
+// @Param        patch     body     object  true  "merge patch or json patch"
+// @Success      200  {object}   db.Contact
+// @Failure      412  {object}   db.Contact  "the contact has been modified, the current one is returned"
+// @Failure      413  {object}   nil  "the patch is larger than 1 MB"
+// @Failure      415  {object}   nil
+// @Security     JWT
+// @Router       /api/contacts/{id} [patch]
+func (tr *transport) PatchContactHandler(c echo.Context) error {
+	userID, err := mustUserID(c)
 
 	if err != nil {
 		return err
 	}
+	cID, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+
+	contentType, _, err := mime.ParseMediaType(c.Request().Header.Get(echo.HeaderContentType))
+
+	if err != nil || (contentType != api2.MergePatchContentType && contentType != api2.JSONPatchContentType) {
+		return terrors.UnsupportedMediaType(err, "content type must be "+api2.MergePatchContentType+" or "+api2.JSONPatchContentType)
+	}
+
+	version, err := ifMatchVersion(c)
+
+	if err != nil {
+		return tr.contactConflict(c, userID, cID, err)
+	}
+
+	patch, err := io.ReadAll(http.MaxBytesReader(c.Response(), c.Request().Body, maxPatchSize))
+
+	var tooLarge *http.MaxBytesError
+
+	if err != nil && errors.As(err, &tooLarge) {
+		return terrors.RequestEntityTooLarge(err, fmt.Sprintf("patch is larger than %d MB", maxPatchSize>>20))
+	} else if err != nil {
+		return terrors.InvalidRequest(err, "failed to read patch")
+	}
+
+	res, err := tr.api.PatchContact(userID, cID, version, contentType, patch)
+
+	if err != nil {
+		return tr.contactConflict(c, userID, cID, err)
+	}
+
+	c.Response().Header().Set("ETag", contactETag(res.Version))
 
 	return c.JSON(http.StatusOK, res)
 }
 
 // DeleteContactHandler godoc
 // @Summary      Delete contact
-// @Description  delete contact
+// @Description  move contact to the trash, it can be restored until the retention period ends
 // @Tags         contacts
 // @Accept       json
 // @Produce      json
@@ -147,6 +268,59 @@ func (tr *transport) DeleteContactHandler(c echo.Context) error {
 	return c.NoContent(http.StatusOK)
 }
 
+// RestoreContactHandler godoc
+// @Summary      Restore contact
+// @Description  restore contact from the trash
+// @Tags         contacts
+// @Accept       json
+// @Produce      json
+// @Param        id   path     int     true  "contact id"
+// @Success      200  {object}   db.Contact
+// @Security     JWT
+// @Router       /api/contacts/{id}/restore [post]
+func (tr *transport) RestoreContactHandler(c echo.Context) error {
+	id, _ := getID(c)
+
+	userID, err := mustUserID(c)
+
+	if err != nil {
+		return err
+	}
+
+	contact, err := tr.api.RestoreContact(userID, id)
+
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, contact)
+}
+
+// ListDeletedContactsHandler godoc
+// @Summary      List deleted contacts
+// @Description  list contacts in the trash of the user, most recently deleted first
+// @Tags         contacts
+// @Accept       json
+// @Produce      json
+// @Success      200  {array}   db.Contact
+// @Security     JWT
+// @Router       /api/me/trash [get]
+func (tr *transport) ListDeletedContactsHandler(c echo.Context) error {
+	userID, err := mustUserID(c)
+
+	if err != nil {
+		return err
+	}
+
+	contacts, err := tr.api.ListDeletedContacts(userID)
+
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, contacts)
+}
+
 func queryToIntArray(query string) ([]int, error) {
 	if query == "" {
 		return nil, nil
@@ -177,11 +351,17 @@ func queryToIntArray(query string) ([]int, error) {
 // @Success      200  {object} db.ContactsPage
 // @Param        page      query    int     false  "page number (default 1)"
 // @Param        page_size query    int     false  "page size (default 20)"
-// @Param		 search    query    string  false  "search query, search by name or activity"
+// @Param		 search    query    string  false  "web search query over name, activity, about, tags and social handles, results are ranked by relevance"
 // @Param		 tag       query    []int   false  "tag id"
 // @Param 		 lat       query    float64 false  "latitude"
 // @Param		 lng       query    float64 false  "longitude"
 // @Param        radius    query    int     false  "radius in km"
+// @Param        radius_m  query    number  false  "radius in metres, takes precedence over radius"
+// @Param        bbox      query    string  false  "minLng,minLat,maxLng,maxLat, only contacts with an address in the box"
+// @Param        sort      query    string  false  "created, updated, name, views, saves, distance or relevance (default relevance when searching, created otherwise)"
+// @Param        order     query    string  false  "asc or desc, the default depends on sort"
+// @Param        cursor    query    string  false  "next_cursor or prev_cursor of a previous page, replaces page"
+// @Param        count     query    bool    false  "set to false to skip computing total_count"
 // @Router       /api/contacts [get]
 func (tr *transport) ListContactsHandler(c echo.Context) error {
 	page, _ := strconv.Atoi(c.QueryParam("page"))
@@ -202,8 +382,25 @@ func (tr *transport) ListContactsHandler(c echo.Context) error {
 	lng, _ := strconv.ParseFloat(c.QueryParam("lng"), 64)
 
 	radius, _ := strconv.Atoi(c.QueryParam("radius"))
-
-	contacts, err := tr.api.ListContacts(userID, tagIDs, search, lat, lng, radius, page, pageSize)
+	radiusMeters, _ := strconv.ParseFloat(c.QueryParam("radius_m"), 64)
+
+	request := api2.ListContactsRequest{
+		TagIDs:       tagIDs,
+		Search:       search,
+		Lat:          lat,
+		Lng:          lng,
+		Radius:       radius,
+		RadiusMeters: radiusMeters,
+		BBox:         c.QueryParam("bbox"),
+		Page:         page,
+		PageSize:     pageSize,
+		Sort:         db.ContactSort(c.QueryParam("sort")),
+		Order:        c.QueryParam("order"),
+		Cursor:       c.QueryParam("cursor"),
+		SkipCount:    c.QueryParam("count") == "false",
+	}
+
+	contacts, err := tr.api.ListContacts(userID, request)
 
 	if err != nil {
 		return err
@@ -301,10 +498,12 @@ func (tr *transport) DeleteSavedContactHandler(c echo.Context) error {
 // @Accept       json
 // @Produce      json
 // @Param        id		path     int     true  "contact id"
+// @Param        If-Match  header   string  true  "ETag of the contact"
 // @Param        address   body     CreateAddressRequest     true  "address"
 // @Success      201  {object}   db.Address
+// @Failure      412  {object}   db.Contact  "the contact has been modified, the current one is returned"
 // @Security     JWT
-// @Router       /api/contacts/{id}/address [post]
+// @Router       /api/contacts/{id}/addresses [post]
 func (tr *transport) CreateContactAddressHandler(c echo.Context) error {
 	var address api2.CreateAddressRequest
 	if err := c.Bind(&address); err != nil {
@@ -322,14 +521,109 @@ func (tr *transport) CreateContactAddressHandler(c echo.Context) error {
 	}
 	contactID, _ := getID(c)
 
-	createdAddress, err := tr.api.CreateContactAddress(userID, contactID, address)
+	version, err := ifMatchVersion(c)
+
 	if err != nil {
-		return err
+		return tr.contactConflict(c, userID, contactID, err)
+	}
+
+	createdAddress, err := tr.api.CreateContactAddress(userID, contactID, version, address)
+	if err != nil {
+		return tr.contactConflict(c, userID, contactID, err)
 	}
 
+	setNextContactETag(c, version)
+
 	return c.JSON(http.StatusCreated, createdAddress)
 }
 
+// UpdateContactAddressHandler godoc
+// @Summary      Update contact address
+// @Description  update contact address, is_primary=true makes it the primary address
+// @Tags         contacts
+// @Accept       json
+// @Produce      json
+// @Param        id		path     int     true  "contact id"
+// @Param        addressId   path     int     true  "address id"
+// @Param        If-Match  header   string  true  "ETag of the contact"
+// @Param        address   body     CreateAddressRequest     true  "address"
+// @Success      200  {object}   db.Address
+// @Failure      412  {object}   db.Contact  "the contact has been modified, the current one is returned"
+// @Security     JWT
+// @Router       /api/contacts/{id}/addresses/{addressId} [put]
+func (tr *transport) UpdateContactAddressHandler(c echo.Context) error {
+	var address api2.CreateAddressRequest
+	if err := c.Bind(&address); err != nil {
+		return err
+	}
+
+	if err := c.Validate(address); err != nil {
+		return err
+	}
+
+	userID, err := mustUserID(c)
+
+	if err != nil {
+		return err
+	}
+
+	contactID, _ := getID(c)
+	addressID, _ := strconv.ParseInt(c.Param("addressId"), 10, 64)
+
+	version, err := ifMatchVersion(c)
+
+	if err != nil {
+		return tr.contactConflict(c, userID, contactID, err)
+	}
+
+	updatedAddress, err := tr.api.UpdateContactAddress(userID, contactID, addressID, version, address)
+	if err != nil {
+		return tr.contactConflict(c, userID, contactID, err)
+	}
+
+	setNextContactETag(c, version)
+
+	return c.JSON(http.StatusOK, updatedAddress)
+}
+
+// DeleteContactAddressHandler godoc
+// @Summary      Delete contact address
+// @Description  delete contact address, the oldest remaining address becomes primary
+// @Tags         contacts
+// @Accept       json
+// @Produce      json
+// @Param        id		path     int     true  "contact id"
+// @Param        addressId   path     int     true  "address id"
+// @Param        If-Match  header   string  true  "ETag of the contact"
+// @Success      204  {object}   nil
+// @Failure      412  {object}   db.Contact  "the contact has been modified, the current one is returned"
+// @Security     JWT
+// @Router       /api/contacts/{id}/addresses/{addressId} [delete]
+func (tr *transport) DeleteContactAddressHandler(c echo.Context) error {
+	userID, err := mustUserID(c)
+
+	if err != nil {
+		return err
+	}
+
+	contactID, _ := getID(c)
+	addressID, _ := strconv.ParseInt(c.Param("addressId"), 10, 64)
+
+	version, err := ifMatchVersion(c)
+
+	if err != nil {
+		return tr.contactConflict(c, userID, contactID, err)
+	}
+
+	if err := tr.api.DeleteContactAddress(userID, contactID, addressID, version); err != nil {
+		return tr.contactConflict(c, userID, contactID, err)
+	}
+
+	setNextContactETag(c, version)
+
+	return c.NoContent(http.StatusNoContent)
+}
+
 type UpdateContactVisibilityRequest struct {
 	Visibility db.ContactVisibility `json:"visibility" example:"public"`
 }
@@ -341,8 +635,10 @@ type UpdateContactVisibilityRequest struct {
 // @Accept       json
 // @Produce      json
 // @Param        id   path     int     true  "contact id"
+// @Param        If-Match  header   string  true  "ETag of the contact"
 // @Param		 account	   body	   handler.UpdateContactVisibilityRequest	true	"visibility"
 // @Success      200  {object}   nil
+// @Failure      412  {object}   db.Contact  "the contact has been modified, the current one is returned"
 // @Security     JWT
 // @Router       /api/contacts/{id}/visibility [put]
 func (tr *transport) UpdateContactVisibilityHandler(c echo.Context) error {
@@ -359,10 +655,18 @@ func (tr *transport) UpdateContactVisibilityHandler(c echo.Context) error {
 
 	cID, _ := strconv.ParseInt(c.Param("id"), 10, 64)
 
-	if err := tr.api.UpdateContactVisibility(userID, cID, data.Visibility); err != nil {
-		return err
+	version, err := ifMatchVersion(c)
+
+	if err != nil {
+		return tr.contactConflict(c, userID, cID, err)
 	}
 
+	if err := tr.api.UpdateContactVisibility(userID, cID, version, data.Visibility); err != nil {
+		return tr.contactConflict(c, userID, cID, err)
+	}
+
+	setNextContactETag(c, version)
+
 	return c.NoContent(http.StatusOK)
 }
 
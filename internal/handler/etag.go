@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"strconv"
+	"strings"
+	"touchly/internal/terrors"
+)
+
+// contactETag is weak, views and saves counters of a contact change without
+// a new version.
+func contactETag(version int) string {
+	return fmt.Sprintf(`W/"%d"`, version)
+}
+
+// etagMatches compares a list of entity tags, e.g. an If-None-Match header,
+// with etag using weak comparison.
+func etagMatches(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ifMatchVersion returns the contact version the request was based on. The
+// If-Match header is required, "*" matches any version and is returned as
+// zero.
+func ifMatchVersion(c echo.Context) (int, error) {
+	header := strings.TrimSpace(c.Request().Header.Get("If-Match"))
+
+	if header == "" {
+		return 0, terrors.PreconditionRequired(nil, "If-Match header is required")
+	}
+
+	if header == "*" {
+		return 0, nil
+	}
+
+	version, err := strconv.Atoi(strings.Trim(strings.TrimPrefix(header, "W/"), `"`))
+
+	if err != nil || version < 1 {
+		return 0, terrors.PreconditionFailed(err, "If-Match does not match the contact")
+	}
+
+	return version, nil
+}
+
+// setNextContactETag sets the ETag of a contact after an edit based on
+// version, each edit increments the version by one. It is unknown after an
+// unconditional edit.
+func setNextContactETag(c echo.Context, version int) {
+	if version != 0 {
+		c.Response().Header().Set("ETag", contactETag(version+1))
+	}
+}
+
+// contactConflict responds to an edit rejected because of an outdated
+// If-Match with the current contact, so the client can merge its changes
+// and retry. Other errors are returned as they are.
+func (tr *transport) contactConflict(c echo.Context, userID, contactID int64, err error) error {
+	var terror *terrors.Error
+	if !errors.As(err, &terror) || terror.Code != http.StatusPreconditionFailed {
+		return err
+	}
+
+	contact, getErr := tr.api.GetContact(userID, contactID)
+
+	if getErr != nil {
+		return getErr
+	}
+
+	c.Response().Header().Set("ETag", contactETag(contact.Version))
+
+	return c.JSON(http.StatusPreconditionFailed, contact)
+}
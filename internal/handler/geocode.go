@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"strconv"
+	"touchly/internal/terrors"
+)
+
+// GeocodeHandler godoc
+// @Summary      Geocode address
+// @Description  find the coordinates and address components of a free-form address
+// @Tags         geocoding
+// @Accept       json
+// @Produce      json
+// @Param        q   query    string  true  "address"
+// @Success      200  {object}   services.Place
+// @Security     JWT
+// @Router       /api/geocode [get]
+func (tr *transport) GeocodeHandler(c echo.Context) error {
+	if _, err := mustUserID(c); err != nil {
+		return err
+	}
+
+	place, err := tr.api.Geocode(c.QueryParam("q"))
+
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, place)
+}
+
+// ReverseGeocodeHandler godoc
+// @Summary      Reverse geocode location
+// @Description  find the address at the given coordinates
+// @Tags         geocoding
+// @Accept       json
+// @Produce      json
+// @Param        lat   query    number  true  "latitude"
+// @Param        lng   query    number  true  "longitude"
+// @Success      200  {object}   services.Place
+// @Security     JWT
+// @Router       /api/geocode/reverse [get]
+func (tr *transport) ReverseGeocodeHandler(c echo.Context) error {
+	if _, err := mustUserID(c); err != nil {
+		return err
+	}
+
+	lat, err := strconv.ParseFloat(c.QueryParam("lat"), 64)
+
+	if err != nil {
+		return terrors.InvalidRequest(err, "lat is required")
+	}
+
+	lng, err := strconv.ParseFloat(c.QueryParam("lng"), 64)
+
+	if err != nil {
+		return terrors.InvalidRequest(err, "lng is required")
+	}
+
+	place, err := tr.api.ReverseGeocode(lat, lng)
+
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, place)
+}
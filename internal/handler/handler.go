@@ -7,11 +7,14 @@ import (
 	echojwt "github.com/labstack/echo-jwt/v4"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"io"
 	"net/http"
 	"strconv"
 	"time"
 	api2 "touchly/internal/api"
 	"touchly/internal/db"
+	"touchly/internal/services"
+	"touchly/internal/vcard"
 )
 
 type transport struct {
@@ -33,34 +36,75 @@ func (cv *CustomValidator) Validate(i interface{}) error {
 
 type admin interface {
 	CreateUser(email, password string) (*db.User, error)
+	GetUserByEmail(email string) (*db.User, error)
+	ListOutboxEmails(status db.OutboxStatus, page, pageSize int) ([]db.OutboxEmail, error)
+	RequeueOutboxEmail(id int64) (*db.OutboxEmail, error)
+	CreateSystemTag(tag db.Tag) (*db.Tag, error)
+	UpdateTag(id int64, tag db.Tag) (*db.Tag, error)
+	DeleteTag(id int64) error
 }
 
 type api interface {
-	LoginUser(email, password string) (*string, error)
-	VerifyOTP(email, code string) error
-	SendOTP(email string) error
+	LoginUser(email, password string, client api2.Client) (*api2.AuthToken, error)
+	RefreshToken(refreshToken string, client api2.Client) (*api2.AuthToken, error)
+	ValidateSession(userID, sessionID int64) error
+	Logout(userID, sessionID int64) error
+	ListSessions(userID, currentSessionID int64) ([]db.Session, error)
+	RevokeSession(userID, sessionID int64) error
+	RevokeOtherSessions(userID, currentSessionID int64) error
+	ForgotPassword(email string) error
+	ResetPassword(token, password string) error
+	VerifyOTP(email, code string, client api2.Client) (*api2.AuthToken, error)
+	SendOTP(email, language string) error
 	SetPassword(email, password string) error
 	GetUserByID(userID int64) (*db.User, error)
+	UpdateUserLanguage(userID int64, language string) error
 	ListMyContacts(userID int64) (db.ContactsPage, error)
 
-	ListContacts(userID int64, tagIDs []int, search string, lat float64, lng float64, radius int, page, pageSize int) (db.ContactsPage, error)
+	ListContacts(userID int64, request api2.ListContactsRequest) (db.ContactsPage, error)
+	ListContactClusters(userID int64, bbox string, zoom int, tagIDs []int) ([]db.ContactCluster, error)
 	CreateContact(userID int64, contact api2.CreateContactRequest) (*db.Contact, error)
 	GetContact(userID, id int64) (*db.Contact, error)
-	UpdateContact(userID, contactID int64, contact api2.UpdateContactRequest) (*db.Contact, error)
-	UpdateContactVisibility(userID, contactID int64, visibility db.ContactVisibility) error
+	UpdateContact(userID, contactID int64, version int, contact api2.UpdateContactRequest) (*db.Contact, error)
+	PatchContact(userID, contactID int64, version int, contentType string, patch []byte) (*db.Contact, error)
+	UpdateContactVisibility(userID, contactID int64, version int, visibility db.ContactVisibility) error
 	DeleteContact(userID, id int64) error
+	RestoreContact(userID, id int64) (*db.Contact, error)
+	ListContactRevisions(userID, contactID int64) ([]db.ContactRevision, error)
+	RestoreContactRevision(userID, contactID int64, version, revision int) (*db.Contact, error)
+	ListDeletedContacts(userID int64) ([]db.Contact, error)
 
-	CreateContactAddress(userID, contactID int64, address api2.CreateAddressRequest) (*db.Address, error)
+	CreateContactAddress(userID, contactID int64, version int, address api2.CreateAddressRequest) (*db.Address, error)
+	UpdateContactAddress(userID, contactID, addressID int64, version int, address api2.CreateAddressRequest) (*db.Address, error)
+	DeleteContactAddress(userID, contactID, addressID int64, version int) error
+	Geocode(query string) (*services.Place, error)
+	ReverseGeocode(lat, lng float64) (*services.Place, error)
 
-	ListTags() ([]db.Tag, error)
-	CreateTag(tag db.Tag) (*db.Tag, error)
-	DeleteTag(id int64) error
+	ListTags(userID int64) ([]db.Tag, error)
+	ListTagTree(userID int64) ([]*api2.TagNode, error)
+	CreateTag(userID int64, tag db.Tag) (*db.Tag, error)
+	UpdateTag(userID, id int64, tag db.Tag) (*db.Tag, error)
+	DeleteTag(userID, id int64) error
+	SuggestTags(userID int64, q string, limit int) ([]db.Tag, error)
+	SuggestContactTags(userID, contactID int64) ([]db.TagSuggestion, error)
 
 	ListSavedContacts(userID int64) ([]db.Contact, error)
 	SaveContact(userID, contactID int64) error
 	DeleteSavedContact(userID, contactID int64) error
 
 	GetPresignedURL(userID int64, filename string) (*api2.UploadURL, error)
+
+	CreateShareLink(userID, contactID int64, request api2.CreateShareLinkRequest) (*db.ShareLink, error)
+	ListShareLinks(userID, contactID int64) ([]db.ShareLink, error)
+	RevokeShareLink(userID, contactID, linkID int64) error
+	GetSharedContact(viewer api2.Viewer, token string) (*db.Contact, error)
+
+	GetContactVCard(userID, contactID int64, version vcard.Version) (*api2.VCard, error)
+	ExportSavedContacts(userID int64, version vcard.Version) (*api2.VCard, error)
+	ImportContacts(userID int64, r io.Reader) (*api2.ImportContactsResponse, error)
+	GetContactQRCode(userID, contactID int64, request api2.QRCodeRequest) (*api2.QRCode, error)
+	ViewContact(viewer api2.Viewer, contact *db.Contact, source db.ContactViewSource) error
+	GetContactStats(userID, contactID int64, from, to *time.Time) (*api2.ContactStats, error)
 }
 
 func New(api api, admin admin, jwtSecret string) *transport {
@@ -86,6 +130,11 @@ func (tr *transport) RegisterRoutes(e *echo.Echo) {
 		NewClaimsFunc: func(c echo.Context) jwt.Claims {
 			return new(api2.JWTClaims)
 		},
+		Skipper: func(c echo.Context) bool {
+			// refresh is authenticated by the refresh token, an expired
+			// access token sent along must not fail the request
+			return c.Path() == "/api/token/refresh"
+		},
 		SigningKey:             []byte(tr.jwtSecret),
 		ContinueOnIgnoredError: true,
 		ErrorHandler: func(c echo.Context, err error) error {
@@ -110,31 +159,88 @@ func (tr *transport) RegisterRoutes(e *echo.Echo) {
 	}
 
 	a.Use(echojwt.WithConfig(config))
+	a.Use(tr.sessionMiddleware)
 
 	a.POST("/login", tr.LoginUserHandler)
+	a.POST("/token/refresh", tr.RefreshTokenHandler)
+	a.POST("/logout", tr.LogoutHandler)
+	a.GET("/me/sessions", tr.ListSessionsHandler)
+	a.DELETE("/me/sessions", tr.RevokeOtherSessionsHandler)
+	a.DELETE("/me/sessions/:id", tr.RevokeSessionHandler)
 	a.POST("/otp", tr.SendOTPHandler)
 	a.POST("/otp-verify", tr.VerifyOTPHandler)
 	a.POST("/set-password", tr.SetPasswordHandler)
+	a.POST("/password/forgot", tr.ForgotPasswordHandler)
+	a.POST("/password/reset", tr.ResetPasswordHandler)
 	a.GET("/tags", tr.ListTagsHandler)
+	a.GET("/tags/suggest", tr.SuggestTagsHandler)
 	a.POST("/contacts", tr.CreateContactHandler)
+	a.POST("/contacts/import", tr.ImportContactsHandler)
 	a.GET("/contacts", tr.ListContactsHandler)
+	a.GET("/contacts/clusters", tr.ListContactClustersHandler)
 	a.GET("/contacts/:id", tr.GetContactHandler)
 	a.PUT("/contacts/:id", tr.UpdateContactHandler)
+	a.PATCH("/contacts/:id", tr.PatchContactHandler)
+	a.DELETE("/contacts/:id", tr.DeleteContactHandler)
+	a.POST("/contacts/:id/restore", tr.RestoreContactHandler)
+	a.GET("/contacts/:id/revisions", tr.ListContactRevisionsHandler)
+	a.POST("/contacts/:id/revisions/:rev/restore", tr.RestoreContactRevisionHandler)
 	a.PUT("/contacts/:id/visibility", tr.UpdateContactVisibilityHandler)
 	a.POST("/contacts/:id/address", tr.CreateContactAddressHandler)
+	a.POST("/contacts/:id/addresses", tr.CreateContactAddressHandler)
+	a.PUT("/contacts/:id/addresses/:addressId", tr.UpdateContactAddressHandler)
+	a.DELETE("/contacts/:id/addresses/:addressId", tr.DeleteContactAddressHandler)
+	a.GET("/geocode", tr.GeocodeHandler)
+	a.GET("/geocode/reverse", tr.ReverseGeocodeHandler)
 	a.GET("/me", tr.GetMeHandler)
+	a.PUT("/me/language", tr.UpdateLanguageHandler)
 	a.GET("/me/contacts", tr.ListMyContactsHandler)
+	a.GET("/me/trash", tr.ListDeletedContactsHandler)
 	a.GET("/me/saved-contacts", tr.ListSavedContactsHandler)
+	a.GET("/me/saved-contacts.vcf", tr.ExportSavedContactsHandler)
+	a.GET("/contacts/:id/vcard", tr.GetContactVCardHandler)
+	a.GET("/contacts/:id/qr", tr.GetContactQRCodeHandler)
+	a.GET("/contacts/:id/stats", tr.GetContactStatsHandler)
+	a.GET("/contacts/:id/tag-suggestions", tr.SuggestContactTagsHandler)
 	a.POST("/contacts/:id/save", tr.SaveContactHandler)
 	a.DELETE("/contacts/:id/save", tr.DeleteSavedContactHandler)
 	a.POST("/tags", tr.CreateTagHandler)
+	a.PUT("/tags/:id", tr.UpdateTagHandler)
 	a.DELETE("/tags/:id", tr.DeleteTagHandler)
 	a.POST("/uploads/get-url", tr.GetUploadURLHandler)
+	a.POST("/contacts/:id/share-links", tr.CreateShareLinkHandler)
+	a.GET("/contacts/:id/share-links", tr.ListShareLinksHandler)
+	a.DELETE("/contacts/:id/share-links/:linkId", tr.RevokeShareLinkHandler)
+	a.GET("/shared/:token", tr.GetSharedContactHandler)
 
 	adm := e.Group("/admin")
 	adm.Use(middleware.KeyAuth(tr.AdminKeyValidator))
 
 	adm.POST("/users", tr.CreateUserHandler)
+	adm.GET("/users", tr.GetUserByEmailHandler)
+	adm.GET("/email-outbox", tr.ListOutboxEmailsHandler)
+	adm.POST("/email-outbox/:id/requeue", tr.RequeueOutboxEmailHandler)
+	adm.POST("/tags", tr.CreateSystemTagHandler)
+	adm.PUT("/tags/:id", tr.UpdateSystemTagHandler)
+	adm.DELETE("/tags/:id", tr.DeleteSystemTagHandler)
+}
+
+// sessionMiddleware rejects access tokens whose session has been revoked or
+// has expired. Anonymous requests are passed through.
+func (tr *transport) sessionMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		claims := getClaims(c)
+
+		if claims.UserID == 0 {
+			return next(c)
+		}
+
+		if err := tr.api.ValidateSession(claims.UserID, claims.SessionID); err != nil {
+			return err
+		}
+
+		return next(c)
+	}
 }
 
 func (tr *transport) AdminKeyValidator(key string, c echo.Context) (bool, error) {
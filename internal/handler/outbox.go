@@ -0,0 +1,36 @@
+package handler
+
+import (
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"strconv"
+	"touchly/internal/db"
+)
+
+// ListOutboxEmailsHandler lists queued emails by status, dead ones by default.
+func (tr *transport) ListOutboxEmailsHandler(c echo.Context) error {
+	status := db.OutboxStatus(c.QueryParam("status"))
+	page, _ := strconv.Atoi(c.QueryParam("page"))
+	pageSize, _ := strconv.Atoi(c.QueryParam("page_size"))
+
+	emails, err := tr.admin.ListOutboxEmails(status, page, pageSize)
+
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, emails)
+}
+
+// RequeueOutboxEmailHandler puts a dead-lettered email back into the queue.
+func (tr *transport) RequeueOutboxEmailHandler(c echo.Context) error {
+	id, _ := getID(c)
+
+	email, err := tr.admin.RequeueOutboxEmail(id)
+
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, email)
+}
@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"strconv"
+	api2 "touchly/internal/api"
+)
+
+// GetContactQRCodeHandler godoc
+// @Summary      Get contact QR code
+// @Description  render a QR code pointing at the contact URL, its share link or an embedded vCard
+// @Tags         contacts
+// @Produce      image/png
+// @Produce      image/svg+xml
+// @Param        id       path     int     true   "contact id"
+// @Param        format   query    string  false  "png (default) or svg"
+// @Param        size     query    int     false  "image size in pixels (default 256)"
+// @Param        target   query    string  false  "url (default), shared_link or vcard"
+// @Param        token    query    string  false  "share link token for shared_link target"
+// @Success      200  {file}   file
+// @Router       /api/contacts/{id}/qr [get]
+func (tr *transport) GetContactQRCodeHandler(c echo.Context) error {
+	id, _ := getID(c)
+
+	userID := getUserID(c)
+
+	size, _ := strconv.Atoi(c.QueryParam("size"))
+
+	req := api2.QRCodeRequest{
+		Format: api2.QRFormat(c.QueryParam("format")),
+		Target: api2.QRTarget(c.QueryParam("target")),
+		Size:   size,
+		Token:  c.QueryParam("token"),
+	}
+
+	code, err := tr.api.GetContactQRCode(userID, id, req)
+
+	if err != nil {
+		return err
+	}
+
+	return c.Blob(http.StatusOK, code.ContentType, code.Content)
+}
@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"strconv"
+	"touchly/internal/terrors"
+)
+
+// ListContactRevisionsHandler godoc
+// @Summary      List contact revisions
+// @Description  list changes made to the contact, latest first
+// @Tags         contacts
+// @Accept       json
+// @Produce      json
+// @Param        id   path     int     true  "contact id"
+// @Success      200  {array}   db.ContactRevision
+// @Security     JWT
+// @Router       /api/contacts/{id}/revisions [get]
+func (tr *transport) ListContactRevisionsHandler(c echo.Context) error {
+	userID, err := mustUserID(c)
+
+	if err != nil {
+		return err
+	}
+
+	contactID, _ := getID(c)
+
+	revisions, err := tr.api.ListContactRevisions(userID, contactID)
+
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, revisions)
+}
+
+// RestoreContactRevisionHandler godoc
+// @Summary      Restore contact revision
+// @Description  undo the revision and all later ones, restoring the contact to the state before it
+// @Tags         contacts
+// @Accept       json
+// @Produce      json
+// @Param        id    path     int     true  "contact id"
+// @Param        rev   path     int     true  "revision"
+// @Param        If-Match  header   string  true  "ETag of the contact the restore is based on"
+// @Success      200  {object}   db.Contact
+// @Failure      412  {object}   db.Contact  "the contact has been modified, the current one is returned"
+// @Security     JWT
+// @Router       /api/contacts/{id}/revisions/{rev}/restore [post]
+func (tr *transport) RestoreContactRevisionHandler(c echo.Context) error {
+	userID, err := mustUserID(c)
+
+	if err != nil {
+		return err
+	}
+
+	contactID, _ := getID(c)
+
+	revision, err := strconv.Atoi(c.Param("rev"))
+
+	if err != nil {
+		return terrors.InvalidRequest(err, "invalid revision")
+	}
+
+	version, err := ifMatchVersion(c)
+
+	if err != nil {
+		return tr.contactConflict(c, userID, contactID, err)
+	}
+
+	contact, err := tr.api.RestoreContactRevision(userID, contactID, version, revision)
+
+	if err != nil {
+		return tr.contactConflict(c, userID, contactID, err)
+	}
+
+	c.Response().Header().Set("ETag", contactETag(contact.Version))
+
+	return c.JSON(http.StatusOK, contact)
+}
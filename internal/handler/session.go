@@ -0,0 +1,145 @@
+package handler
+
+import (
+	"github.com/labstack/echo/v4"
+	"net/http"
+	api2 "touchly/internal/api"
+)
+
+func getClient(c echo.Context) api2.Client {
+	return api2.Client{
+		UserAgent: c.Request().UserAgent(),
+		IP:        c.RealIP(),
+	}
+}
+
+// getSessionID returns the session the access token was issued for.
+func getSessionID(c echo.Context) int64 {
+	return getClaims(c).SessionID
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// RefreshTokenHandler godoc
+// @Summary      Refresh token
+// @Description  exchange a refresh token for a new access and refresh token pair
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Param        refresh body RefreshTokenRequest true "refresh token"
+// @Success      200  {object}   AuthToken
+// @Router       /api/token/refresh [post]
+func (tr *transport) RefreshTokenHandler(c echo.Context) error {
+	var req RefreshTokenRequest
+
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+
+	token, err := tr.api.RefreshToken(req.RefreshToken, getClient(c))
+
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, token)
+}
+
+// LogoutHandler godoc
+// @Summary      Logout
+// @Description  revoke current session
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Success      200  {object}   nil
+// @Security     JWT
+// @Router       /api/logout [post]
+func (tr *transport) LogoutHandler(c echo.Context) error {
+	userID, err := mustUserID(c)
+
+	if err != nil {
+		return err
+	}
+
+	if err := tr.api.Logout(userID, getSessionID(c)); err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusOK)
+}
+
+// ListSessionsHandler godoc
+// @Summary      List sessions
+// @Description  list active sessions of user
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Success      200  {array}   db.Session
+// @Security     JWT
+// @Router       /api/me/sessions [get]
+func (tr *transport) ListSessionsHandler(c echo.Context) error {
+	userID, err := mustUserID(c)
+
+	if err != nil {
+		return err
+	}
+
+	sessions, err := tr.api.ListSessions(userID, getSessionID(c))
+
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, sessions)
+}
+
+// RevokeSessionHandler godoc
+// @Summary      Revoke session
+// @Description  revoke session of user
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Param        id   path     int     true  "session id"
+// @Success      200  {object}   nil
+// @Security     JWT
+// @Router       /api/me/sessions/{id} [delete]
+func (tr *transport) RevokeSessionHandler(c echo.Context) error {
+	userID, err := mustUserID(c)
+
+	if err != nil {
+		return err
+	}
+
+	id, _ := getID(c)
+
+	if err := tr.api.RevokeSession(userID, id); err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusOK)
+}
+
+// RevokeOtherSessionsHandler godoc
+// @Summary      Revoke other sessions
+// @Description  revoke all sessions of user except the current one
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Success      200  {object}   nil
+// @Security     JWT
+// @Router       /api/me/sessions [delete]
+func (tr *transport) RevokeOtherSessionsHandler(c echo.Context) error {
+	userID, err := mustUserID(c)
+
+	if err != nil {
+		return err
+	}
+
+	if err := tr.api.RevokeOtherSessions(userID, getSessionID(c)); err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusOK)
+}
@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"strconv"
+	api2 "touchly/internal/api"
+)
+
+// CreateShareLinkHandler godoc
+// @Summary      Create share link
+// @Description  create a secret link to a contact, optionally limited by expiry and views
+// @Tags         contacts
+// @Accept       json
+// @Produce      json
+// @Param        id     path     int                     true  "contact id"
+// @Param        link   body     CreateShareLinkRequest  true  "link"
+// @Success      201  {object}   db.ShareLink
+// @Security     JWT
+// @Router       /api/contacts/{id}/share-links [post]
+func (tr *transport) CreateShareLinkHandler(c echo.Context) error {
+	var req api2.CreateShareLinkRequest
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+
+	userID, err := mustUserID(c)
+
+	if err != nil {
+		return err
+	}
+
+	contactID, _ := getID(c)
+
+	link, err := tr.api.CreateShareLink(userID, contactID, req)
+
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusCreated, link)
+}
+
+// ListShareLinksHandler godoc
+// @Summary      List share links
+// @Description  list share links of a contact
+// @Tags         contacts
+// @Accept       json
+// @Produce      json
+// @Param        id   path     int     true  "contact id"
+// @Success      200  {array}   db.ShareLink
+// @Security     JWT
+// @Router       /api/contacts/{id}/share-links [get]
+func (tr *transport) ListShareLinksHandler(c echo.Context) error {
+	userID, err := mustUserID(c)
+
+	if err != nil {
+		return err
+	}
+
+	contactID, _ := getID(c)
+
+	links, err := tr.api.ListShareLinks(userID, contactID)
+
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, links)
+}
+
+// RevokeShareLinkHandler godoc
+// @Summary      Revoke share link
+// @Description  revoke share link of a contact
+// @Tags         contacts
+// @Accept       json
+// @Produce      json
+// @Param        id       path     int     true  "contact id"
+// @Param        linkId   path     int     true  "link id"
+// @Success      200  {object}   nil
+// @Security     JWT
+// @Router       /api/contacts/{id}/share-links/{linkId} [delete]
+func (tr *transport) RevokeShareLinkHandler(c echo.Context) error {
+	userID, err := mustUserID(c)
+
+	if err != nil {
+		return err
+	}
+
+	contactID, _ := getID(c)
+	linkID, _ := strconv.ParseInt(c.Param("linkId"), 10, 64)
+
+	if err := tr.api.RevokeShareLink(userID, contactID, linkID); err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusOK)
+}
+
+// GetSharedContactHandler godoc
+// @Summary      Get shared contact
+// @Description  get contact by share link token
+// @Tags         contacts
+// @Accept       json
+// @Produce      json
+// @Param        token   path     string     true  "share token"
+// @Success      200  {object}   db.Contact
+// @Router       /api/shared/{token} [get]
+func (tr *transport) GetSharedContactHandler(c echo.Context) error {
+	contact, err := tr.api.GetSharedContact(getViewer(c), c.Param("token"))
+
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, contact)
+}
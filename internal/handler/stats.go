@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"time"
+	"touchly/internal/terrors"
+)
+
+func queryDate(c echo.Context, name string) (*time.Time, error) {
+	value := c.QueryParam(name)
+
+	if value == "" {
+		return nil, nil
+	}
+
+	date, err := time.Parse(time.DateOnly, value)
+
+	if err != nil {
+		return nil, terrors.InvalidRequest(err, name+" must be a date in YYYY-MM-DD format")
+	}
+
+	return &date, nil
+}
+
+// GetContactStatsHandler godoc
+// @Summary      Get contact stats
+// @Description  get daily views and saves of own contact, last 30 days by default
+// @Tags         contacts
+// @Accept       json
+// @Produce      json
+// @Param        id     path     int     true   "contact id"
+// @Param        from   query    string  false  "first day, YYYY-MM-DD"
+// @Param        to     query    string  false  "last day, YYYY-MM-DD"
+// @Success      200  {object}   ContactStats
+// @Security     JWT
+// @Router       /api/contacts/{id}/stats [get]
+func (tr *transport) GetContactStatsHandler(c echo.Context) error {
+	userID, err := mustUserID(c)
+
+	if err != nil {
+		return err
+	}
+
+	contactID, _ := getID(c)
+
+	from, err := queryDate(c, "from")
+
+	if err != nil {
+		return err
+	}
+
+	to, err := queryDate(c, "to")
+
+	if err != nil {
+		return err
+	}
+
+	stats, err := tr.api.GetContactStats(userID, contactID, from, to)
+
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, stats)
+}
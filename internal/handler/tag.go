@@ -3,19 +3,33 @@ package handler
 import (
 	"github.com/labstack/echo/v4"
 	"net/http"
+	"strconv"
 	"touchly/internal/db"
 )
 
 // ListTagsHandler godoc
 // @Summary      List tags
-// @Description  list tags
+// @Description  list system tags and personal tags of the user, only system tags without a token, with the number of contacts with the tag or its descendants
 // @Tags         tags
 // @Accept       json
 // @Produce      json
+// @Param        tree  query    bool  false  "return the tags as a tree of TagNode"
 // @Success      200  {object}   []db.Tag
 // @Router       /api/tags [get]
 func (tr *transport) ListTagsHandler(c echo.Context) error {
-	tags, err := tr.api.ListTags()
+	userID := getClaims(c).UserID
+
+	if tree, _ := strconv.ParseBool(c.QueryParam("tree")); tree {
+		nodes, err := tr.api.ListTagTree(userID)
+
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(http.StatusOK, nodes)
+	}
+
+	tags, err := tr.api.ListTags(userID)
 
 	if err != nil {
 		return err
@@ -24,9 +38,62 @@ func (tr *transport) ListTagsHandler(c echo.Context) error {
 	return c.JSON(http.StatusOK, tags)
 }
 
+// SuggestTagsHandler godoc
+// @Summary      Suggest tags
+// @Description  autocomplete tags by prefix of the name, slug, synonyms or localized names, or by similarity of the name, tags starting with q first, then the most used
+// @Tags         tags
+// @Accept       json
+// @Produce      json
+// @Param        q      query    string  true   "text typed by the user"
+// @Param        limit  query    int     false  "number of tags, 10 by default, at most 50"
+// @Success      200  {object}   []db.Tag
+// @Router       /api/tags/suggest [get]
+func (tr *transport) SuggestTagsHandler(c echo.Context) error {
+	limit, _ := strconv.Atoi(c.QueryParam("limit"))
+
+	tags, err := tr.api.SuggestTags(getClaims(c).UserID, c.QueryParam("q"), limit)
+
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, tags)
+}
+
+// SuggestContactTagsHandler godoc
+// @Summary      Suggest contact tags
+// @Description  propose tags for a contact based on words of its activity and about, and on tags of similar contacts
+// @Tags         tags
+// @Accept       json
+// @Produce      json
+// @Param        id   path     int     true  "contact id"
+// @Success      200  {object}   []db.TagSuggestion
+// @Security     JWT
+// @Router       /api/contacts/{id}/tag-suggestions [get]
+func (tr *transport) SuggestContactTagsHandler(c echo.Context) error {
+	id, err := getID(c)
+	if err != nil {
+		return err
+	}
+
+	userID, err := mustUserID(c)
+
+	if err != nil {
+		return err
+	}
+
+	suggestions, err := tr.api.SuggestContactTags(userID, id)
+
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, suggestions)
+}
+
 // CreateTagHandler godoc
 // @Summary      Create tag
-// @Description  create tag
+// @Description  create personal tag of the user
 // @Tags         tags
 // @Accept       json
 // @Produce      json
@@ -40,7 +107,13 @@ func (tr *transport) CreateTagHandler(c echo.Context) error {
 		return err
 	}
 
-	createdTag, err := tr.api.CreateTag(tag)
+	userID, err := mustUserID(c)
+
+	if err != nil {
+		return err
+	}
+
+	createdTag, err := tr.api.CreateTag(userID, tag)
 	if err != nil {
 		return err
 	}
@@ -48,9 +121,45 @@ func (tr *transport) CreateTagHandler(c echo.Context) error {
 	return c.JSON(http.StatusCreated, createdTag)
 }
 
+// UpdateTagHandler godoc
+// @Summary      Update tag
+// @Description  update name, parent, slug, localized names and synonyms of a personal tag of the user
+// @Tags         tags
+// @Accept       json
+// @Produce      json
+// @Param        id path int true "tag id"
+// @Param        tag body db.Tag true "tag"
+// @Success      200  {object}   db.Tag
+// @Security     JWT
+// @Router       /api/tags/{id} [put]
+func (tr *transport) UpdateTagHandler(c echo.Context) error {
+	id, err := getID(c)
+	if err != nil {
+		return err
+	}
+
+	var tag db.Tag
+	if err := c.Bind(&tag); err != nil {
+		return err
+	}
+
+	userID, err := mustUserID(c)
+
+	if err != nil {
+		return err
+	}
+
+	res, err := tr.api.UpdateTag(userID, id, tag)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
 // DeleteTagHandler godoc
 // @Summary      Delete tag
-// @Description  delete tag
+// @Description  delete personal tag of the user, it is removed from contacts
 // @Tags         tags
 // @Accept       json
 // @Produce      json
@@ -64,10 +173,61 @@ func (tr *transport) DeleteTagHandler(c echo.Context) error {
 		return err
 	}
 
-	err = tr.api.DeleteTag(id)
+	userID, err := mustUserID(c)
+
+	if err != nil {
+		return err
+	}
+
+	err = tr.api.DeleteTag(userID, id)
+	if err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusOK)
+}
+
+// CreateSystemTagHandler creates a tag available to all users.
+func (tr *transport) CreateSystemTagHandler(c echo.Context) error {
+	var tag db.Tag
+	if err := c.Bind(&tag); err != nil {
+		return err
+	}
+
+	res, err := tr.admin.CreateSystemTag(tag)
+
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusCreated, res)
+}
+
+// UpdateSystemTagHandler updates any tag, e.g. to move it in the tree.
+func (tr *transport) UpdateSystemTagHandler(c echo.Context) error {
+	id, _ := getID(c)
+
+	var tag db.Tag
+	if err := c.Bind(&tag); err != nil {
+		return err
+	}
+
+	res, err := tr.admin.UpdateTag(id, tag)
+
 	if err != nil {
 		return err
 	}
 
+	return c.JSON(http.StatusOK, res)
+}
+
+// DeleteSystemTagHandler deletes any tag and removes it from contacts.
+func (tr *transport) DeleteSystemTagHandler(c echo.Context) error {
+	id, _ := getID(c)
+
+	if err := tr.admin.DeleteTag(id); err != nil {
+		return err
+	}
+
 	return c.NoContent(http.StatusOK)
 }
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"github.com/labstack/echo/v4"
 	"net/http"
+	"strings"
 )
 
 func decodeRequest(r *http.Request, v interface{}) error {
@@ -22,7 +23,7 @@ type LoginUserRequest struct {
 // @Accept       json
 // @Produce      json
 // @Param        login body LoginUserRequest true "login"
-// @Success      200  {object}   map[string]string
+// @Success      200  {object}   AuthToken
 // @Router       /api/login [post]
 func (tr *transport) LoginUserHandler(c echo.Context) error {
 	var req LoginUserRequest
@@ -31,12 +32,12 @@ func (tr *transport) LoginUserHandler(c echo.Context) error {
 		return err
 	}
 
-	token, err := tr.api.LoginUser(req.Email, req.Password)
+	token, err := tr.api.LoginUser(req.Email, req.Password, getClient(c))
 	if err != nil {
 		return err
 	}
 
-	return c.JSON(http.StatusOK, map[string]string{"token": *token})
+	return c.JSON(http.StatusOK, token)
 }
 
 type VerifyOTPRequest struct {
@@ -46,12 +47,12 @@ type VerifyOTPRequest struct {
 
 // VerifyOTPHandler godoc
 // @Summary      Verify OTP
-// @Description  verify OTP
+// @Description  verify OTP and sign in, returns the same token as login
 // @Tags         users
 // @Accept       json
 // @Produce      json
 // @Param 	     verify body VerifyOTPRequest true "verify"
-// @Success      200  {object}   nil
+// @Success      200  {object}   AuthToken
 // @Router       /api/otp-verify [post]
 func (tr *transport) VerifyOTPHandler(c echo.Context) error {
 	var req VerifyOTPRequest
@@ -60,16 +61,18 @@ func (tr *transport) VerifyOTPHandler(c echo.Context) error {
 		return err
 	}
 
-	err := tr.api.VerifyOTP(req.Email, req.OTP)
+	token, err := tr.api.VerifyOTP(req.Email, req.OTP, getClient(c))
 	if err != nil {
 		return err
 	}
 
-	return c.NoContent(http.StatusOK)
+	return c.JSON(http.StatusOK, token)
 }
 
 type SendOTPRequest struct {
 	Email string `json:"email"`
+	// Language of the email for new users, Accept-Language is used if empty.
+	Language string `json:"language"`
 }
 
 // SendOTPHandler godoc
@@ -88,7 +91,12 @@ func (tr *transport) SendOTPHandler(c echo.Context) error {
 		return err
 	}
 
-	err := tr.api.SendOTP(req.Email)
+	language := req.Language
+	if language == "" {
+		language = getLanguage(c)
+	}
+
+	err := tr.api.SendOTP(req.Email, language)
 	if err != nil {
 		return err
 	}
@@ -125,6 +133,69 @@ func (tr *transport) SetPasswordHandler(c echo.Context) error {
 	return c.NoContent(http.StatusOK)
 }
 
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// ForgotPasswordHandler godoc
+// @Summary      Forgot password
+// @Description  send password reset link to email
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Param        email body ForgotPasswordRequest true "email"
+// @Success      200  {object}   nil
+// @Router       /api/password/forgot [post]
+func (tr *transport) ForgotPasswordHandler(c echo.Context) error {
+	var req ForgotPasswordRequest
+
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+
+	if err := c.Validate(req); err != nil {
+		return err
+	}
+
+	if err := tr.api.ForgotPassword(req.Email); err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusOK)
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,min=8"`
+}
+
+// ResetPasswordHandler godoc
+// @Summary      Reset password
+// @Description  set new password using reset token, signs out all sessions
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Param        reset body ResetPasswordRequest true "reset"
+// @Success      200  {object}   nil
+// @Router       /api/password/reset [post]
+func (tr *transport) ResetPasswordHandler(c echo.Context) error {
+	var req ResetPasswordRequest
+
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+
+	if err := c.Validate(req); err != nil {
+		return err
+	}
+
+	if err := tr.api.ResetPassword(req.Token, req.Password); err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusOK)
+}
+
 // GetMeHandler godoc
 // @Summary      Get user
 // @Description  get user
@@ -150,6 +221,58 @@ func (tr *transport) GetMeHandler(c echo.Context) error {
 	return c.JSON(http.StatusOK, user)
 }
 
+type UpdateLanguageRequest struct {
+	Language string `json:"language" validate:"required"`
+}
+
+// UpdateLanguageHandler godoc
+// @Summary      Update language
+// @Description  set the preferred language of the user, used for emails
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Param        language body UpdateLanguageRequest true "language"
+// @Success      200  {object}   nil
+// @Security     JWT
+// @Router       /api/me/language [put]
+func (tr *transport) UpdateLanguageHandler(c echo.Context) error {
+	userID, err := mustUserID(c)
+
+	if err != nil {
+		return err
+	}
+
+	var req UpdateLanguageRequest
+
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+
+	if err := c.Validate(req); err != nil {
+		return err
+	}
+
+	if err := tr.api.UpdateUserLanguage(userID, req.Language); err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusOK)
+}
+
+// getLanguage returns the most preferred language of the Accept-Language
+// header, ignoring quality values.
+func getLanguage(c echo.Context) string {
+	header := c.Request().Header.Get("Accept-Language")
+	tag, _, _ := strings.Cut(header, ",")
+	tag, _, _ = strings.Cut(tag, ";")
+
+	if tag = strings.TrimSpace(tag); tag == "*" {
+		return ""
+	}
+
+	return tag
+}
+
 type CreateUserRequest struct {
 	Email    string `json:"email" validate:"required,email"`
 	Password string `json:"password" validate:"required"`
@@ -174,3 +297,14 @@ func (tr *transport) CreateUserHandler(c echo.Context) error {
 
 	return c.JSON(http.StatusCreated, res)
 }
+
+// GetUserByEmailHandler looks up a user by the email query param.
+func (tr *transport) GetUserByEmailHandler(c echo.Context) error {
+	user, err := tr.admin.GetUserByEmail(c.QueryParam("email"))
+
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, user)
+}
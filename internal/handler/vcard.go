@@ -0,0 +1,157 @@
+package handler
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"io"
+	"net/http"
+	"strings"
+	api2 "touchly/internal/api"
+	"touchly/internal/terrors"
+	"touchly/internal/vcard"
+)
+
+func vCardVersion(c echo.Context) vcard.Version {
+	if v := c.QueryParam("version"); v != "" {
+		return vcard.Version(v)
+	}
+
+	return vcard.Version30
+}
+
+func sendVCard(c echo.Context, card *api2.VCard) error {
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", card.FileName))
+
+	return c.Blob(http.StatusOK, vcard.ContentType, card.Content)
+}
+
+// GetContactVCardHandler godoc
+// @Summary      Export contact as vCard
+// @Description  export contact as vCard 3.0 or 4.0
+// @Tags         contacts
+// @Produce      text/vcard
+// @Param        id        path     int     true   "contact id"
+// @Param        version   query    string  false  "vCard version, 3.0 (default) or 4.0"
+// @Success      200  {file}   file
+// @Router       /api/contacts/{id}/vcard [get]
+func (tr *transport) GetContactVCardHandler(c echo.Context) error {
+	id, _ := getID(c)
+
+	userID := getUserID(c)
+
+	card, err := tr.api.GetContactVCard(userID, id, vCardVersion(c))
+
+	if err != nil {
+		return err
+	}
+
+	return sendVCard(c, card)
+}
+
+// ExportSavedContactsHandler godoc
+// @Summary      Export saved contacts as vCard
+// @Description  export contacts saved by user as a multi-entry vCard file
+// @Tags         contacts
+// @Produce      text/vcard
+// @Param        version   query    string  false  "vCard version, 3.0 (default) or 4.0"
+// @Success      200  {file}   file
+// @Security     JWT
+// @Router       /api/me/saved-contacts.vcf [get]
+func (tr *transport) ExportSavedContactsHandler(c echo.Context) error {
+	userID, err := mustUserID(c)
+
+	if err != nil {
+		return err
+	}
+
+	card, err := tr.api.ExportSavedContacts(userID, vCardVersion(c))
+
+	if err != nil {
+		return err
+	}
+
+	return sendVCard(c, card)
+}
+
+// maxImportSize limits the size of an uploaded vCard file.
+const maxImportSize = 5 << 20
+
+// maxImportFormOverhead is room for the multipart headers and boundaries
+// around the file.
+const maxImportFormOverhead = 64 << 10
+
+// ImportContactsHandler godoc
+// @Summary      Import contacts from vCard
+// @Description  create contacts from a multi-entry vCard file, uploaded as multipart "file" field or as raw body
+// @Tags         contacts
+// @Accept       multipart/form-data
+// @Accept       text/vcard
+// @Produce      json
+// @Param        file   formData   file   false  "vCard file"
+// @Success      200  {object}   ImportContactsResponse
+// @Failure      413  {object}   nil  "the file is larger than 5 MB"
+// @Security     JWT
+// @Router       /api/contacts/import [post]
+func (tr *transport) ImportContactsHandler(c echo.Context) error {
+	userID, err := mustUserID(c)
+
+	if err != nil {
+		return err
+	}
+
+	c.Request().Body = http.MaxBytesReader(c.Response(), c.Request().Body, maxImportSize+maxImportFormOverhead)
+
+	var body io.Reader = c.Request().Body
+
+	if strings.HasPrefix(c.Request().Header.Get(echo.HeaderContentType), echo.MIMEMultipartForm) {
+		fileHeader, err := c.FormFile("file")
+
+		var tooLarge *http.MaxBytesError
+
+		if err != nil && errors.As(err, &tooLarge) {
+			return importTooLarge(err)
+		} else if err != nil {
+			return terrors.InvalidRequest(err, "file is required")
+		}
+
+		file, err := fileHeader.Open()
+
+		if err != nil {
+			return terrors.InvalidRequest(err, "failed to read file")
+		}
+
+		defer file.Close()
+
+		body = file
+	}
+
+	// reading one byte past the limit tells a file of exactly the limit
+	// from a larger one, which would otherwise be silently truncated
+	data, err := io.ReadAll(io.LimitReader(body, maxImportSize+1))
+
+	var tooLarge *http.MaxBytesError
+
+	if err != nil && errors.As(err, &tooLarge) {
+		return importTooLarge(err)
+	} else if err != nil {
+		return terrors.InvalidRequest(err, "failed to read file")
+	}
+
+	if len(data) > maxImportSize {
+		return importTooLarge(nil)
+	}
+
+	res, err := tr.api.ImportContacts(userID, bytes.NewReader(data))
+
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+func importTooLarge(err error) error {
+	return terrors.RequestEntityTooLarge(err, fmt.Sprintf("file is larger than %d MB", maxImportSize>>20))
+}
@@ -0,0 +1,203 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang.org/x/time/rate"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrPlaceNotFound = errors.New("place not found")
+
+// ErrGeocoderBusy is returned when a request would wait for the rate limit
+// longer than MaxWait.
+var ErrGeocoderBusy = errors.New("geocoder is busy")
+
+// Place is a geocoded address.
+type Place struct {
+	// ExternalID identifies the place at the provider, e.g. "osm:N240109189".
+	ExternalID  string  `json:"external_id"`
+	Name        string  `json:"name"`
+	Street      *string `json:"street"`
+	HouseNumber *string `json:"house_number"`
+	City        *string `json:"city"`
+	Postcode    *string `json:"postcode"`
+	Country     *string `json:"country"`
+	CountryCode *string `json:"country_code"`
+	Lat         float64 `json:"lat"`
+	Lng         float64 `json:"lng"`
+} // @Name Place
+
+// NominatimClient geocodes addresses with the Nominatim API, or any service
+// compatible with it. All requests share a rate limit, the public Nominatim
+// bans clients sending more than one request per second.
+type NominatimClient struct {
+	BaseURL   string
+	UserAgent string
+	Client    *http.Client
+	// MaxWait is how long a request may wait for its turn before failing
+	// with ErrGeocoderBusy.
+	MaxWait time.Duration
+	limiter *rate.Limiter
+}
+
+// NewNominatimClient returns a client sending at most one request per
+// interval, zero disables the limit.
+func NewNominatimClient(baseURL, userAgent string, interval time.Duration) *NominatimClient {
+	limit := rate.Inf
+	if interval > 0 {
+		limit = rate.Every(interval)
+	}
+
+	return &NominatimClient{
+		BaseURL:   strings.TrimSuffix(baseURL, "/"),
+		UserAgent: userAgent,
+		Client:    &http.Client{Timeout: 10 * time.Second},
+		MaxWait:   5 * time.Second,
+		limiter:   rate.NewLimiter(limit, 1),
+	}
+}
+
+type nominatimPlace struct {
+	OSMType     string `json:"osm_type"`
+	OSMID       int64  `json:"osm_id"`
+	Lat         string `json:"lat"`
+	Lon         string `json:"lon"`
+	DisplayName string `json:"display_name"`
+	Address     struct {
+		HouseNumber  string `json:"house_number"`
+		Road         string `json:"road"`
+		Pedestrian   string `json:"pedestrian"`
+		City         string `json:"city"`
+		Town         string `json:"town"`
+		Village      string `json:"village"`
+		Hamlet       string `json:"hamlet"`
+		Municipality string `json:"municipality"`
+		Postcode     string `json:"postcode"`
+		Country      string `json:"country"`
+		CountryCode  string `json:"country_code"`
+	} `json:"address"`
+	// Error is set by /reverse when nothing is found at the location.
+	Error string `json:"error"`
+}
+
+// Geocode returns the best match for a free-form address.
+func (c *NominatimClient) Geocode(query string) (*Place, error) {
+	params := url.Values{}
+	params.Set("q", query)
+	params.Set("format", "jsonv2")
+	params.Set("addressdetails", "1")
+	params.Set("limit", "1")
+
+	var places []nominatimPlace
+
+	if err := c.get("/search", params, &places); err != nil {
+		return nil, err
+	}
+
+	if len(places) == 0 {
+		return nil, ErrPlaceNotFound
+	}
+
+	return places[0].toPlace()
+}
+
+// Reverse returns the address at the given location.
+func (c *NominatimClient) Reverse(lat, lng float64) (*Place, error) {
+	params := url.Values{}
+	params.Set("lat", strconv.FormatFloat(lat, 'f', -1, 64))
+	params.Set("lon", strconv.FormatFloat(lng, 'f', -1, 64))
+	params.Set("format", "jsonv2")
+	params.Set("addressdetails", "1")
+
+	var place nominatimPlace
+
+	if err := c.get("/reverse", params, &place); err != nil {
+		return nil, err
+	}
+
+	if place.Error != "" {
+		return nil, ErrPlaceNotFound
+	}
+
+	return place.toPlace()
+}
+
+func (c *NominatimClient) get(path string, params url.Values, v interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.MaxWait)
+	defer cancel()
+
+	// Wait fails right away when the turn would come after the deadline
+	if err := c.limiter.Wait(ctx); err != nil {
+		return fmt.Errorf("%w: %v", ErrGeocoderBusy, err)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, c.BaseURL+path+"?"+params.Encode(), nil)
+	if err != nil {
+		return err
+	}
+
+	// Nominatim usage policy requires an identifying user agent
+	req.Header.Set("User-Agent", c.UserAgent)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("geocoder responded with status %d", resp.StatusCode)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (p nominatimPlace) toPlace() (*Place, error) {
+	lat, err := strconv.ParseFloat(p.Lat, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid latitude %q: %w", p.Lat, err)
+	}
+
+	lng, err := strconv.ParseFloat(p.Lon, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid longitude %q: %w", p.Lon, err)
+	}
+
+	place := &Place{
+		Name:        p.DisplayName,
+		Street:      firstNonEmpty(p.Address.Road, p.Address.Pedestrian),
+		HouseNumber: firstNonEmpty(p.Address.HouseNumber),
+		City:        firstNonEmpty(p.Address.City, p.Address.Town, p.Address.Village, p.Address.Hamlet, p.Address.Municipality),
+		Postcode:    firstNonEmpty(p.Address.Postcode),
+		Country:     firstNonEmpty(p.Address.Country),
+		CountryCode: firstNonEmpty(strings.ToUpper(p.Address.CountryCode)),
+		Lat:         lat,
+		Lng:         lng,
+	}
+
+	// osm_type is "node", "way" or "relation"
+	if p.OSMType != "" && p.OSMID != 0 {
+		place.ExternalID = fmt.Sprintf("osm:%s%d", strings.ToUpper(p.OSMType[:1]), p.OSMID)
+	}
+
+	return place, nil
+}
+
+func firstNonEmpty(values ...string) *string {
+	for _, v := range values {
+		if v != "" {
+			return &v
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,200 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const bakeryPlace = `{
+	"osm_type": "node",
+	"osm_id": 240109189,
+	"lat": "52.5170365",
+	"lon": "13.3888599",
+	"display_name": "Bakery, Unter den Linden 1, 10117 Berlin, Germany",
+	"address": {
+		"house_number": "1",
+		"road": "Unter den Linden",
+		"town": "Berlin",
+		"postcode": "10117",
+		"country": "Germany",
+		"country_code": "de"
+	}
+}`
+
+// newStubNominatim serves body with status for every request and records
+// the last one.
+func newStubNominatim(t *testing.T, status int, body string) (*NominatimClient, **http.Request) {
+	t.Helper()
+
+	var last *http.Request
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		last = r
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+
+	t.Cleanup(server.Close)
+
+	return NewNominatimClient(server.URL+"/", "touchly-test/1.0", 0), &last
+}
+
+func TestNominatimGeocode(t *testing.T) {
+	client, last := newStubNominatim(t, http.StatusOK, "["+bakeryPlace+"]")
+
+	place, err := client.Geocode("Unter den Linden 1, Berlin")
+
+	if err != nil {
+		t.Fatalf("Geocode: %v", err)
+	}
+
+	req := *last
+
+	if req.URL.Path != "/search" {
+		t.Errorf("expected /search, got %s", req.URL.Path)
+	}
+
+	if q := req.URL.Query(); q.Get("q") != "Unter den Linden 1, Berlin" || q.Get("format") != "jsonv2" || q.Get("limit") != "1" {
+		t.Errorf("unexpected query %s", req.URL.RawQuery)
+	}
+
+	if ua := req.Header.Get("User-Agent"); ua != "touchly-test/1.0" {
+		t.Errorf("expected the configured user agent, got %q", ua)
+	}
+
+	if place.ExternalID != "osm:N240109189" {
+		t.Errorf("expected external id osm:N240109189, got %q", place.ExternalID)
+	}
+
+	if place.Lat != 52.5170365 || place.Lng != 13.3888599 {
+		t.Errorf("unexpected location %v, %v", place.Lat, place.Lng)
+	}
+
+	if place.Street == nil || *place.Street != "Unter den Linden" || place.City == nil || *place.City != "Berlin" {
+		t.Errorf("unexpected street or city %v, %v", place.Street, place.City)
+	}
+
+	if place.CountryCode == nil || *place.CountryCode != "DE" {
+		t.Errorf("expected country code DE, got %v", place.CountryCode)
+	}
+}
+
+func TestNominatimReverse(t *testing.T) {
+	client, last := newStubNominatim(t, http.StatusOK, bakeryPlace)
+
+	place, err := client.Reverse(52.5170365, 13.3888599)
+
+	if err != nil {
+		t.Fatalf("Reverse: %v", err)
+	}
+
+	req := *last
+
+	if req.URL.Path != "/reverse" {
+		t.Errorf("expected /reverse, got %s", req.URL.Path)
+	}
+
+	if q := req.URL.Query(); q.Get("lat") != "52.5170365" || q.Get("lon") != "13.3888599" {
+		t.Errorf("unexpected query %s", req.URL.RawQuery)
+	}
+
+	if place.Name != "Bakery, Unter den Linden 1, 10117 Berlin, Germany" {
+		t.Errorf("unexpected name %q", place.Name)
+	}
+}
+
+func TestNominatimErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		call   func(c *NominatimClient) error
+		want   error
+	}{
+		{
+			name:   "no search results",
+			status: http.StatusOK,
+			body:   "[]",
+			call: func(c *NominatimClient) error {
+				_, err := c.Geocode("nowhere")
+				return err
+			},
+			want: ErrPlaceNotFound,
+		},
+		{
+			name:   "nothing at the location",
+			status: http.StatusOK,
+			body:   `{"error": "Unable to geocode"}`,
+			call: func(c *NominatimClient) error {
+				_, err := c.Reverse(0, 0)
+				return err
+			},
+			want: ErrPlaceNotFound,
+		},
+		{
+			name:   "rate limited",
+			status: http.StatusTooManyRequests,
+			body:   "",
+			call: func(c *NominatimClient) error {
+				_, err := c.Geocode("Berlin")
+				return err
+			},
+		},
+		{
+			name:   "invalid coordinates",
+			status: http.StatusOK,
+			body:   `[{"lat": "north", "lon": "13.38"}]`,
+			call: func(c *NominatimClient) error {
+				_, err := c.Geocode("Berlin")
+				return err
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, _ := newStubNominatim(t, tt.status, tt.body)
+
+			err := tt.call(client)
+
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, err)
+			}
+
+			if tt.want == nil && errors.Is(err, ErrPlaceNotFound) {
+				t.Fatalf("expected an error other than %v", ErrPlaceNotFound)
+			}
+		})
+	}
+}
+
+func TestNominatimRateLimit(t *testing.T) {
+	client, _ := newStubNominatim(t, http.StatusOK, bakeryPlace)
+	limited := NewNominatimClient(client.BaseURL, client.UserAgent, 100*time.Millisecond)
+
+	start := time.Now()
+
+	for i := 0; i < 2; i++ {
+		if _, err := limited.Reverse(52.5, 13.4); err != nil {
+			t.Fatalf("Reverse: %v", err)
+		}
+	}
+
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Fatalf("expected the second request to wait for its turn, took %v", elapsed)
+	}
+
+	limited.MaxWait = 10 * time.Millisecond
+
+	if _, err := limited.Reverse(52.5, 13.4); !errors.Is(err, ErrGeocoderBusy) {
+		t.Fatalf("expected %v, got %v", ErrGeocoderBusy, err)
+	}
+}
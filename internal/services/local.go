@@ -0,0 +1,93 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FileClient writes every message as an .eml file into a directory, for
+// development environments without a mail provider.
+type FileClient struct {
+	Dir string
+}
+
+func NewFileClient(dir string) (*FileClient, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("email directory is required")
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &FileClient{Dir: dir}, nil
+}
+
+func (c *FileClient) SendEmail(message *MailMessage) error {
+	body, err := message.Bytes()
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102T150405.000000000"), sanitizeFileName(message.To))
+
+	return os.WriteFile(filepath.Join(c.Dir, name), body, 0o644)
+}
+
+func sanitizeFileName(s string) string {
+	b := []byte(s)
+
+	for i, c := range b {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '.', c == '-', c == '@':
+		default:
+			b[i] = '_'
+		}
+	}
+
+	return string(b)
+}
+
+// maxMemoryMessages is how many of the latest messages MemoryClient keeps.
+const maxMemoryMessages = 1000
+
+// MemoryClient keeps the latest sent messages in memory, for tests and CI.
+// Older messages are dropped so a long running server can't run out of
+// memory.
+type MemoryClient struct {
+	mu       sync.Mutex
+	messages []MailMessage
+	// next is where the next message is written once messages is full.
+	next int
+	max  int
+}
+
+func NewMemoryClient() *MemoryClient {
+	return &MemoryClient{max: maxMemoryMessages}
+}
+
+func (c *MemoryClient) SendEmail(message *MailMessage) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.messages) < c.max {
+		c.messages = append(c.messages, *message)
+		return nil
+	}
+
+	c.messages[c.next] = *message
+	c.next = (c.next + 1) % c.max
+
+	return nil
+}
+
+// Messages returns a copy of the kept messages, oldest first.
+func (c *MemoryClient) Messages() []MailMessage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append(append([]MailMessage(nil), c.messages[c.next:]...), c.messages[:c.next]...)
+}
@@ -0,0 +1,29 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestMemoryClientKeepsLatestMessages(t *testing.T) {
+	client := NewMemoryClient()
+	client.max = 3
+
+	for i := 1; i <= 5; i++ {
+		if err := client.SendEmail(&MailMessage{Subject: fmt.Sprint(i)}); err != nil {
+			t.Fatalf("SendEmail: %v", err)
+		}
+	}
+
+	messages := client.Messages()
+
+	if len(messages) != 3 {
+		t.Fatalf("expected 3 messages, got %d", len(messages))
+	}
+
+	for i, want := range []string{"3", "4", "5"} {
+		if messages[i].Subject != want {
+			t.Errorf("expected message %d to be %s, got %s", i, want, messages[i].Subject)
+		}
+	}
+}
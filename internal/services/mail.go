@@ -1,8 +1,18 @@
 package services
 
 import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
-	"github.com/resend/resend-go/v2"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
 )
 
 type MailMessage struct {
@@ -10,33 +20,129 @@ type MailMessage struct {
 	To            string `json:"To"`
 	Subject       string `json:"Subject"`
 	HtmlBody      string `json:"HtmlBody"`
+	TextBody      string `json:"TextBody"`
 	MessageStream string `json:"MessageStream"`
 }
 
-type EmailClient struct {
-	Client *resend.Client
+// Transport delivers email messages.
+type Transport interface {
+	SendEmail(message *MailMessage) error
 }
 
-func NewEmailClient(apiKey string) *EmailClient {
-	return &EmailClient{
-		Client: resend.NewClient(apiKey),
+type EmailConfig struct {
+	// Transport is one of resend, smtp, file or memory.
+	Transport    string
+	ResendApiKey string
+	SMTP         SMTPConfig
+	// Dir is where the file transport writes messages to.
+	Dir string
+}
+
+// NewEmailTransport returns the transport selected by the config.
+func NewEmailTransport(cfg EmailConfig) (Transport, error) {
+	switch cfg.Transport {
+	case "", "resend":
+		if cfg.ResendApiKey == "" {
+			return nil, fmt.Errorf("resend api key is required")
+		}
+
+		return NewResendClient(cfg.ResendApiKey), nil
+	case "smtp":
+		return NewSMTPClient(cfg.SMTP)
+	case "file":
+		return NewFileClient(cfg.Dir)
+	case "memory":
+		return NewMemoryClient(), nil
 	}
+
+	return nil, fmt.Errorf("unknown email transport %q", cfg.Transport)
 }
 
-func (c *EmailClient) SendEmail(message *MailMessage) error {
-	params := &resend.SendEmailRequest{
-		To:      []string{message.To},
-		From:    message.From,
-		Subject: message.Subject,
-		Html:    message.HtmlBody,
+// Bytes renders the message in RFC 5322 format.
+func (m *MailMessage) Bytes() ([]byte, error) {
+	from, err := mail.ParseAddress(m.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sender: %w", err)
 	}
 
-	sent, err := c.Client.Emails.Send(params)
+	to, err := mail.ParseAddress(m.To)
 	if err != nil {
+		return nil, fmt.Errorf("invalid recipient: %w", err)
+	}
+
+	var buf bytes.Buffer
+
+	header := func(name, value string) {
+		buf.WriteString(name + ": " + value + "\r\n")
+	}
+
+	header("From", from.String())
+	header("To", to.String())
+	header("Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", messageID(from.Address))
+	header("MIME-Version", "1.0")
+
+	if m.TextBody == "" {
+		header("Content-Type", `text/html; charset="utf-8"`)
+		header("Content-Transfer-Encoding", "quoted-printable")
+		buf.WriteString("\r\n")
+
+		if err := writeQuotedPrintable(&buf, m.HtmlBody); err != nil {
+			return nil, err
+		}
+
+		return buf.Bytes(), nil
+	}
+
+	mw := multipart.NewWriter(&buf)
+
+	header("Content-Type", `multipart/alternative; boundary="`+mw.Boundary()+`"`)
+	buf.WriteString("\r\n")
+
+	// parts go from the least to the most preferred one
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain", m.TextBody},
+		{"text/html", m.HtmlBody},
+	} {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType + `; charset="utf-8"`},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if err := writeQuotedPrintable(w, part.body); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func writeQuotedPrintable(w io.Writer, body string) error {
+	qp := quotedprintable.NewWriter(w)
+
+	if _, err := qp.Write([]byte(body)); err != nil {
 		return err
 	}
 
-	fmt.Printf("Email sent: %v\n", sent)
+	return qp.Close()
+}
+
+func messageID(sender string) string {
+	domain := "localhost"
+	if at := strings.LastIndex(sender, "@"); at >= 0 {
+		domain = sender[at+1:]
+	}
+
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
 
-	return nil
+	return "<" + hex.EncodeToString(b) + "@" + domain + ">"
 }
@@ -0,0 +1,35 @@
+package services
+
+import (
+	"fmt"
+	"github.com/resend/resend-go/v2"
+)
+
+type ResendClient struct {
+	Client *resend.Client
+}
+
+func NewResendClient(apiKey string) *ResendClient {
+	return &ResendClient{
+		Client: resend.NewClient(apiKey),
+	}
+}
+
+func (c *ResendClient) SendEmail(message *MailMessage) error {
+	params := &resend.SendEmailRequest{
+		To:      []string{message.To},
+		From:    message.From,
+		Subject: message.Subject,
+		Html:    message.HtmlBody,
+		Text:    message.TextBody,
+	}
+
+	sent, err := c.Client.Emails.Send(params)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Email sent: %v\n", sent)
+
+	return nil
+}
@@ -54,3 +54,43 @@ func Forbidden(err error, msg string) *Error {
 		Err:     err,
 	}
 }
+
+func TooManyRequests(err error, msg string) *Error {
+	return &Error{
+		Code:    http.StatusTooManyRequests,
+		Message: msg,
+		Err:     err,
+	}
+}
+
+func PreconditionFailed(err error, msg string) *Error {
+	return &Error{
+		Code:    http.StatusPreconditionFailed,
+		Message: msg,
+		Err:     err,
+	}
+}
+
+func PreconditionRequired(err error, msg string) *Error {
+	return &Error{
+		Code:    http.StatusPreconditionRequired,
+		Message: msg,
+		Err:     err,
+	}
+}
+
+func RequestEntityTooLarge(err error, msg string) *Error {
+	return &Error{
+		Code:    http.StatusRequestEntityTooLarge,
+		Message: msg,
+		Err:     err,
+	}
+}
+
+func UnsupportedMediaType(err error, msg string) *Error {
+	return &Error{
+		Code:    http.StatusUnsupportedMediaType,
+		Message: msg,
+		Err:     err,
+	}
+}
@@ -0,0 +1,308 @@
+package vcard
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"mime/quotedprintable"
+	"strings"
+)
+
+type Property struct {
+	Name   string
+	Params map[string][]string
+	Value  string
+}
+
+// Param returns the first value of the parameter or an empty string.
+func (p Property) Param(name string) string {
+	if values := p.Params[name]; len(values) > 0 {
+		return values[0]
+	}
+
+	return ""
+}
+
+// HasType reports whether the TYPE parameter contains t, case-insensitively.
+func (p Property) HasType(t string) bool {
+	for _, v := range p.Params["TYPE"] {
+		if strings.EqualFold(v, t) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Text returns the unescaped value of a text property.
+func (p Property) Text() string {
+	return unescape(p.Value)
+}
+
+// Components splits a structured value such as N or ADR on unescaped
+// semicolons and unescapes every component.
+func (p Property) Components() []string {
+	parts := splitUnescaped(p.Value, ';')
+
+	for i := range parts {
+		parts[i] = unescape(parts[i])
+	}
+
+	return parts
+}
+
+// List splits a multi-valued property such as CATEGORIES on unescaped commas.
+func (p Property) List() []string {
+	parts := splitUnescaped(p.Value, ',')
+	res := make([]string, 0, len(parts))
+
+	for _, part := range parts {
+		if part = strings.TrimSpace(unescape(part)); part != "" {
+			res = append(res, part)
+		}
+	}
+
+	return res
+}
+
+type Card struct {
+	// Line is the line number of BEGIN:VCARD in the source.
+	Line       int
+	Properties []Property
+	// Err is set when the card could not be parsed completely.
+	Err error
+}
+
+// Get returns the first property with the given name.
+func (c Card) Get(name string) (Property, bool) {
+	for _, p := range c.Properties {
+		if p.Name == name {
+			return p, true
+		}
+	}
+
+	return Property{}, false
+}
+
+// All returns every property with the given name.
+func (c Card) All(name string) []Property {
+	var res []Property
+
+	for _, p := range c.Properties {
+		if p.Name == name {
+			res = append(res, p)
+		}
+	}
+
+	return res
+}
+
+type rawLine struct {
+	number int
+	text   string
+}
+
+// Decode reads all vCards from r. Malformed cards are returned with Err set
+// so the caller can report them without dropping the rest of the file.
+func Decode(r io.Reader) ([]Card, error) {
+	lines, err := readLines(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var cards []Card
+	var current *Card
+
+	for _, l := range lines {
+		prop, err := parseLine(l.text)
+
+		if err != nil {
+			if current != nil && current.Err == nil {
+				current.Err = fmt.Errorf("line %d: %w", l.number, err)
+			}
+			continue
+		}
+
+		switch {
+		case prop.Name == "BEGIN" && strings.EqualFold(prop.Value, "VCARD"):
+			if current != nil {
+				current.Err = fmt.Errorf("line %d: missing END:VCARD", l.number)
+				cards = append(cards, *current)
+			}
+			current = &Card{Line: l.number}
+		case prop.Name == "END" && strings.EqualFold(prop.Value, "VCARD"):
+			if current == nil {
+				continue
+			}
+			cards = append(cards, *current)
+			current = nil
+		case current != nil:
+			if strings.EqualFold(prop.Param("ENCODING"), "QUOTED-PRINTABLE") {
+				decoded, err := io.ReadAll(quotedprintable.NewReader(strings.NewReader(prop.Value)))
+				if err != nil && current.Err == nil {
+					current.Err = fmt.Errorf("line %d: %w", l.number, err)
+				}
+				prop.Value = string(decoded)
+			}
+			current.Properties = append(current.Properties, prop)
+		}
+	}
+
+	if current != nil {
+		current.Err = errors.New("missing END:VCARD")
+		cards = append(cards, *current)
+	}
+
+	return cards, nil
+}
+
+// readLines reads r and unfolds content lines, keeping the number of the
+// line each logical line starts on.
+func readLines(r io.Reader) ([]rawLine, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var lines []rawLine
+	number := 0
+	qpContinued := false
+
+	for scanner.Scan() {
+		number++
+		text := strings.TrimSuffix(scanner.Text(), "\r")
+
+		switch {
+		case qpContinued && len(lines) > 0:
+			// vCard 2.1 quoted-printable soft line break
+			lines[len(lines)-1].text += "\r\n" + text
+		case (strings.HasPrefix(text, " ") || strings.HasPrefix(text, "\t")) && len(lines) > 0:
+			lines[len(lines)-1].text += text[1:]
+		case strings.TrimSpace(text) == "":
+			continue
+		default:
+			lines = append(lines, rawLine{number: number, text: text})
+		}
+
+		qpContinued = strings.HasSuffix(text, "=") &&
+			strings.Contains(strings.ToUpper(lines[len(lines)-1].text), "QUOTED-PRINTABLE")
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return lines, nil
+}
+
+// parseLine splits a content line into its name, parameters and value.
+func parseLine(line string) (Property, error) {
+	prop := Property{Params: map[string][]string{}}
+
+	inQuotes := false
+	colon := -1
+
+	for i, r := range line {
+		if r == '"' {
+			inQuotes = !inQuotes
+		} else if r == ':' && !inQuotes {
+			colon = i
+			break
+		}
+	}
+
+	if colon < 0 {
+		return prop, errors.New("missing ':' in content line")
+	}
+
+	prop.Value = line[colon+1:]
+	head := splitQuoted(line[:colon], ';')
+
+	name := strings.ToUpper(strings.TrimSpace(head[0]))
+	if dot := strings.LastIndex(name, "."); dot >= 0 {
+		// strip the group prefix, e.g. item1.URL
+		name = name[dot+1:]
+	}
+
+	if name == "" {
+		return prop, errors.New("empty property name")
+	}
+
+	prop.Name = name
+
+	for _, param := range head[1:] {
+		key, value, found := strings.Cut(param, "=")
+		key = strings.ToUpper(strings.TrimSpace(key))
+
+		if !found {
+			// vCard 2.1 allows bare types, e.g. TEL;CELL:...
+			prop.Params["TYPE"] = append(prop.Params["TYPE"], key)
+			continue
+		}
+
+		for _, v := range splitQuoted(value, ',') {
+			prop.Params[key] = append(prop.Params[key], strings.Trim(v, `"`))
+		}
+	}
+
+	return prop, nil
+}
+
+func splitQuoted(s string, sep rune) []string {
+	var parts []string
+	inQuotes := false
+	start := 0
+
+	for i, r := range s {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+		case r == sep && !inQuotes:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(parts, s[start:])
+}
+
+func splitUnescaped(s string, sep byte) []string {
+	var parts []string
+	start := 0
+
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case sep:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(parts, s[start:])
+}
+
+func unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i == len(s)-1 {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		i++
+		switch s[i] {
+		case 'n', 'N':
+			b.WriteByte('\n')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+
+	return b.String()
+}
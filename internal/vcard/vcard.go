@@ -0,0 +1,298 @@
+package vcard
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"touchly/internal/db"
+	"unicode/utf8"
+)
+
+type Version string
+
+const (
+	Version30 Version = "3.0"
+	Version40 Version = "4.0"
+)
+
+const ContentType = "text/vcard; charset=utf-8"
+
+// maxLineLength is the maximum length of a content line in octets,
+// excluding the line break, as defined in RFC 6350 section 3.2.
+const maxLineLength = 75
+
+func (v Version) IsValid() bool {
+	switch v {
+	case Version30, Version40:
+		return true
+	}
+
+	return false
+}
+
+type encoder struct {
+	w       io.Writer
+	version Version
+	err     error
+}
+
+// Encode writes contacts as a sequence of vCards of the given version.
+func Encode(w io.Writer, version Version, contacts ...db.Contact) error {
+	if !version.IsValid() {
+		return fmt.Errorf("unsupported vCard version %q", version)
+	}
+
+	enc := &encoder{w: w, version: version}
+
+	for _, contact := range contacts {
+		enc.contact(contact)
+	}
+
+	return enc.err
+}
+
+func (e *encoder) contact(c db.Contact) {
+	e.line("BEGIN", "VCARD")
+	e.line("VERSION", string(e.version))
+
+	if e.version == Version40 {
+		e.line("KIND", "individual")
+	}
+
+	e.line("UID", "urn:touchly:contact:"+strconv.FormatInt(c.ID, 10))
+	e.line("FN", escape(c.Name))
+	e.line("N", structuredName(c.Name))
+
+	if c.ActivityName != nil && *c.ActivityName != "" {
+		e.line("ORG", escape(*c.ActivityName))
+	}
+
+	if phone := phoneNumber(c); phone != "" {
+		if e.version == Version40 {
+			e.line("TEL;VALUE=uri;TYPE=cell", "tel:"+strings.ReplaceAll(phone, " ", "-"))
+		} else {
+			e.line("TEL;TYPE=CELL", phone)
+		}
+	}
+
+	if c.Email != nil && *c.Email != "" {
+		if e.version == Version40 {
+			e.line("EMAIL", escape(*c.Email))
+		} else {
+			e.line("EMAIL;TYPE=INTERNET", escape(*c.Email))
+		}
+	}
+
+	if c.Website != nil && *c.Website != "" {
+		e.line("URL", *c.Website)
+	}
+
+	addresses := c.Addresses
+	if len(addresses) == 0 && c.Address != nil {
+		addresses = []db.Address{*c.Address}
+	}
+
+	for _, a := range addresses {
+		e.address(a)
+	}
+
+	for _, link := range c.SocialLinks {
+		if link.Link == "" {
+			continue
+		}
+
+		e.line("X-SOCIALPROFILE;TYPE="+paramValue(link.Type), link.Link)
+	}
+
+	if c.Avatar != nil && *c.Avatar != "" {
+		if e.version == Version40 {
+			e.line("PHOTO", *c.Avatar)
+		} else {
+			e.line("PHOTO;VALUE=URI", *c.Avatar)
+		}
+	}
+
+	if len(c.Tags) > 0 {
+		names := make([]string, 0, len(c.Tags))
+
+		for _, tag := range c.Tags {
+			names = append(names, escape(tag.Name))
+		}
+
+		e.line("CATEGORIES", strings.Join(names, ","))
+	}
+
+	if c.About != nil && *c.About != "" {
+		e.line("NOTE", escape(*c.About))
+	}
+
+	if !c.UpdatedAt.IsZero() {
+		e.line("REV", formatTime(c.UpdatedAt))
+	}
+
+	e.line("END", "VCARD")
+}
+
+func (e *encoder) address(a db.Address) {
+	label := "WORK"
+	if a.Label != "" {
+		label = paramValue(a.Label)
+	}
+
+	// ADR components: PO box; extended address; street; locality; region; postal code; country
+	value := ";;" + escape(a.Name) + ";;;;"
+	if a.Street != nil || a.City != nil {
+		street := strings.TrimSpace(deref(a.Street) + " " + deref(a.HouseNumber))
+		value = ";;" + escape(street) + ";" + escape(deref(a.City)) + ";;" + escape(deref(a.Postcode)) + ";" + escape(deref(a.Country))
+	}
+	lat := strconv.FormatFloat(a.Location.Lat, 'f', -1, 64)
+	lng := strconv.FormatFloat(a.Location.Lng, 'f', -1, 64)
+
+	if e.version == Version40 {
+		pref := ""
+		if a.IsPrimary {
+			pref = ";PREF=1"
+		}
+
+		// addresses waiting to be geocoded have no location yet
+		geo := ""
+		if !a.GeocodePending {
+			geo = fmt.Sprintf(";GEO=\"geo:%s,%s\"", lat, lng)
+		}
+
+		e.line(fmt.Sprintf("ADR;TYPE=%s%s;LABEL=\"%s\"%s", label, pref, quoteParam(a.Name), geo), value)
+	} else if a.IsPrimary {
+		// vCard 3.0 has a single GEO per card, it belongs to the primary address
+		e.line("ADR;TYPE="+label+",PREF", value)
+		e.line("LABEL;TYPE="+label+",PREF", escape(a.Name))
+
+		if !a.GeocodePending {
+			e.line("GEO", lat+";"+lng)
+		}
+	} else {
+		e.line("ADR;TYPE="+label, value)
+		e.line("LABEL;TYPE="+label, escape(a.Name))
+	}
+}
+
+// line writes a single content line, folding it when it is longer than
+// maxLineLength octets.
+func (e *encoder) line(name, value string) {
+	if e.err != nil {
+		return
+	}
+
+	content := name + ":" + value
+
+	var b strings.Builder
+	lineLen := 0
+
+	for _, r := range content {
+		size := utf8.RuneLen(r)
+		if lineLen+size > maxLineLength {
+			b.WriteString("\r\n ")
+			lineLen = 1
+		}
+
+		b.WriteRune(r)
+		lineLen += size
+	}
+
+	b.WriteString("\r\n")
+
+	_, e.err = io.WriteString(e.w, b.String())
+}
+
+var escaper = strings.NewReplacer(
+	`\`, `\\`,
+	",", `\,`,
+	";", `\;`,
+	"\r\n", `\n`,
+	"\n", `\n`,
+)
+
+func escape(s string) string {
+	return escaper.Replace(s)
+}
+
+// quoteParam makes s safe to use inside a quoted parameter value.
+func quoteParam(s string) string {
+	s = strings.ReplaceAll(s, `"`, "'")
+	s = strings.ReplaceAll(s, "\r\n", " ")
+	return strings.ReplaceAll(s, "\n", " ")
+}
+
+// paramValue makes s safe to use as an unquoted parameter value.
+func paramValue(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ';', ':', ',', '"', '\r', '\n', ' ':
+			return '-'
+		}
+		return r
+	}, strings.ToLower(s))
+}
+
+// structuredName builds the N property from a full name, treating the last
+// word as the family name.
+func structuredName(name string) string {
+	fields := strings.Fields(name)
+
+	if len(fields) < 2 {
+		return escape(name) + ";;;;"
+	}
+
+	family := fields[len(fields)-1]
+	given := strings.Join(fields[:len(fields)-1], " ")
+
+	return escape(family) + ";" + escape(given) + ";;;"
+}
+
+func phoneNumber(c db.Contact) string {
+	if c.PhoneNumber == nil || *c.PhoneNumber == "" {
+		return ""
+	}
+
+	number := strings.TrimSpace(*c.PhoneNumber)
+
+	if strings.HasPrefix(number, "+") || c.PhoneCallingCode == nil || *c.PhoneCallingCode == "" {
+		return number
+	}
+
+	code := strings.TrimPrefix(strings.TrimSpace(*c.PhoneCallingCode), "+")
+
+	return "+" + code + " " + number
+}
+
+// FileName returns a file name for a vCard of the contact.
+func FileName(c db.Contact) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		case r == ' ':
+			return '_'
+		}
+		return -1
+	}, c.Name)
+
+	if name == "" {
+		name = "contact-" + strconv.FormatInt(c.ID, 10)
+	}
+
+	return name + ".vcf"
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+
+	return *s
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
@@ -0,0 +1,13 @@
+CREATE TABLE contact_share_links
+(
+    id           SERIAL PRIMARY KEY,
+    contact_id   INTEGER      NOT NULL REFERENCES contacts (id),
+    token        VARCHAR(64)  NOT NULL UNIQUE,
+    expires_at   TIMESTAMP,
+    max_views    INTEGER,
+    views_amount INTEGER      NOT NULL DEFAULT 0,
+    created_at   TIMESTAMP    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    revoked_at   TIMESTAMP
+);
+
+CREATE INDEX contact_share_links_contact_id_index ON contact_share_links (contact_id);
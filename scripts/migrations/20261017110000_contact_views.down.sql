@@ -0,0 +1,9 @@
+DROP TRIGGER IF EXISTS trigger_increment_views ON contact_views;
+DROP FUNCTION IF EXISTS increment_views();
+
+DROP INDEX IF EXISTS saved_contacts_contact_id_created_at_index;
+ALTER TABLE saved_contacts
+    DROP COLUMN IF EXISTS created_at;
+
+DROP TABLE IF EXISTS contact_views;
+DROP TYPE IF EXISTS contact_view_source;
@@ -0,0 +1,38 @@
+CREATE TYPE contact_view_source AS ENUM ('list', 'shared_link', 'qr');
+
+CREATE TABLE contact_views
+(
+    id         SERIAL PRIMARY KEY,
+    contact_id INTEGER             NOT NULL REFERENCES contacts (id),
+    viewer_id  INTEGER REFERENCES users (id),
+    viewer_key VARCHAR(128)        NOT NULL,
+    source     contact_view_source NOT NULL DEFAULT 'list',
+    created_at TIMESTAMP           NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX contact_views_contact_id_created_at_index ON contact_views (contact_id, created_at);
+CREATE INDEX contact_views_contact_id_viewer_key_index ON contact_views (contact_id, viewer_key, created_at);
+
+ALTER TABLE saved_contacts
+    ADD COLUMN created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP;
+
+CREATE INDEX saved_contacts_contact_id_created_at_index ON saved_contacts (contact_id, created_at);
+
+-- keep number of views in sync with recorded view events
+
+CREATE OR REPLACE FUNCTION increment_views()
+    RETURNS TRIGGER AS
+$$
+BEGIN
+    UPDATE contacts
+    SET views_amount = views_amount + 1
+    WHERE id = NEW.contact_id;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trigger_increment_views
+    AFTER INSERT
+    ON contact_views
+    FOR EACH ROW
+EXECUTE FUNCTION increment_views();
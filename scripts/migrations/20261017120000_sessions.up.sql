@@ -0,0 +1,16 @@
+CREATE TABLE sessions
+(
+    id                  SERIAL PRIMARY KEY,
+    user_id             INTEGER     NOT NULL REFERENCES users (id),
+    refresh_token_hash  VARCHAR(64) NOT NULL UNIQUE,
+    previous_token_hash VARCHAR(64),
+    user_agent          TEXT,
+    ip                  VARCHAR(64),
+    created_at          TIMESTAMP   NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_used_at        TIMESTAMP   NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at          TIMESTAMP   NOT NULL,
+    revoked_at          TIMESTAMP
+);
+
+CREATE INDEX sessions_user_id_index ON sessions (user_id);
+CREATE INDEX sessions_previous_token_hash_index ON sessions (previous_token_hash);
@@ -0,0 +1,11 @@
+ALTER TABLE users
+    DROP COLUMN IF EXISTS otp_locked_until;
+
+DROP INDEX IF EXISTS otps_user_id_created_at_index;
+
+ALTER TABLE otps
+    DROP COLUMN IF EXISTS attempts;
+ALTER TABLE otps
+    ALTER COLUMN code_hash TYPE VARCHAR(6) USING left(code_hash, 6);
+ALTER TABLE otps
+    RENAME COLUMN code_hash TO otp_code;
@@ -0,0 +1,16 @@
+-- codes are stored as HMAC hashes from now on, plain codes issued before can no longer be verified
+UPDATE otps
+SET is_used = TRUE
+WHERE is_used = FALSE;
+
+ALTER TABLE otps
+    RENAME COLUMN otp_code TO code_hash;
+ALTER TABLE otps
+    ALTER COLUMN code_hash TYPE VARCHAR(64);
+ALTER TABLE otps
+    ADD COLUMN attempts INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX otps_user_id_created_at_index ON otps (user_id, created_at);
+
+ALTER TABLE users
+    ADD COLUMN otp_locked_until TIMESTAMP;
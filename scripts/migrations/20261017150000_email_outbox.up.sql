@@ -0,0 +1,21 @@
+CREATE TYPE email_outbox_status AS ENUM ('pending', 'sent', 'dead');
+
+CREATE TABLE email_outbox
+(
+    id              SERIAL PRIMARY KEY,
+    sender          VARCHAR(255)        NOT NULL,
+    recipient       VARCHAR(255)        NOT NULL,
+    subject         VARCHAR(255)        NOT NULL,
+    html_body       TEXT                NOT NULL,
+    message_stream  VARCHAR(64)         NOT NULL DEFAULT 'outbound',
+    status          email_outbox_status NOT NULL DEFAULT 'pending',
+    attempts        INTEGER             NOT NULL DEFAULT 0,
+    last_error      TEXT,
+    next_attempt_at TIMESTAMP           NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    sent_at         TIMESTAMP,
+    created_at      TIMESTAMP           NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at      TIMESTAMP           NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX email_outbox_pending_index ON email_outbox (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX email_outbox_status_index ON email_outbox (status, created_at);
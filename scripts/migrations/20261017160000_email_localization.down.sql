@@ -0,0 +1,5 @@
+ALTER TABLE email_outbox
+    DROP COLUMN IF EXISTS text_body;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS language;
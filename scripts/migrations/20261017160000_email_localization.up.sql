@@ -0,0 +1,5 @@
+ALTER TABLE users
+    ADD COLUMN language VARCHAR(16);
+
+ALTER TABLE email_outbox
+    ADD COLUMN text_body TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,16 @@
+DROP INDEX IF EXISTS contacts_activity_name_trgm_index;
+DROP INDEX IF EXISTS contacts_name_trgm_index;
+DROP INDEX IF EXISTS contacts_search_vector_index;
+
+DROP TRIGGER IF EXISTS trigger_refresh_tag_search_vectors ON tags;
+DROP TRIGGER IF EXISTS trigger_refresh_contact_search_vector ON social_media_links;
+DROP TRIGGER IF EXISTS trigger_refresh_contact_search_vector ON contact_tags;
+DROP TRIGGER IF EXISTS trigger_update_contact_search_vector ON contacts;
+
+DROP FUNCTION IF EXISTS refresh_tag_search_vectors();
+DROP FUNCTION IF EXISTS refresh_contact_search_vector();
+DROP FUNCTION IF EXISTS update_contact_search_vector();
+DROP FUNCTION IF EXISTS contact_search_vector(contacts);
+
+ALTER TABLE contacts
+    DROP COLUMN IF EXISTS search_vector;
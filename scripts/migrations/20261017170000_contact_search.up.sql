@@ -0,0 +1,92 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+ALTER TABLE contacts
+    ADD COLUMN search_vector TSVECTOR NOT NULL DEFAULT ''::tsvector;
+
+-- the 'simple' configuration is used as contacts are written in many languages
+
+CREATE OR REPLACE FUNCTION contact_search_vector(contact contacts)
+    RETURNS TSVECTOR AS
+$$
+SELECT setweight(to_tsvector('simple', coalesce(contact.name, '')), 'A') ||
+       setweight(to_tsvector('simple', coalesce(contact.activity_name, '')), 'B') ||
+       setweight(to_tsvector('simple', coalesce((SELECT string_agg(t.name, ' ')
+                                                 FROM contact_tags ct
+                                                          JOIN tags t ON t.id = ct.tag_id
+                                                 WHERE ct.contact_id = contact.id), '')), 'B') ||
+       setweight(to_tsvector('simple', coalesce(contact.about, '')), 'C') ||
+       -- handles, e.g. "john" for https://t.me/john or @john
+       setweight(to_tsvector('simple', coalesce((SELECT string_agg(
+                                                                regexp_replace(rtrim(l.link, '/'), '^.*[/@]', ''), ' ')
+                                                 FROM social_media_links l
+                                                 WHERE l.contact_id = contact.id), '')), 'C');
+$$ LANGUAGE sql STABLE;
+
+CREATE OR REPLACE FUNCTION update_contact_search_vector()
+    RETURNS TRIGGER AS
+$$
+BEGIN
+    NEW.search_vector = contact_search_vector(NEW);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trigger_update_contact_search_vector
+    BEFORE INSERT OR UPDATE OF name, activity_name, about
+    ON contacts
+    FOR EACH ROW
+EXECUTE FUNCTION update_contact_search_vector();
+
+-- tags and links live in their own tables, refresh the contact they belong to
+
+CREATE OR REPLACE FUNCTION refresh_contact_search_vector()
+    RETURNS TRIGGER AS
+$$
+BEGIN
+    IF TG_OP IN ('UPDATE', 'DELETE') THEN
+        UPDATE contacts c SET search_vector = contact_search_vector(c) WHERE c.id = OLD.contact_id;
+    END IF;
+
+    IF TG_OP IN ('INSERT', 'UPDATE') THEN
+        UPDATE contacts c SET search_vector = contact_search_vector(c) WHERE c.id = NEW.contact_id;
+    END IF;
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trigger_refresh_contact_search_vector
+    AFTER INSERT OR UPDATE OR DELETE
+    ON contact_tags
+    FOR EACH ROW
+EXECUTE FUNCTION refresh_contact_search_vector();
+
+CREATE TRIGGER trigger_refresh_contact_search_vector
+    AFTER INSERT OR UPDATE OR DELETE
+    ON social_media_links
+    FOR EACH ROW
+EXECUTE FUNCTION refresh_contact_search_vector();
+
+CREATE OR REPLACE FUNCTION refresh_tag_search_vectors()
+    RETURNS TRIGGER AS
+$$
+BEGIN
+    UPDATE contacts c
+    SET search_vector = contact_search_vector(c)
+    WHERE c.id IN (SELECT contact_id FROM contact_tags WHERE tag_id = NEW.id);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trigger_refresh_tag_search_vectors
+    AFTER UPDATE OF name
+    ON tags
+    FOR EACH ROW
+EXECUTE FUNCTION refresh_tag_search_vectors();
+
+UPDATE contacts c
+SET search_vector = contact_search_vector(c);
+
+CREATE INDEX contacts_search_vector_index ON contacts USING GIN (search_vector);
+CREATE INDEX contacts_name_trgm_index ON contacts USING GIN (name gin_trgm_ops);
+CREATE INDEX contacts_activity_name_trgm_index ON contacts USING GIN (activity_name gin_trgm_ops);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS addresses_location_geometry_index;
+DROP INDEX IF EXISTS addresses_location_index;
@@ -0,0 +1,5 @@
+-- radius filters
+CREATE INDEX addresses_location_index ON addresses USING GIST (location);
+
+-- bounding box queries compare planar coordinates
+CREATE INDEX addresses_location_geometry_index ON addresses USING GIST ((location::geometry));
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS addresses_contact_id_primary_index;
+DROP INDEX IF EXISTS addresses_contact_id_index;
+
+ALTER TABLE addresses
+    DROP COLUMN IF EXISTS is_primary;
@@ -0,0 +1,15 @@
+ALTER TABLE addresses
+    ADD COLUMN is_primary BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- contacts had a single address so far, it becomes the primary one
+UPDATE addresses
+SET is_primary = TRUE
+WHERE id IN (SELECT DISTINCT ON (contact_id) id
+             FROM addresses
+             WHERE deleted_at IS NULL
+             ORDER BY contact_id, id);
+
+CREATE INDEX addresses_contact_id_index ON addresses (contact_id);
+
+-- the primary address is the one used for geo search
+CREATE UNIQUE INDEX addresses_contact_id_primary_index ON addresses (contact_id) WHERE is_primary AND deleted_at IS NULL;
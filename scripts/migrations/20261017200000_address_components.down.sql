@@ -0,0 +1,7 @@
+ALTER TABLE addresses
+    DROP COLUMN IF EXISTS street,
+    DROP COLUMN IF EXISTS house_number,
+    DROP COLUMN IF EXISTS city,
+    DROP COLUMN IF EXISTS postcode,
+    DROP COLUMN IF EXISTS country,
+    DROP COLUMN IF EXISTS country_code;
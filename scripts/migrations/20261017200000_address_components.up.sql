@@ -0,0 +1,7 @@
+ALTER TABLE addresses
+    ADD COLUMN street       TEXT,
+    ADD COLUMN house_number TEXT,
+    ADD COLUMN city         TEXT,
+    ADD COLUMN postcode     TEXT,
+    ADD COLUMN country      TEXT,
+    ADD COLUMN country_code TEXT;
@@ -0,0 +1,25 @@
+DROP INDEX IF EXISTS contacts_deleted_at_index;
+
+ALTER TABLE contact_views
+    DROP CONSTRAINT contact_views_contact_id_fkey,
+    ADD CONSTRAINT contact_views_contact_id_fkey FOREIGN KEY (contact_id) REFERENCES contacts (id);
+
+ALTER TABLE contact_share_links
+    DROP CONSTRAINT contact_share_links_contact_id_fkey,
+    ADD CONSTRAINT contact_share_links_contact_id_fkey FOREIGN KEY (contact_id) REFERENCES contacts (id);
+
+ALTER TABLE saved_contacts
+    DROP CONSTRAINT saved_contacts_contact_id_fkey,
+    ADD CONSTRAINT saved_contacts_contact_id_fkey FOREIGN KEY (contact_id) REFERENCES contacts (id);
+
+ALTER TABLE social_media_links
+    DROP CONSTRAINT social_media_links_contact_id_fkey,
+    ADD CONSTRAINT social_media_links_contact_id_fkey FOREIGN KEY (contact_id) REFERENCES contacts (id);
+
+ALTER TABLE contact_tags
+    DROP CONSTRAINT contact_tags_contact_id_fkey,
+    ADD CONSTRAINT contact_tags_contact_id_fkey FOREIGN KEY (contact_id) REFERENCES contacts (id);
+
+ALTER TABLE addresses
+    DROP CONSTRAINT addresses_contact_id_fkey,
+    ADD CONSTRAINT addresses_contact_id_fkey FOREIGN KEY (contact_id) REFERENCES contacts (id);
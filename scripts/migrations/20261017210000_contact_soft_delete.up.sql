@@ -0,0 +1,28 @@
+-- contacts are soft deleted and purged after a retention period, purging
+-- removes everything that belongs to the contact
+
+ALTER TABLE addresses
+    DROP CONSTRAINT addresses_contact_id_fkey,
+    ADD CONSTRAINT addresses_contact_id_fkey FOREIGN KEY (contact_id) REFERENCES contacts (id) ON DELETE CASCADE;
+
+ALTER TABLE contact_tags
+    DROP CONSTRAINT contact_tags_contact_id_fkey,
+    ADD CONSTRAINT contact_tags_contact_id_fkey FOREIGN KEY (contact_id) REFERENCES contacts (id) ON DELETE CASCADE;
+
+ALTER TABLE social_media_links
+    DROP CONSTRAINT social_media_links_contact_id_fkey,
+    ADD CONSTRAINT social_media_links_contact_id_fkey FOREIGN KEY (contact_id) REFERENCES contacts (id) ON DELETE CASCADE;
+
+ALTER TABLE saved_contacts
+    DROP CONSTRAINT saved_contacts_contact_id_fkey,
+    ADD CONSTRAINT saved_contacts_contact_id_fkey FOREIGN KEY (contact_id) REFERENCES contacts (id) ON DELETE CASCADE;
+
+ALTER TABLE contact_share_links
+    DROP CONSTRAINT contact_share_links_contact_id_fkey,
+    ADD CONSTRAINT contact_share_links_contact_id_fkey FOREIGN KEY (contact_id) REFERENCES contacts (id) ON DELETE CASCADE;
+
+ALTER TABLE contact_views
+    DROP CONSTRAINT contact_views_contact_id_fkey,
+    ADD CONSTRAINT contact_views_contact_id_fkey FOREIGN KEY (contact_id) REFERENCES contacts (id) ON DELETE CASCADE;
+
+CREATE INDEX contacts_deleted_at_index ON contacts (deleted_at) WHERE deleted_at IS NOT NULL;
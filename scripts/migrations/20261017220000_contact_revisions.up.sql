@@ -0,0 +1,11 @@
+CREATE TABLE contact_revisions
+(
+    id            SERIAL PRIMARY KEY,
+    contact_id    INTEGER   NOT NULL REFERENCES contacts (id) ON DELETE CASCADE,
+    revision      INTEGER   NOT NULL,
+    user_id       INTEGER   NOT NULL REFERENCES users (id),
+    changes       JSONB     NOT NULL,
+    restored_from INTEGER,
+    created_at    TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (contact_id, revision)
+);
@@ -0,0 +1,4 @@
+-- version is incremented by every edit of the contact, its addresses or
+-- visibility and used as the ETag of the contact
+ALTER TABLE contacts
+    ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
@@ -0,0 +1,18 @@
+ALTER TABLE contact_tags
+    DROP CONSTRAINT contact_tags_tag_id_fkey,
+    ADD CONSTRAINT contact_tags_tag_id_fkey FOREIGN KEY (tag_id) REFERENCES tags (id);
+
+DELETE FROM contact_tags
+WHERE tag_id IN (SELECT id FROM tags WHERE user_id IS NOT NULL);
+
+DELETE FROM tags
+WHERE user_id IS NOT NULL;
+
+DROP INDEX IF EXISTS tags_user_id_name_key;
+DROP INDEX IF EXISTS tags_system_name_key;
+
+ALTER TABLE tags
+    ADD CONSTRAINT tags_name_key UNIQUE (name);
+
+ALTER TABLE tags
+    DROP COLUMN user_id;
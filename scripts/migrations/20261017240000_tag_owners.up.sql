@@ -0,0 +1,14 @@
+-- tags without an owner are system tags managed by admins, the others are
+-- personal tags of their owner
+ALTER TABLE tags
+    ADD COLUMN user_id INTEGER REFERENCES users (id) ON DELETE CASCADE;
+
+ALTER TABLE tags
+    DROP CONSTRAINT tags_name_key;
+
+CREATE UNIQUE INDEX tags_system_name_key ON tags (name) WHERE user_id IS NULL;
+CREATE UNIQUE INDEX tags_user_id_name_key ON tags (user_id, name) WHERE user_id IS NOT NULL;
+
+ALTER TABLE contact_tags
+    DROP CONSTRAINT contact_tags_tag_id_fkey,
+    ADD CONSTRAINT contact_tags_tag_id_fkey FOREIGN KEY (tag_id) REFERENCES tags (id) ON DELETE CASCADE;
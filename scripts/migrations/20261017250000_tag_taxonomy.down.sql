@@ -0,0 +1,38 @@
+CREATE OR REPLACE FUNCTION contact_search_vector(contact contacts)
+    RETURNS TSVECTOR AS
+$$
+SELECT setweight(to_tsvector('simple', coalesce(contact.name, '')), 'A') ||
+       setweight(to_tsvector('simple', coalesce(contact.activity_name, '')), 'B') ||
+       setweight(to_tsvector('simple', coalesce((SELECT string_agg(t.name, ' ')
+                                                 FROM contact_tags ct
+                                                          JOIN tags t ON t.id = ct.tag_id
+                                                 WHERE ct.contact_id = contact.id), '')), 'B') ||
+       setweight(to_tsvector('simple', coalesce(contact.about, '')), 'C') ||
+       -- handles, e.g. "john" for https://t.me/john or @john
+       setweight(to_tsvector('simple', coalesce((SELECT string_agg(
+                                                                regexp_replace(rtrim(l.link, '/'), '^.*[/@]', ''), ' ')
+                                                 FROM social_media_links l
+                                                 WHERE l.contact_id = contact.id), '')), 'C');
+$$ LANGUAGE sql STABLE;
+
+DROP TRIGGER IF EXISTS trigger_refresh_tag_search_vectors ON tags;
+
+CREATE TRIGGER trigger_refresh_tag_search_vectors
+    AFTER UPDATE OF name
+    ON tags
+    FOR EACH ROW
+EXECUTE FUNCTION refresh_tag_search_vectors();
+
+UPDATE contacts c
+SET search_vector = contact_search_vector(c)
+WHERE EXISTS (SELECT 1 FROM contact_tags ct WHERE ct.contact_id = c.id);
+
+DROP INDEX IF EXISTS tags_parent_id_index;
+DROP INDEX IF EXISTS tags_user_id_slug_key;
+DROP INDEX IF EXISTS tags_system_slug_key;
+
+ALTER TABLE tags
+    DROP COLUMN synonyms,
+    DROP COLUMN names,
+    DROP COLUMN slug,
+    DROP COLUMN parent_id;
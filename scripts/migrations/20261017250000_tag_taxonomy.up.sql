@@ -0,0 +1,66 @@
+ALTER TABLE tags
+    ADD COLUMN parent_id INTEGER REFERENCES tags (id) ON DELETE SET NULL,
+    ADD COLUMN slug      VARCHAR(255),
+    -- display names by language, e.g. {"ru": "Пекарня"}
+    ADD COLUMN names     JSONB  NOT NULL DEFAULT '{}',
+    ADD COLUMN synonyms  TEXT[] NOT NULL DEFAULT '{}';
+
+UPDATE tags
+SET slug = trim(BOTH '-' FROM regexp_replace(lower(name), '[^[:alnum:]]+', '-', 'g'));
+
+UPDATE tags
+SET slug = 'tag-' || id
+WHERE slug = '';
+
+UPDATE tags t
+SET slug = t.slug || '-' || t.id
+WHERE EXISTS (SELECT 1
+              FROM tags o
+              WHERE o.slug = t.slug
+                AND o.user_id IS NOT DISTINCT FROM t.user_id
+                AND o.id < t.id);
+
+ALTER TABLE tags
+    ALTER COLUMN slug SET NOT NULL;
+
+CREATE UNIQUE INDEX tags_system_slug_key ON tags (slug) WHERE user_id IS NULL;
+CREATE UNIQUE INDEX tags_user_id_slug_key ON tags (user_id, slug) WHERE user_id IS NOT NULL;
+CREATE INDEX tags_parent_id_index ON tags (parent_id);
+
+-- contacts are found by synonyms and localized names of their tags too
+
+CREATE OR REPLACE FUNCTION contact_search_vector(contact contacts)
+    RETURNS TSVECTOR AS
+$$
+SELECT setweight(to_tsvector('simple', coalesce(contact.name, '')), 'A') ||
+       setweight(to_tsvector('simple', coalesce(contact.activity_name, '')), 'B') ||
+       setweight(to_tsvector('simple', coalesce((SELECT string_agg(
+                                                                concat_ws(' ', t.name, array_to_string(t.synonyms, ' '),
+                                                                          (SELECT string_agg(value, ' ') FROM jsonb_each_text(t.names))),
+                                                                ' ')
+                                                 FROM contact_tags ct
+                                                          JOIN tags t ON t.id = ct.tag_id
+                                                 WHERE ct.contact_id = contact.id), '')), 'B') ||
+       setweight(to_tsvector('simple', coalesce(contact.about, '')), 'C') ||
+       -- handles, e.g. "john" for https://t.me/john or @john
+       setweight(to_tsvector('simple', coalesce((SELECT string_agg(
+                                                                regexp_replace(rtrim(l.link, '/'), '^.*[/@]', ''), ' ')
+                                                 FROM social_media_links l
+                                                 WHERE l.contact_id = contact.id), '')), 'C');
+$$ LANGUAGE sql STABLE;
+
+DROP TRIGGER IF EXISTS trigger_refresh_tag_search_vectors ON tags;
+
+CREATE TRIGGER trigger_refresh_tag_search_vectors
+    AFTER UPDATE OF name, names, synonyms
+    ON tags
+    FOR EACH ROW
+EXECUTE FUNCTION refresh_tag_search_vectors();
+
+UPDATE contacts c
+SET search_vector = contact_search_vector(c)
+WHERE EXISTS (SELECT 1
+              FROM contact_tags ct
+                       JOIN tags t ON t.id = ct.tag_id
+              WHERE ct.contact_id = c.id
+                AND (cardinality(t.synonyms) > 0 OR t.names <> '{}'));
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS contact_tags_tag_id_index;
+DROP INDEX IF EXISTS tags_name_trgm_index;
@@ -0,0 +1,2 @@
+CREATE INDEX tags_name_trgm_index ON tags USING GIN (name gin_trgm_ops);
+CREATE INDEX contact_tags_tag_id_index ON contact_tags (tag_id);
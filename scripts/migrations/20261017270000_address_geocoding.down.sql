@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS addresses_geocode_pending_index;
+
+ALTER TABLE addresses DROP COLUMN IF EXISTS geocode_pending;
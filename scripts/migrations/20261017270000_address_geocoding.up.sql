@@ -0,0 +1,3 @@
+ALTER TABLE addresses ADD COLUMN geocode_pending BOOLEAN NOT NULL DEFAULT false;
+
+CREATE INDEX addresses_geocode_pending_index ON addresses (updated_at) WHERE geocode_pending AND deleted_at IS NULL;
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS email_outbox_expires_at_index;
+
+ALTER TABLE email_outbox
+    DROP COLUMN IF EXISTS expires_at;
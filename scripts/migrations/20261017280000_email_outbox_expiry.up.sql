@@ -0,0 +1,12 @@
+ALTER TABLE email_outbox
+    ADD COLUMN expires_at TIMESTAMP;
+
+-- queued emails carry OTP codes and reset links valid for at most an hour
+UPDATE email_outbox SET expires_at = created_at + interval '1 hour';
+
+ALTER TABLE email_outbox
+    ALTER COLUMN expires_at SET NOT NULL;
+
+UPDATE email_outbox SET html_body = '', text_body = '' WHERE status <> 'pending';
+
+CREATE INDEX email_outbox_expires_at_index ON email_outbox (expires_at) WHERE html_body <> '';
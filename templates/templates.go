@@ -0,0 +1,11 @@
+// Package templates embeds the transactional email templates.
+//
+// Every email is a pair of files in a locale directory: <name>.gohtml with
+// the HTML body and <name>.gotxt with the plain-text body, which also
+// defines the "subject" template.
+package templates
+
+import "embed"
+
+//go:embed */*.gohtml */*.gotxt
+var FS embed.FS
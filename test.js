@@ -1,5 +1,7 @@
 const {spec} = require('pactum');
 const {faker} = require('@faker-js/faker');
+const {execSync} = require('child_process');
+const crypto = require('crypto');
 
 const API_URL = 'http://127.0.0.1:8080/api';
 const ADMIN_URL = 'http://127.0.0.1:8080/admin';
@@ -10,6 +12,20 @@ const TEST_USER = {
     password: faker.internet.password()
 }
 
+// psql runs a query against the test database the way the npm scripts do,
+// for state the API does not expose, like emailed reset tokens.
+const psql = (query) => execSync(`docker exec postgres psql -U postgres -d touchly -tA -c "${query}"`).toString().trim();
+
+// createPasswordReset stores a reset token for the user and returns it.
+const createPasswordReset = (userId, expiresIn) => {
+    const token = crypto.randomBytes(32).toString('hex');
+    const hash = crypto.createHash('sha256').update(token).digest('hex');
+
+    psql(`INSERT INTO password_resets (user_id, token_hash, expires_at) VALUES (${userId}, '${hash}', NOW() + interval '${expiresIn}')`);
+
+    return token;
+}
+
 describe('API Test', () => {
     before(async () => {
         await spec()
@@ -43,9 +59,10 @@ describe('API Test', () => {
             .expectStatus(200)
             .expectJsonSchema({
                 type: 'object',
-                required: ['token']
+                required: ['token', 'refresh_token', 'expires_at']
             })
-            .stores('token', 'token');
+            .stores('token', 'token')
+            .stores('refreshToken', 'refresh_token');
     });
 
     it('GET /me', async () => {
@@ -63,6 +80,110 @@ describe('API Test', () => {
             });
     });
 
+    it('POST /otp signs up a new user with a language', async () => {
+        const email = faker.internet.email().toLowerCase();
+
+        await spec()
+            .post(API_URL + '/otp')
+            .withJson({email: email, language: 'ru'})
+            .expectStatus(200);
+
+        await spec()
+            .get(ADMIN_URL + '/users')
+            .withQueryParams('email', email)
+            .withHeaders({
+                'Authorization': 'Bearer ' + process.env.ADMIN_TOKEN
+            })
+            .expectStatus(200)
+            .expectJsonMatch({
+                email: email,
+                language: 'ru',
+                email_verified_at: null
+            });
+    });
+
+    it('POST /password/forgot and /password/reset', async () => {
+        const user = {email: faker.internet.email().toLowerCase(), password: faker.internet.password()};
+
+        const userId = await spec()
+            .post(ADMIN_URL + '/users')
+            .withJson(user)
+            .withHeaders({
+                'Authorization': 'Bearer ' + process.env.ADMIN_TOKEN
+            })
+            .expectStatus(201)
+            .returns('id');
+
+        await spec()
+            .post(API_URL + '/password/forgot')
+            .withJson({email: user.email})
+            .expectStatus(200);
+
+        // within the cooldown the request succeeds without a new link
+        await spec()
+            .post(API_URL + '/password/forgot')
+            .withJson({email: user.email})
+            .expectStatus(200);
+
+        if (psql(`SELECT COUNT(*) FROM password_resets WHERE user_id = ${userId}`) !== '1') {
+            throw new Error('expected a single reset link within the cooldown');
+        }
+
+        // unknown emails are not revealed
+        await spec()
+            .post(API_URL + '/password/forgot')
+            .withJson({email: faker.internet.email().toLowerCase()})
+            .expectStatus(200);
+
+        const expired = createPasswordReset(userId, '-1 minute');
+
+        await spec()
+            .post(API_URL + '/password/reset')
+            .withJson({token: expired, password: faker.internet.password()})
+            .expectStatus(400);
+
+        const token = createPasswordReset(userId, '1 hour');
+        const password = faker.internet.password();
+
+        await spec()
+            .post(API_URL + '/password/reset')
+            .withJson({token: token, password: password})
+            .expectStatus(200);
+
+        await spec()
+            .post(API_URL + '/login')
+            .withJson({email: user.email, password: password})
+            .expectStatus(200);
+
+        // a token can only be used once
+        await spec()
+            .post(API_URL + '/password/reset')
+            .withJson({token: token, password: faker.internet.password()})
+            .expectStatus(400);
+    });
+
+    it('POST /token/refresh', async () => {
+        await spec()
+            .post(API_URL + '/token/refresh')
+            .withJson({refresh_token: '$S{refreshToken}'})
+            .expectStatus(200)
+            .expectJsonSchema({
+                type: 'object',
+                required: ['token', 'refresh_token', 'expires_at']
+            })
+            .stores('token', 'token')
+            .stores('refreshToken', 'refresh_token');
+    });
+
+    it('GET /me/sessions', async () => {
+        await spec()
+            .get(API_URL + '/me/sessions')
+            .withBearerToken('$S{token}')
+            .expectStatus(200)
+            .expectJsonLength(1)
+            .expectJsonMatch([{current: true}]);
+    });
+
     it('POST /tags', async () => {
         const firstTag = faker.word.noun()
 
@@ -100,15 +221,62 @@ describe('API Test', () => {
     it('GET /tags', async () => {
         await spec()
             .get(API_URL + '/tags')
+            .withBearerToken('$S{token}')
             .expectStatus(200)
             .expectJsonLength(2)
             .expectJsonSchema({
                 type: 'array',
                 items: {
                     type: 'object',
-                    required: ['id', 'name']
+                    required: ['id', 'name', 'user_id']
                 }
+            })
+            .expectJsonMatch('[0]', {
+                user_id: '$S{userId}'
             });
+
+        // personal tags are not listed without a token
+        await spec()
+            .get(API_URL + '/tags')
+            .expectStatus(200)
+            .expectJsonLength(0);
+    });
+
+    it('POST and DELETE /admin/tags', async () => {
+        await spec()
+            .post(API_URL + '/tags')
+            .withJson({name: faker.word.noun()})
+            .expectStatus(401);
+
+        await spec()
+            .post(ADMIN_URL + '/tags')
+            .withJson({name: faker.word.noun()})
+            .withHeaders({
+                'Content-Type': 'application/json',
+                'Authorization': 'Bearer ' + process.env.ADMIN_TOKEN
+            })
+            .expectStatus(201)
+            .expectJsonMatch({
+                user_id: null
+            })
+            .stores('systemTagId', 'id');
+
+        await spec()
+            .get(API_URL + '/tags')
+            .expectStatus(200)
+            .expectJsonLength(1);
+
+        await spec()
+            .delete(API_URL + '/tags/$S{systemTagId}')
+            .withBearerToken('$S{token}')
+            .expectStatus(403);
+
+        await spec()
+            .delete(ADMIN_URL + '/tags/$S{systemTagId}')
+            .withHeaders({
+                'Authorization': 'Bearer ' + process.env.ADMIN_TOKEN
+            })
+            .expectStatus(200);
     });
 
     const firstContact = {
@@ -211,6 +379,7 @@ describe('API Test', () => {
 
             await spec()
                 .post(API_URL + '/contacts/' + contactId + '/address')
+                .withHeaders('If-Match', '*')
                 .withJson(address)
                 .withBearerToken('$S{token}')
                 .expectStatus(201)
@@ -229,6 +398,92 @@ describe('API Test', () => {
         }
     });
 
+    it('PUT and DELETE /contacts/:contactId/addresses/:addressId', async () => {
+        await spec()
+            .post(API_URL + '/contacts/$S{firstContactId}/addresses')
+            .withHeaders('If-Match', '*')
+            .withJson({
+                label: 'Work',
+                name: faker.location.streetAddress(),
+                lat: 51.5074,
+                lng: -0.1278
+            })
+            .withBearerToken('$S{token}')
+            .expectStatus(201)
+            .expectJsonMatch({
+                label: 'Work',
+                is_primary: false
+            })
+            .stores('workAddressId', 'id');
+
+        await spec()
+            .put(API_URL + '/contacts/$S{firstContactId}/addresses/$S{workAddressId}')
+            .withHeaders('If-Match', '*')
+            .withJson({
+                label: 'Office',
+                name: faker.location.streetAddress(),
+                lat: 51.5074,
+                lng: -0.1278
+            })
+            .withBearerToken('$S{token}')
+            .expectStatus(200)
+            .expectJsonMatch({
+                label: 'Office',
+                is_primary: false
+            });
+
+        await spec()
+            .get(API_URL + '/contacts/$S{firstContactId}')
+            .withBearerToken('$S{token}')
+            .expectStatus(200)
+            .expectJsonLength('addresses', 2);
+
+        await spec()
+            .delete(API_URL + '/contacts/$S{firstContactId}/addresses/$S{workAddressId}')
+            .withHeaders('If-Match', '*')
+            .withBearerToken('$S{token}')
+            .expectStatus(204);
+
+        await spec()
+            .get(API_URL + '/contacts/$S{firstContactId}')
+            .withBearerToken('$S{token}')
+            .expectStatus(200)
+            .expectJsonLength('addresses', 1);
+    });
+
+    it('DELETE and restore /contacts/:contactId', async () => {
+        await spec()
+            .delete(API_URL + '/contacts/$S{secondContactId}')
+            .withBearerToken('$S{token}')
+            .expectStatus(200);
+
+        await spec()
+            .get(API_URL + '/contacts/$S{secondContactId}')
+            .withBearerToken('$S{token}')
+            .expectStatus(404);
+
+        await spec()
+            .get(API_URL + '/me/trash')
+            .withBearerToken('$S{token}')
+            .expectStatus(200)
+            .expectJsonLength(1)
+            .expectJsonMatch('[0].id', '$S{secondContactId}');
+
+        await spec()
+            .post(API_URL + '/contacts/$S{secondContactId}/restore')
+            .withBearerToken('$S{token}')
+            .expectStatus(200)
+            .expectJsonMatch({
+                deleted_at: null
+            });
+
+        await spec()
+            .get(API_URL + '/me/trash')
+            .withBearerToken('$S{token}')
+            .expectStatus(200)
+            .expectJsonLength(0);
+    });
+
     it('GET /contacts', async () => {
         await spec()
             .get(API_URL + '/contacts')
@@ -245,6 +500,61 @@ describe('API Test', () => {
             .expectJsonLength('contacts', 2);
     });
 
+    it('GET /contacts with cursor', async () => {
+        await spec()
+            .get(API_URL + '/contacts?page_size=1&sort=name&count=false')
+            .expectStatus(200)
+            .expectJsonMatch({
+                total_count: null,
+                prev_cursor: null
+            })
+            .expectJsonLength('contacts', 1)
+            .stores('nextCursor', 'next_cursor')
+            .stores('firstByName', 'contacts[0].id');
+
+        await spec()
+            .get(API_URL + '/contacts?page_size=1&cursor=$S{nextCursor}')
+            .expectStatus(200)
+            .expectJsonMatch({
+                next_cursor: null
+            })
+            .expectJsonLength('contacts', 1)
+            .stores('prevCursor', 'prev_cursor');
+
+        await spec()
+            .get(API_URL + '/contacts?page_size=1&cursor=$S{prevCursor}')
+            .expectStatus(200)
+            .expectJsonMatch({
+                contacts: [{id: '$S{firstByName}'}],
+                prev_cursor: null
+            });
+
+        // cursors come from clients, a key that is not of the sort's type is rejected
+        const tampered = Buffer.from(JSON.stringify({s: 'created', d: true, k: 'yesterday', i: 1})).toString('base64url');
+
+        await spec()
+            .get(API_URL + '/contacts?cursor=' + tampered)
+            .expectStatus(400);
+
+        await spec()
+            .get(API_URL + '/contacts?sort=views&cursor=$S{nextCursor}')
+            .expectStatus(400);
+    });
+
+    it('GET /contacts/clusters', async () => {
+        await spec()
+            .get(API_URL + '/contacts/clusters?bbox=-10,40,50,60&zoom=2')
+            .expectStatus(200)
+            .expectJsonLength(2)
+            .expectJsonSchema({
+                type: 'array',
+                items: {
+                    type: 'object',
+                    required: ['center', 'count', 'contact_ids', 'bounds']
+                }
+            });
+    });
+
     const searchCases = {
         'Search By Name': {
             query: '?search=' + firstContact.name,
@@ -288,6 +598,28 @@ describe('API Test', () => {
                 ]
             },
         },
+        'Search By Bounding Box': {
+            query: '?bbox=37.5,55.7,37.8,55.9',
+            expected: {
+                total_count: 1,
+                contacts: [
+                    {
+                        id: '$S{firstContactId}',
+                        location: firstContactAddress.location,
+                    }
+                ]
+            },
+        },
+        'Search Nearest First': {
+            query: '?lat=55.7558&lng=37.6176&radius_m=5000000&sort=distance',
+            expected: {
+                total_count: 2,
+                contacts: [
+                    {id: '$S{firstContactId}'},
+                    {id: '$S{secondContactId}'},
+                ]
+            },
+        },
         'Search By Tag': {
             query: '?tag=$S{firstTagId}',
             expected: {
@@ -324,6 +656,95 @@ describe('API Test', () => {
         });
     }
 
+    // unique words, so each search finds nothing but the searched contact
+    const searchWords = {
+        name: faker.string.alpha({length: 14, casing: 'lower'}),
+        about: faker.string.alpha({length: 14, casing: 'lower'}),
+        tag: faker.string.alpha({length: 14, casing: 'lower'}),
+        handle: faker.string.alpha({length: 14, casing: 'lower'}),
+    }
+
+    // the last letter of the name replaced, found by trigram similarity only
+    const nameTypo = searchWords.name.slice(0, -1) + (searchWords.name.endsWith('z') ? 'y' : 'z');
+
+    it('POST /contacts to search', async () => {
+        await spec()
+            .post(API_URL + '/tags')
+            .withJson({name: searchWords.tag})
+            .withBearerToken('$S{token}')
+            .expectStatus(201)
+            .stores('searchTagId', 'id');
+
+        await spec()
+            .post(API_URL + '/contacts')
+            .withJson({
+                name: '<b>' + searchWords.name + '</b> Tester',
+                about: 'Bakes ' + searchWords.about + ' every morning',
+                tags: [{id: '$S{searchTagId}'}],
+                social_links: [{type: 'telegram', link: 'https://t.me/' + searchWords.handle}]
+            })
+            .withBearerToken('$S{token}')
+            .expectStatus(201)
+            .stores('searchContactId', 'id');
+    });
+
+    const textSearchCases = {
+        'Search By About': searchWords.about,
+        'Search By Tag Name': searchWords.tag,
+        'Search By Social Handle': searchWords.handle,
+        'Search With A Typo': nameTypo,
+    }
+
+    for (let [name, search] of Object.entries(textSearchCases)) {
+        it(name + ' GET /contacts?search=' + search, async () => {
+            await spec()
+                .get(API_URL + '/contacts')
+                .withQueryParams('search', search)
+                .expectStatus(200)
+                .expectJsonMatch({
+                    total_count: 1,
+                    contacts: [{id: '$S{searchContactId}'}]
+                });
+        });
+    }
+
+    it('Search highlights GET /contacts?search', async () => {
+        await spec()
+            .get(API_URL + '/contacts')
+            .withQueryParams('search', searchWords.name)
+            .expectStatus(200)
+            .expectJsonMatch({
+                total_count: 1,
+                contacts: [{
+                    id: '$S{searchContactId}',
+                    // HTML in the name is escaped, only <mark> is left unescaped
+                    highlight: {name: '&lt;b&gt;<mark>' + searchWords.name + '</mark>&lt;/b&gt; Tester'}
+                }]
+            });
+
+        const about = await spec()
+            .get(API_URL + '/contacts')
+            .withQueryParams('search', searchWords.about)
+            .expectStatus(200)
+            .returns('contacts[0].highlight.about');
+
+        if (!about.includes('<mark>' + searchWords.about + '</mark>')) {
+            throw new Error('expected the about match to be highlighted, got ' + about);
+        }
+    });
+
+    it('DELETE searched contact and tag', async () => {
+        await spec()
+            .delete(API_URL + '/contacts/$S{searchContactId}')
+            .withBearerToken('$S{token}')
+            .expectStatus(200);
+
+        await spec()
+            .delete(API_URL + '/tags/$S{searchTagId}')
+            .withBearerToken('$S{token}')
+            .expectStatus(200);
+    });
+
     it('GET /contacts/:contactId', async () => {
         await spec()
             .get(API_URL + '/contacts/$S{firstContactId}')
@@ -352,6 +773,146 @@ describe('API Test', () => {
             });
     });
 
+    it('GET /tags tree', async () => {
+        await spec()
+            .post(API_URL + '/tags')
+            .withJson({
+                name: 'Bakery ' + faker.string.alphanumeric(8),
+                parent_id: '$S{firstTagId}',
+                names: {ru: 'Пекарня'},
+                synonyms: ['patisserie']
+            })
+            .withBearerToken('$S{token}')
+            .expectStatus(201)
+            .expectJsonMatch({
+                parent_id: '$S{firstTagId}',
+                synonyms: ['patisserie']
+            })
+            .stores('childTagId', 'id');
+
+        await spec()
+            .get(API_URL + '/tags?tree=true')
+            .withBearerToken('$S{token}')
+            .expectStatus(200)
+            .expectJsonLength(2);
+
+        await spec()
+            .put(API_URL + '/tags/$S{firstTagId}')
+            .withJson({name: faker.word.noun(), parent_id: '$S{childTagId}'})
+            .withBearerToken('$S{token}')
+            .expectStatus(400);
+
+        await spec()
+            .delete(API_URL + '/tags/$S{childTagId}')
+            .withBearerToken('$S{token}')
+            .expectStatus(200);
+    });
+
+    it('GET /tags/suggest and /contacts/:contactId/tag-suggestions', async () => {
+        await spec()
+            .post(API_URL + '/tags')
+            .withJson({
+                name: 'Bakery ' + faker.string.alphanumeric(8),
+                synonyms: ['patisserie']
+            })
+            .withBearerToken('$S{token}')
+            .expectStatus(201)
+            .stores('bakeryTagId', 'id');
+
+        await spec()
+            .get(API_URL + '/tags/suggest?q=patiss')
+            .withBearerToken('$S{token}')
+            .expectStatus(200)
+            .expectJsonMatch('[0]', {
+                id: '$S{bakeryTagId}'
+            });
+
+        await spec()
+            .get(API_URL + '/tags/suggest')
+            .expectStatus(400);
+
+        // a tag named like the activity of the contact is suggested for it
+        const activityTagId = await spec()
+            .post(API_URL + '/tags')
+            .withJson({name: firstContact.activity_name})
+            .withBearerToken('$S{token}')
+            .expectStatus(201)
+            .returns('id');
+
+        const suggestions = await spec()
+            .get(API_URL + '/contacts/$S{firstContactId}/tag-suggestions')
+            .withBearerToken('$S{token}')
+            .expectStatus(200)
+            .expectJsonSchema({
+                type: 'array',
+                items: {
+                    type: 'object',
+                    required: ['id', 'name', 'score', 'reason']
+                }
+            })
+            .returns((ctx) => ctx.res.json);
+
+        const suggestion = suggestions.find((s) => s.id === activityTagId);
+
+        if (!suggestion || suggestion.reason !== 'text') {
+            throw new Error('expected the activity tag to be suggested as text, got ' + JSON.stringify(suggestions));
+        }
+
+        for (let id of ['$S{bakeryTagId}', activityTagId]) {
+            await spec()
+                .delete(API_URL + '/tags/' + id)
+                .withBearerToken('$S{token}')
+                .expectStatus(200);
+        }
+    });
+
+    it('GET /contacts/:contactId/vcard', async () => {
+        await spec()
+            .get(API_URL + '/contacts/$S{firstContactId}/vcard?version=4.0')
+            .withBearerToken('$S{token}')
+            .expectStatus(200)
+            .expectHeaderContains('content-type', 'text/vcard')
+            .expectBodyContains('VERSION:4.0')
+            .expectBodyContains('FN:' + firstContact.name);
+
+        // public contacts export without a login
+        await spec()
+            .get(API_URL + '/contacts/$S{firstContactId}/vcard')
+            .expectStatus(200)
+            .expectBodyContains('FN:' + firstContact.name);
+    });
+
+    it('GET /contacts/:contactId/qr without token', async () => {
+        await spec()
+            .get(API_URL + '/contacts/$S{firstContactId}/qr?target=vcard')
+            .expectStatus(200)
+            .expectHeaderContains('content-type', 'image/png');
+    });
+
+    it('POST /contacts/import too large', async () => {
+        await spec()
+            .post(API_URL + '/contacts/import')
+            .withHeaders('Content-Type', 'text/vcard')
+            .withBody('BEGIN:VCARD\r\n' + 'NOTE:'.padEnd(5 << 20, 'x'))
+            .withBearerToken('$S{token}')
+            .expectStatus(413);
+    });
+
+    it('GET /contacts/:contactId/stats', async () => {
+        await spec()
+            .get(API_URL + '/contacts/$S{firstContactId}/stats')
+            .withBearerToken('$S{token}')
+            .expectStatus(200)
+            .expectJsonSchema({
+                type: 'object',
+                required: ['from', 'to', 'total_views', 'total_saves', 'days']
+            })
+            .expectJsonMatch({
+                total_views: 1,
+                total_saves: 0
+            });
+    });
+
     const firstContactUpdate = {
         name: faker.person.fullName(),
         avatar: faker.image.avatar(),
@@ -370,6 +931,7 @@ describe('API Test', () => {
     it('PUT /contacts/:contactId', async () => {
         await spec()
             .put(API_URL + '/contacts/$S{firstContactId}')
+            .withHeaders('If-Match', '*')
             .withJson(firstContactUpdate)
             .withBearerToken('$S{token}')
             .expectStatus(200)
@@ -389,15 +951,176 @@ describe('API Test', () => {
                 email: firstContact.email,
                 tags: firstContactUpdate.tags,
                 social_links: firstContactUpdate.social_links,
-                views_amount: 0,
+                views_amount: 1,
                 saves_amount: 0,
                 user_id: '$S{userId}',
             });
     });
 
+    it('GET and restore /contacts/:contactId/revisions', async () => {
+        await spec()
+            .get(API_URL + '/contacts/$S{firstContactId}/revisions')
+            .withBearerToken('$S{token}')
+            .expectStatus(200)
+            .expectJsonLength(1)
+            .expectJsonMatch('[0]', {
+                revision: 1,
+                user_id: '$S{userId}',
+                restored_from: null
+            })
+            .expectJsonMatch('[0].changes.fields.name', {
+                old: firstContact.name,
+                new: firstContactUpdate.name
+            });
+
+        const current = await spec()
+            .get(API_URL + '/contacts/$S{firstContactId}')
+            .withBearerToken('$S{token}')
+            .expectStatus(200);
+
+        await spec()
+            .post(API_URL + '/contacts/$S{firstContactId}/revisions/1/restore')
+            .withBearerToken('$S{token}')
+            .expectStatus(428);
+
+        await spec()
+            .post(API_URL + '/contacts/$S{firstContactId}/revisions/1/restore')
+            .withHeaders('If-Match', 'W/"' + (current.json.version - 1) + '"')
+            .withBearerToken('$S{token}')
+            .expectStatus(412)
+            .expectJsonMatch({
+                version: current.json.version
+            });
+
+        const restored = await spec()
+            .post(API_URL + '/contacts/$S{firstContactId}/revisions/1/restore')
+            .withHeaders('If-Match', current.headers['etag'])
+            .withBearerToken('$S{token}')
+            .expectStatus(200)
+            .expectJsonMatch({
+                name: firstContact.name
+            });
+
+        await spec()
+            .get(API_URL + '/contacts/$S{firstContactId}/revisions')
+            .withBearerToken('$S{token}')
+            .expectStatus(200)
+            .expectJsonLength(2)
+            .expectJsonMatch('[0]', {
+                revision: 2,
+                restored_from: 1
+            });
+
+        await spec()
+            .post(API_URL + '/contacts/$S{firstContactId}/revisions/2/restore')
+            .withHeaders('If-Match', restored.headers['etag'])
+            .withBearerToken('$S{token}')
+            .expectStatus(200)
+            .expectJsonMatch({
+                name: firstContactUpdate.name
+            });
+    });
+
+    it('PUT /contacts/:contactId with If-Match', async () => {
+        const res = await spec()
+            .get(API_URL + '/contacts/$S{firstContactId}')
+            .withBearerToken('$S{token}')
+            .expectStatus(200)
+            .expectHeaderContains('etag', 'W/');
+
+        const etag = res.headers['etag'];
+
+        await spec()
+            .get(API_URL + '/contacts/$S{firstContactId}')
+            .withBearerToken('$S{token}')
+            .withHeaders('If-None-Match', etag)
+            .expectStatus(304);
+
+        await spec()
+            .put(API_URL + '/contacts/$S{firstContactId}')
+            .withJson({name: firstContactUpdate.name})
+            .withBearerToken('$S{token}')
+            .expectStatus(428);
+
+        await spec()
+            .put(API_URL + '/contacts/$S{firstContactId}')
+            .withHeaders('If-Match', etag)
+            .withJson({name: firstContactUpdate.name})
+            .withBearerToken('$S{token}')
+            .expectStatus(200);
+
+        await spec()
+            .put(API_URL + '/contacts/$S{firstContactId}')
+            .withHeaders('If-Match', etag)
+            .withJson({name: faker.person.fullName()})
+            .withBearerToken('$S{token}')
+            .expectStatus(412)
+            .expectJsonMatch({
+                name: firstContactUpdate.name
+            });
+    });
+
+    it('PATCH /contacts/:contactId', async () => {
+        await spec()
+            .patch(API_URL + '/contacts/$S{firstContactId}')
+            .withHeaders('If-Match', '*')
+            .withJson({website: null})
+            .withBearerToken('$S{token}')
+            .expectStatus(415);
+
+        await spec()
+            .patch(API_URL + '/contacts/$S{firstContactId}')
+            .withHeaders('If-Match', '*')
+            .withHeaders('Content-Type', 'application/merge-patch+json')
+            .withJson({website: null, email: 'not an email'})
+            .withBearerToken('$S{token}')
+            .expectStatus(400);
+
+        await spec()
+            .patch(API_URL + '/contacts/$S{firstContactId}')
+            .withHeaders('If-Match', '*')
+            .withHeaders('Content-Type', 'application/merge-patch+json')
+            .withJson({website: null})
+            .withBearerToken('$S{token}')
+            .expectStatus(200)
+            .expectJsonMatch({
+                name: firstContactUpdate.name,
+                website: null
+            });
+
+        await spec()
+            .patch(API_URL + '/contacts/$S{firstContactId}')
+            .withHeaders('If-Match', '*')
+            .withHeaders('Content-Type', 'application/json-patch+json')
+            .withJson([
+                {op: 'add', path: '/website', value: firstContactUpdate.website},
+                {op: 'add', path: '/tags/-', value: {id: '$S{firstTagId}'}},
+                {op: 'remove', path: '/social_links/2'}
+            ])
+            .withBearerToken('$S{token}')
+            .expectStatus(200)
+            .expectJsonLength('tags', 2)
+            .expectJsonLength('social_links', 2)
+            .expectJsonMatch({
+                website: firstContactUpdate.website
+            });
+
+        await spec()
+            .patch(API_URL + '/contacts/$S{firstContactId}')
+            .withHeaders('If-Match', '*')
+            .withHeaders('Content-Type', 'application/json-patch+json')
+            .withJson([
+                {op: 'test', path: '/name', value: firstContact.name},
+                {op: 'remove', path: '/tags/0'}
+            ])
+            .withBearerToken('$S{token}')
+            .expectStatus(400);
+    });
+
     it('PUT /contacts/:contactId/visibility', async () => {
         await spec()
             .put(API_URL + '/contacts/$S{firstContactId}/visibility')
+            .withHeaders('If-Match', '*')
             .withJson({visibility: 'private'})
             .withBearerToken('$S{token}')
             .expectStatus(200)
@@ -417,6 +1140,14 @@ describe('API Test', () => {
         await spec()
             .get(API_URL + '/contacts/$S{firstContactId}')
             .expectStatus(404);
+
+        await spec()
+            .get(API_URL + '/contacts/$S{firstContactId}/vcard')
+            .expectStatus(404);
+
+        await spec()
+            .get(API_URL + '/contacts/$S{firstContactId}/qr')
+            .expectStatus(404);
     });
 
     it('GET /contacts hidden, without token', async () => {
@@ -426,6 +1157,60 @@ describe('API Test', () => {
             .expectJsonLength('contacts', 1);
     });
 
+    it('POST /contacts/:contactId/share-links', async () => {
+        await spec()
+            .put(API_URL + '/contacts/$S{firstContactId}/visibility')
+            .withHeaders('If-Match', '*')
+            .withJson({visibility: 'shared_link'})
+            .withBearerToken('$S{token}')
+            .expectStatus(200);
+
+        await spec()
+            .post(API_URL + '/contacts/$S{firstContactId}/share-links')
+            .withJson({max_views: 10})
+            .withBearerToken('$S{token}')
+            .expectStatus(201)
+            .expectJsonSchema({
+                type: 'object',
+                required: ['id', 'contact_id', 'token', 'expires_at', 'max_views', 'views_amount']
+            })
+            .expectJsonMatch({
+                contact_id: '$S{firstContactId}',
+                max_views: 10,
+                views_amount: 0
+            })
+            .stores('shareLinkId', 'id')
+            .stores('shareToken', 'token');
+    });
+
+    it('GET /shared/:token', async () => {
+        await spec()
+            .get(API_URL + '/shared/$S{shareToken}')
+            .expectStatus(200)
+            .expectJsonMatch({
+                id: '$S{firstContactId}',
+                visibility: 'shared_link'
+            });
+    });
+
+    it('DELETE /contacts/:contactId/share-links/:linkId', async () => {
+        await spec()
+            .delete(API_URL + '/contacts/$S{firstContactId}/share-links/$S{shareLinkId}')
+            .withBearerToken('$S{token}')
+            .expectStatus(200);
+
+        await spec()
+            .get(API_URL + '/shared/$S{shareToken}')
+            .expectStatus(404);
+
+        await spec()
+            .put(API_URL + '/contacts/$S{firstContactId}/visibility')
+            .withHeaders('If-Match', '*')
+            .withJson({visibility: 'private'})
+            .withBearerToken('$S{token}')
+            .expectStatus(200);
+    });
+
     it('GET /me/contacts', async () => {
         await spec()
             .get(API_URL + '/me/contacts')
@@ -449,6 +1234,15 @@ describe('API Test', () => {
             .expectJsonLength(1);
     })
 
+    it('GET /me/saved-contacts.vcf', async () => {
+        await spec()
+            .get(API_URL + '/me/saved-contacts.vcf')
+            .withBearerToken('$S{token}')
+            .expectStatus(200)
+            .expectHeaderContains('content-type', 'text/vcard')
+            .expectBodyContains('BEGIN:VCARD');
+    })
+
     it('GET /contacts', async () => {
         await spec()
             .get(API_URL + '/contacts')